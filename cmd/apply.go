@@ -33,6 +33,7 @@ var (
 	dmlFile     string
 	partitioned bool
 	priority    string
+	resumeFrom  int
 )
 
 var applyCmd = &cobra.Command{
@@ -53,10 +54,10 @@ func apply(c *cobra.Command, _ []string) error {
 
 	if ddlFile != "" {
 		if dmlFile != "" {
-			return errors.New("cannot specify DDL and DML at same time")
+			return invalidInput(errors.New("cannot specify DDL and DML at same time"))
 		}
 
-		ddl, err := fs.ReadFile(ctx, ddlFile)
+		ddl, err := readSQLFile(ctx, c, ddlFile)
 		if err != nil {
 			return &Error{
 				err: err,
@@ -70,7 +71,7 @@ func apply(c *cobra.Command, _ []string) error {
 			protoDescriptor, err = fs.ReadFile(ctx, protoDescriptorFile)
 			if err != nil {
 				return &Error{
-					err: err,
+					err: invalidInput(err),
 					cmd: c,
 				}
 			}
@@ -88,11 +89,11 @@ func apply(c *cobra.Command, _ []string) error {
 	}
 
 	if dmlFile == "" {
-		return errors.New("Must specify DDL or DML.")
+		return invalidInput(errors.New("Must specify DDL or DML."))
 	}
 
 	// apply dml
-	dml, err := fs.ReadFile(ctx, dmlFile)
+	dml, err := readSQLFile(ctx, c, dmlFile)
 	if err != nil {
 		return &Error{
 			err: err,
@@ -108,13 +109,18 @@ func apply(c *cobra.Command, _ []string) error {
 		}
 	}
 
-	numAffectedRows, err := client.ApplyDMLFile(ctx, dmlFile, dml, partitioned, p)
+	numAffectedRows, err := client.ApplyDMLFileFrom(ctx, dmlFile, dml, partitioned, p, resumeFrom)
 	if err != nil {
 		return &Error{
 			err: err,
 			cmd: c,
 		}
 	}
+	if jsonOutput() {
+		commandResult.RowsAffected = &numAffectedRows
+		return nil
+	}
+
 	fmt.Printf("%d rows affected.\n", numAffectedRows)
 
 	return nil
@@ -137,10 +143,10 @@ func priorityTypeOf(prioirty string) (spanner.PriorityType, error) {
 	case "":
 		return spanner.PriorityTypeUnspecified, nil
 	default:
-		return 0, fmt.Errorf(
+		return 0, invalidInput(fmt.Errorf(
 			"%s is unsupported priority, it must be one of %s, %s, or %s",
 			priority, priorityTypeHigh, priorityTypeMedium, priorityTypeLow,
-		)
+		))
 	}
 }
 
@@ -149,5 +155,6 @@ func init() {
 	applyCmd.PersistentFlags().StringVar(&dmlFile, flagDMLFile, "", "DML file to be applied")
 	applyCmd.PersistentFlags().BoolVar(&partitioned, flagPartitioned, false, "Whether given DML should be executed as a Partitioned-DML or not")
 	applyCmd.PersistentFlags().StringVar(&priority, flagPriority, "", "The priority to apply DML(optional)")
+	applyCmd.PersistentFlags().IntVar(&resumeFrom, flagResumeFrom, 1, "The transaction of DML to resume from, skipping the committed ones before it(optional)")
 	applyCmd.PersistentFlags().String(flagProtoDescriptorFile, "", "Proto descriptor file to be used with DDL operations")
 }
@@ -24,9 +24,11 @@ import (
 	"fmt"
 	"path/filepath"
 	"regexp"
+	"strings"
 
 	"github.com/spf13/cobra"
 
+	"github.com/cloudspannerecosystem/wrench/internal/fs"
 	"github.com/cloudspannerecosystem/wrench/pkg/spanner"
 )
 
@@ -45,14 +47,41 @@ const (
 	flagTimeout             = "timeout"
 	flagProtoDescriptorFile = "proto_descriptor_file"
 	flagMigrationTableName  = "migration_table_name"
+	flagAllowChecksumDrift  = "allow_checksum_drift"
+	flagOutput              = "output"
+	flagDryRun              = "dry_run"
+	flagPlanFile            = "out"
+	flagLockWait            = "lock_wait"
+	flagLockLease           = "lock_lease"
+	flagBatchDDL            = "batch_ddl"
+	flagResume              = "resume"
+	flagMarkClean           = "mark_clean"
+	flagTimestamp           = "timestamp"
+	flagAllowOutOfOrder     = "allow_out_of_order"
+	flagSince               = "since"
+	flagResumeFrom          = "resume_from"
+	flagMaxMutations        = "max_mutations"
+	flagVar                 = "var"
+	flagEnv                 = "env"
+	flagBeforeRun           = "before_run"
+	flagAfterRun            = "after_run"
+	flagBeforeMigration     = "before_migration"
+	flagAfterMigration      = "after_migration"
 	defaultSchemaFileName   = "schema.sql"
 
 	defaultMigrationTableName = "SchemaMigrations"
+
+	// migrationVersionDigits is the zero-padded width of sequential migration versions.
+	migrationVersionDigits = 6
+
+	outputText = "text"
+	outputJSON = "json"
 )
 
 // migrationTableNameRegex is the valid form of a Cloud Spanner table name.
 // The name is embedded into SQL/DDL statements, so it must be validated before use.
-var migrationTableNameRegex = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{0,127}$`)
+// It is shorter than the limit of Cloud Spanner by the longest suffix of the companion tables, e.g. the repeatable migration table.
+var migrationTableNameRegex = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{0,117}$`)
 
 func newSpannerClient(ctx context.Context, c *cobra.Command) (*spanner.Client, error) {
 	config := &spanner.Config{
@@ -60,6 +89,9 @@ func newSpannerClient(ctx context.Context, c *cobra.Command) (*spanner.Client, e
 		Instance:        c.Flag(flagNameInstance).Value.String(),
 		Database:        c.Flag(flagNameDatabase).Value.String(),
 		CredentialsFile: c.Flag(flagCredentialsFile).Value.String(),
+		WrenchVersion:   versionInfo(),
+		MaxMutations:    maxMutations,
+		Observer:        newObserver(),
 	}
 
 	client, err := spanner.NewClient(ctx, config)
@@ -79,6 +111,7 @@ func newSpannerAdminClient(ctx context.Context, c *cobra.Command) (*spanner.Admi
 		Instance:        c.Flag(flagNameInstance).Value.String(),
 		Database:        c.Flag(flagNameDatabase).Value.String(),
 		CredentialsFile: c.Flag(flagCredentialsFile).Value.String(),
+		Observer:        newObserver(),
 	}
 
 	client, err := spanner.NewAdminClient(ctx, config)
@@ -107,12 +140,43 @@ func getMigrationTableName(c *cobra.Command) (string, error) {
 	}
 
 	if !migrationTableNameRegex.MatchString(name) {
-		return "", fmt.Errorf("Invalid migration table name: %q. It must start with a letter and contain only letters, numbers and underscores (up to 128 characters).", name)
+		return "", invalidInput(fmt.Errorf("Invalid migration table name: %q. It must start with a letter and contain only letters, numbers and underscores (up to 118 characters).", name))
 	}
 
 	return name, nil
 }
 
+func getOutput(c *cobra.Command) (string, error) {
+	output := c.Flag(flagOutput).Value.String()
+	switch output {
+	case outputText, outputJSON:
+		return output, nil
+	case "":
+		return outputText, nil
+	default:
+		return "", invalidInput(fmt.Errorf("%s is unsupported output format, it must be one of %s or %s", output, outputText, outputJSON))
+	}
+}
+
+func getLockOptions(c *cobra.Command) spanner.LockOptions {
+	opts := spanner.DefaultLockOptions()
+	if wait, err := c.Flags().GetDuration(flagLockWait); err == nil {
+		opts.Wait = wait
+	}
+	if lease, err := c.Flags().GetDuration(flagLockLease); err == nil {
+		opts.Lease = lease
+	}
+	return opts
+}
+
+// environmentOptions returns the option to skip the migrations scoped to the environments other than the one given by --env.
+func environmentOptions(c *cobra.Command) []spanner.MigrationOption {
+	if env, _ := c.Flags().GetString(flagEnv); env != "" {
+		return []spanner.MigrationOption{spanner.WithEnvironment(env)}
+	}
+	return nil
+}
+
 func protoDescriptorFilePath(c *cobra.Command) string {
 	var filename string
 
@@ -127,3 +191,66 @@ func protoDescriptorFilePath(c *cobra.Command) string {
 
 	return filepath.Join(c.Flag(flagNameDirectory).Value.String(), filename)
 }
+
+// templateData returns the data to render the template files with, given by --var key=value flags.
+func templateData(c *cobra.Command) (*spanner.TemplateData, error) {
+	vars := make(map[string]string, len(templateVars))
+	for _, kv := range templateVars {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			return nil, invalidInput(fmt.Errorf("Invalid --%s %q. It must be in the form of key=value.", flagVar, kv))
+		}
+		vars[k] = v
+	}
+
+	config := &spanner.Config{
+		Project:  c.Flag(flagNameProject).Value.String(),
+		Instance: c.Flag(flagNameInstance).Value.String(),
+		Database: c.Flag(flagNameDatabase).Value.String(),
+	}
+
+	return spanner.NewTemplateData(config, vars), nil
+}
+
+// readMigrations reads the migrations in dir, rendering the template files with the data given by the flags.
+func readMigrations(ctx context.Context, c *cobra.Command, dir string) (spanner.Migrations, error) {
+	data, err := templateData(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return spanner.ReadMigrations(ctx, dir, spanner.WithTemplateData(data))
+}
+
+// readRepeatableMigrations reads the repeatable migrations in dir, rendering the template files with the data given by the flags.
+func readRepeatableMigrations(ctx context.Context, c *cobra.Command, dir string) ([]*spanner.RepeatableMigration, error) {
+	data, err := templateData(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return spanner.ReadRepeatableMigrations(ctx, dir, spanner.WithTemplateData(data))
+}
+
+// readSQLFile reads the schema or DDL/DML file, and renders it if it is a template file. e.g. schema.sql.tmpl
+func readSQLFile(ctx context.Context, c *cobra.Command, filename string) ([]byte, error) {
+	file, err := fs.ReadFile(ctx, filename)
+	if err != nil {
+		return nil, invalidInput(err)
+	}
+
+	if !spanner.IsTemplateFile(filename) {
+		return file, nil
+	}
+
+	data, err := templateData(c)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered, err := spanner.RenderTemplate(filename, file, data)
+	if err != nil {
+		return nil, invalidInput(err)
+	}
+	return rendered, nil
+}
@@ -42,7 +42,7 @@ func create(c *cobra.Command, _ []string) error {
 	defer client.Close()
 
 	filename := schemaFilePath(c)
-	ddl, err := fs.ReadFile(ctx, filename)
+	ddl, err := readSQLFile(ctx, c, filename)
 	if err != nil {
 		return &Error{
 			err: err,
@@ -56,7 +56,7 @@ func create(c *cobra.Command, _ []string) error {
 		protoDescriptor, err = fs.ReadFile(ctx, protoDescriptorFile)
 		if err != nil {
 			return &Error{
-				err: err,
+				err: invalidInput(err),
 				cmd: c,
 			}
 		}
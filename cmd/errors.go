@@ -37,3 +37,22 @@ func (e *Error) Error() string {
 func (e *Error) Unwrap() error {
 	return e.err
 }
+
+// InputError is the error of the flags, the arguments or the files given to the command, which the user has to fix,
+// e.g. an unknown flag or a --var which is not in the form of key=value.
+// The migration files which cannot be parsed or rendered are reported by spanner.ErrorCodeInvalidInput instead.
+type InputError struct {
+	Err error
+}
+
+func invalidInput(err error) error {
+	return &InputError{Err: err}
+}
+
+func (e *InputError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *InputError) Unwrap() error {
+	return e.Err
+}
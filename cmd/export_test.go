@@ -19,5 +19,64 @@
 
 package cmd
 
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/cloudspannerecosystem/wrench/pkg/spanner"
+)
+
 var CreateMigrationFile = createMigrationFile
+var CreateTimestampMigrationFile = createTimestampMigrationFile
 var GetMigrationTableName = getMigrationTableName
+var RenameMigrationFiles = renameMigrationFiles
+var RunShellHooks = runShellHooks
+var RunMigrationHooks = runMigrationHooks
+var PrintHistory = printHistory
+var PrintVerified = printVerified
+var PrintRenames = printRenames
+var PrintDirtyMigration = printDirtyMigration
+var PrintStatus = printStatus
+var PrintDryRun = printDryRun
+
+// ExecuteArgs runs the command given by args like Execute.
+func ExecuteArgs(ctx context.Context, args []string) error {
+	rootCmd.SetArgs(args)
+	defer func() {
+		rootCmd.SetArgs(nil)
+		outputFormat = outputText
+	}()
+	return Execute(ctx)
+}
+
+func NewTextObserver(w io.Writer) spanner.Observer {
+	return &textObserver{w: w}
+}
+
+func WriteResult(w io.Writer, command string, events []spanner.Event, err error) error {
+	r := &result{Command: command}
+	for _, e := range events {
+		r.OnEvent(e)
+	}
+	r.setError(err)
+	return writeJSON(w, r)
+}
+
+// OutputJSON calls print of the command with --output json, and returns the standard output of the command
+// followed by the result printed by Execute.
+func OutputJSON(command string, print func(w io.Writer) error) ([]byte, error) {
+	outputFormat, commandResult = outputJSON, &result{}
+	defer func() {
+		outputFormat, commandResult = outputText, &result{}
+	}()
+
+	var buf bytes.Buffer
+	if err := print(&buf); err != nil {
+		return nil, err
+	}
+	if err := printResult(&buf, command, nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cloudspannerecosystem/wrench/pkg/spanner"
+)
+
+// hookOptions returns the option to run the shell commands given by the hook flags around the migrations.
+// The commands are run by sh with the environment variables describing the run or the migration,
+// and a command exiting with non-zero status aborts the run.
+func hookOptions(c *cobra.Command) []spanner.MigrationOption {
+	beforeRun, _ := c.Flags().GetStringArray(flagBeforeRun)
+	afterRun, _ := c.Flags().GetStringArray(flagAfterRun)
+	beforeMigration, _ := c.Flags().GetStringArray(flagBeforeMigration)
+	afterMigration, _ := c.Flags().GetStringArray(flagAfterMigration)
+	if len(beforeRun)+len(afterRun)+len(beforeMigration)+len(afterMigration) == 0 {
+		return nil
+	}
+
+	database := []string{
+		"WRENCH_PROJECT=" + c.Flag(flagNameProject).Value.String(),
+		"WRENCH_INSTANCE=" + c.Flag(flagNameInstance).Value.String(),
+		"WRENCH_DATABASE=" + c.Flag(flagNameDatabase).Value.String(),
+	}
+
+	return []spanner.MigrationOption{spanner.WithHooks(spanner.MigrationHooks{
+		BeforeRun: func(ctx context.Context, pending spanner.Migrations) error {
+			return runShellHooks(ctx, beforeRun, slices.Concat(database, runHookEnv(flagBeforeRun, pending, nil)))
+		},
+		AfterRun: func(ctx context.Context, applied spanner.Migrations, err error) error {
+			return runShellHooks(ctx, afterRun, slices.Concat(database, runHookEnv(flagAfterRun, applied, err)))
+		},
+		BeforeMigration: func(ctx context.Context, m *spanner.Migration) error {
+			return runMigrationHooks(ctx, beforeMigration, database, flagBeforeMigration, m)
+		},
+		AfterMigration: func(ctx context.Context, m *spanner.Migration) error {
+			return runMigrationHooks(ctx, afterMigration, database, flagAfterMigration, m)
+		},
+	})}
+}
+
+// runHookEnv returns the environment variables of the hooks around the run.
+// WRENCH_VERSIONS is the space separated versions of the migrations, and WRENCH_ERROR is the error of the run if it failed.
+func runHookEnv(hook string, ms spanner.Migrations, err error) []string {
+	versions := make([]string, 0, len(ms))
+	for _, m := range ms {
+		versions = append(versions, fmt.Sprint(m.Version))
+	}
+
+	env := []string{
+		"WRENCH_HOOK=" + hook,
+		"WRENCH_VERSIONS=" + strings.Join(versions, " "),
+	}
+	if err != nil {
+		env = append(env, "WRENCH_ERROR="+err.Error())
+	}
+	return env
+}
+
+// runMigrationHooks runs the hooks around the migration with the statements of it written in the file of WRENCH_STATEMENTS_FILE,
+// since they can be longer than the limit of an environment variable, e.g. 128KiB on Linux.
+func runMigrationHooks(ctx context.Context, commands []string, database []string, hook string, m *spanner.Migration) error {
+	if len(commands) == 0 {
+		return nil
+	}
+
+	f, err := os.CreateTemp("", "wrench-statements-*.sql")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	for _, stmt := range m.Statements {
+		if _, err := fmt.Fprintf(f, "%s;\n", stmt); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return runShellHooks(ctx, commands, slices.Concat(database, migrationHookEnv(hook, m, f.Name())))
+}
+
+// migrationHookEnv returns the environment variables of the hooks around the migration.
+func migrationHookEnv(hook string, m *spanner.Migration, statementsFile string) []string {
+	return []string{
+		"WRENCH_HOOK=" + hook,
+		fmt.Sprintf("WRENCH_VERSION=%d", m.Version),
+		"WRENCH_NAME=" + m.Name,
+		"WRENCH_KIND=" + m.Kind(),
+		"WRENCH_STATEMENTS_FILE=" + statementsFile,
+	}
+}
+
+// addHookFlags adds the flags of the shell commands run around the migrations.
+func addHookFlags(c *cobra.Command) {
+	c.Flags().StringArray(flagBeforeRun, nil, "Shell command run before migrations are applied, which aborts them if it fails (can be specified multiple times)")
+	c.Flags().StringArray(flagAfterRun, nil, "Shell command run after migrations are applied or failed (can be specified multiple times)")
+	c.Flags().StringArray(flagBeforeMigration, nil, "Shell command run before each migration is applied, which aborts it if it fails (can be specified multiple times)")
+	c.Flags().StringArray(flagAfterMigration, nil, "Shell command run after each migration is applied, which aborts the rest if it fails (can be specified multiple times)")
+}
+
+func runShellHooks(ctx context.Context, commands []string, env []string) error {
+	for _, command := range commands {
+		sh := exec.CommandContext(ctx, "sh", "-c", command)
+		sh.Env = append(os.Environ(), env...)
+		sh.Stdout = os.Stdout
+		if jsonOutput() {
+			// The standard output is kept for the result in JSON.
+			sh.Stdout = os.Stderr
+		}
+		sh.Stderr = os.Stderr
+
+		if err := sh.Run(); err != nil {
+			return fmt.Errorf("%q: %w", command, err)
+		}
+	}
+	return nil
+}
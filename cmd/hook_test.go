@@ -0,0 +1,94 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package cmd_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cloudspannerecosystem/wrench/cmd"
+	"github.com/cloudspannerecosystem/wrench/pkg/spanner"
+)
+
+func TestRunShellHooks(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	ctx := context.Background()
+
+	commands := []string{
+		`echo "$WRENCH_HOOK $WRENCH_VERSION" > ` + out,
+		`echo "$WRENCH_NAME" >> ` + out,
+	}
+	if err := cmd.RunShellHooks(ctx, commands, []string{"WRENCH_HOOK=before_migration", "WRENCH_VERSION=1", "WRENCH_NAME=foo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "before_migration 1\nfoo\n"; string(got) != want {
+		t.Errorf("want %q, but got %q", want, got)
+	}
+
+	if err := cmd.RunShellHooks(ctx, []string{"exit 1", "echo never > " + out}, nil); err == nil {
+		t.Error("want error by the failed command, but got nil")
+	}
+	if got, _ := os.ReadFile(out); string(got) == "never\n" {
+		t.Error("want the commands after the failed one not run")
+	}
+}
+
+func TestRunMigrationHooks(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	ctx := context.Background()
+
+	// longer than the limit of an environment variable on Linux.
+	stmt := "INSERT INTO Singers (SingerID) VALUES " + strings.TrimSuffix(strings.Repeat("('1'), ", 30000), ", ")
+	m := &spanner.Migration{Version: 1, Name: "seed", Statements: []string{stmt, stmt}}
+
+	commands := []string{
+		`echo "$WRENCH_HOOK $WRENCH_VERSION $WRENCH_NAME" > ` + out,
+		`cat "$WRENCH_STATEMENTS_FILE" >> ` + out,
+		`echo "$WRENCH_STATEMENTS_FILE" > ` + out + `.path`,
+	}
+	if err := cmd.RunMigrationHooks(ctx, commands, nil, "before_migration", m); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "before_migration 1 seed\n" + stmt + ";\n" + stmt + ";\n"; string(got) != want {
+		t.Errorf("want %d bytes of the statements, but got %d bytes", len(want), len(got))
+	}
+
+	path, err := os.ReadFile(out + ".path")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(strings.TrimSpace(string(path))); !os.IsNotExist(err) {
+		t.Errorf("want the statements file removed, but got %v", err)
+	}
+}
@@ -57,6 +57,7 @@ func load(c *cobra.Command, _ []string) error {
 			cmd: c,
 		}
 	}
+	commandResult.Files = append(commandResult.Files, schemaFilePath(c))
 
 	protoDescriptorFile := protoDescriptorFilePath(c)
 	if protoDescriptorFile != "" && len(protoDescriptors) > 0 {
@@ -67,6 +68,7 @@ func load(c *cobra.Command, _ []string) error {
 				cmd: c,
 			}
 		}
+		commandResult.Files = append(commandResult.Files, protoDescriptorFile)
 	}
 
 	return nil
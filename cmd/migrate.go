@@ -21,12 +21,16 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/cloudspannerecosystem/wrench/internal/fs"
 	"github.com/cloudspannerecosystem/wrench/pkg/spanner"
@@ -54,30 +58,112 @@ func init() {
 		Short: "Apply all or N up migrations",
 		RunE:  migrateUp,
 	}
+	migratePlanCmd := &cobra.Command{
+		Use:   "plan [N]",
+		Short: "Save a plan to apply all or N up migrations",
+		RunE:  migratePlan,
+	}
+	migrateApplyPlanCmd := &cobra.Command{
+		Use:   "apply-plan PLAN_FILE",
+		Short: "Apply up migrations saved in a plan file",
+		RunE:  migrateApplyPlan,
+	}
+	migrateDownCmd := &cobra.Command{
+		Use:   "down [N]",
+		Short: "Apply N down migrations (default 1)",
+		RunE:  migrateDown,
+	}
 	migrateVersionCmd := &cobra.Command{
 		Use:   "version",
 		Short: "Print current migration version",
 		RunE:  migrateVersion,
 	}
+	migrateStatusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Print applied, pending and missing migrations",
+		RunE:  migrateStatus,
+	}
+	migrateHistoryCmd := &cobra.Command{
+		Use:   "history",
+		Short: "Print applied migration history",
+		RunE:  migrateHistory,
+	}
+	migrateVerifyCmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Verify that applied migration files are not edited or deleted",
+		RunE:  migrateVerify,
+	}
+	migrateRenumberCmd := &cobra.Command{
+		Use:   "renumber",
+		Short: "Renumber migrations not applied yet to resolve colliding and skipped versions",
+		RunE:  migrateRenumber,
+	}
+	migrateRepairCmd := &cobra.Command{
+		Use:   "repair",
+		Short: "Inspect which statements of the dirty migration were applied, and resume it or mark it clean",
+		RunE:  migrateRepair,
+	}
+	migrateUnlockCmd := &cobra.Command{
+		Use:   "unlock",
+		Short: "Release the migration lock left by a process that is gone",
+		RunE:  migrateUnlock,
+	}
 	migrateSetCmd := &cobra.Command{
 		Use:   "set V",
 		Short: "Set version V but don't run migration (ignores dirty state)",
 		RunE:  migrateSet,
 	}
 
+	migrateCreateCmd.Flags().Bool(flagTimestamp, false, "Use the current UTC time as the version instead of the next sequential number")
 	migrateUpCmd.Flags().String(flagProtoDescriptorFile, "", "Proto descriptor file to be used with migrations")
+	migrateUpCmd.Flags().Bool(flagAllowOutOfOrder, false, "Also apply migrations older than the database version which have not been applied")
+	migrateUpCmd.Flags().Bool(flagAllowChecksumDrift, false, "Apply migrations even if applied migration files were edited or deleted")
+	migrateUpCmd.Flags().Bool(flagBatchDDL, false, "Apply adjacent DDL migrations by a single schema update operation")
+	migrateUpCmd.Flags().Bool(flagDryRun, false, "Print the migrations to be applied without changing the database")
+	addHookFlags(migrateUpCmd)
+	addHookFlags(migrateApplyPlanCmd)
+	migrateUpCmd.Flags().String(flagEnv, "", "Environment to apply migrations in, skipping the migrations scoped to other environments")
+	migrateStatusCmd.Flags().String(flagEnv, "", "Environment to report the migrations scoped to other environments as skipped")
+	migratePlanCmd.Flags().String(flagEnv, "", "Environment to plan migrations in, skipping the migrations scoped to other environments")
+	migratePlanCmd.Flags().StringP(flagPlanFile, "o", "", "Plan file to be saved (required)")
+	migratePlanCmd.Flags().Bool(flagAllowChecksumDrift, false, "Plan migrations even if applied migration files were edited or deleted")
+	migratePlanCmd.Flags().Bool(flagAllowOutOfOrder, false, "Also plan migrations older than the database version which have not been applied")
+	migrateApplyPlanCmd.Flags().String(flagProtoDescriptorFile, "", "Proto descriptor file to be used with migrations")
+	migrateApplyPlanCmd.Flags().Bool(flagBatchDDL, false, "Apply adjacent DDL migrations by a single schema update operation")
+	migrateApplyPlanCmd.Flags().Bool(flagAllowChecksumDrift, false, "Apply migrations even if applied migration files were edited or deleted")
+	migrateDownCmd.Flags().String(flagProtoDescriptorFile, "", "Proto descriptor file to be used with down migrations")
+	migrateRenumberCmd.Flags().Uint(flagSince, 0, "Version up to which migrations are regarded as applied (default: the database version)")
+	migrateRenumberCmd.Flags().Bool(flagDryRun, false, "Print the renames without renaming files")
+	migrateRepairCmd.Flags().String(flagProtoDescriptorFile, "", "Proto descriptor file to be used with the resumed migration")
+	migrateRepairCmd.Flags().Bool(flagResume, false, "Apply the statements of the dirty migration which have not been applied")
+	migrateRepairCmd.Flags().Bool(flagMarkClean, false, "Clear the dirty flag without applying any statement")
+	migrateRepairCmd.MarkFlagsMutuallyExclusive(flagResume, flagMarkClean)
 
 	migrateCmd.AddCommand(
 		migrateCreateCmd,
 		migrateUpCmd,
+		migratePlanCmd,
+		migrateApplyPlanCmd,
+		migrateDownCmd,
 		migrateVersionCmd,
+		migrateStatusCmd,
+		migrateHistoryCmd,
+		migrateVerifyCmd,
+		migrateRenumberCmd,
+		migrateRepairCmd,
+		migrateUnlockCmd,
 		migrateSetCmd,
 	)
 
 	migrateCmd.PersistentFlags().String(flagNameDirectory, "", "Directory that migration files placed (required)")
 	migrateCmd.PersistentFlags().String(flagMigrationTableName, defaultMigrationTableName, "Name of the migration tracking table")
+	migrateCmd.PersistentFlags().Duration(flagLockWait, spanner.DefaultLockWait, "How long to wait for the migration lock held by another process")
+	migrateCmd.PersistentFlags().Duration(flagLockLease, spanner.DefaultLockLease, "How long the migration lock stays valid without being renewed")
 
 	migrateUpCmd.PersistentFlags().StringVar(&priority, flagPriority, "", "The priority to apply DML (optional)")
+	migrateApplyPlanCmd.PersistentFlags().StringVar(&priority, flagPriority, "", "The priority to apply DML (optional)")
+	migrateDownCmd.PersistentFlags().StringVar(&priority, flagPriority, "", "The priority to apply DML (optional)")
+	migrateRepairCmd.PersistentFlags().StringVar(&priority, flagPriority, "", "The priority to apply DML (optional)")
 }
 
 func migrateCreate(c *cobra.Command, args []string) error {
@@ -98,7 +184,15 @@ func migrateCreate(c *cobra.Command, args []string) error {
 		}
 	}
 
-	filename, err := createMigrationFile(c.Context(), dir, name, 6)
+	var (
+		filename string
+		err      error
+	)
+	if ts, _ := c.Flags().GetBool(flagTimestamp); ts {
+		filename, err = createTimestampMigrationFile(c.Context(), dir, name, time.Now())
+	} else {
+		filename, err = createMigrationFile(c.Context(), dir, name, migrationVersionDigits)
+	}
 	if err != nil {
 		return &Error{
 			cmd: c,
@@ -106,6 +200,11 @@ func migrateCreate(c *cobra.Command, args []string) error {
 		}
 	}
 
+	if jsonOutput() {
+		commandResult.Files = append(commandResult.Files, filename)
+		return nil
+	}
+
 	fmt.Printf("%s is created\n", filename)
 
 	return nil
@@ -121,7 +220,7 @@ func migrateUp(c *cobra.Command, args []string) error {
 		if err != nil {
 			return &Error{
 				cmd: c,
-				err: err,
+				err: invalidInput(err),
 			}
 		}
 		limit = n
@@ -149,15 +248,16 @@ func migrateUp(c *cobra.Command, args []string) error {
 	}
 	defer client.Close()
 
-	if err = client.EnsureMigrationTable(ctx, migrationTableName); err != nil {
+	dir := filepath.Join(c.Flag(flagNameDirectory).Value.String(), migrationsDirName)
+	migrations, err := readMigrations(ctx, c, dir)
+	if err != nil {
 		return &Error{
 			cmd: c,
 			err: err,
 		}
 	}
 
-	dir := filepath.Join(c.Flag(flagNameDirectory).Value.String(), migrationsDirName)
-	migrations, err := spanner.ReadMigrations(ctx, dir)
+	repeatable, err := readRepeatableMigrations(ctx, c, dir)
 	if err != nil {
 		return &Error{
 			cmd: c,
@@ -165,25 +265,79 @@ func migrateUp(c *cobra.Command, args []string) error {
 		}
 	}
 
+	opts := []spanner.MigrationOption{spanner.WithLockOptions(getLockOptions(c)), spanner.WithRepeatableMigrations(repeatable)}
+	if allow, _ := c.Flags().GetBool(flagAllowChecksumDrift); allow {
+		opts = append(opts, spanner.WithAllowChecksumDrift())
+	}
+	if batch, _ := c.Flags().GetBool(flagBatchDDL); batch {
+		opts = append(opts, spanner.WithBatchDDL())
+	}
+	if outOfOrder, _ := c.Flags().GetBool(flagAllowOutOfOrder); outOfOrder {
+		opts = append(opts, spanner.WithAllowOutOfOrder())
+	}
+	opts = append(opts, environmentOptions(c)...)
+	opts = append(opts, hookOptions(c)...)
+
+	if dryRun, _ := c.Flags().GetBool(flagDryRun); dryRun {
+		plan, err := client.PlanMigrations(ctx, migrations, limit, migrationTableName, opts...)
+		if err != nil {
+			return &Error{
+				cmd: c,
+				err: err,
+			}
+		}
+
+		printDryRun(os.Stdout, plan)
+
+		return nil
+	}
+
+	if err = client.EnsureMigrationTable(ctx, migrationTableName); err != nil {
+		return &Error{
+			cmd: c,
+			err: err,
+		}
+	}
+
 	var protoDescriptor []byte
 	protoDescriptorFile := protoDescriptorFilePath(c)
 	if protoDescriptorFile != "" {
 		protoDescriptor, err = fs.ReadFile(ctx, protoDescriptorFile)
 		if err != nil {
 			return &Error{
-				err: err,
+				err: invalidInput(err),
 				cmd: c,
 			}
 		}
 	}
 
-	return client.ExecuteMigrations(ctx, migrations, limit, migrationTableName, priorityType, protoDescriptor)
+	return client.ExecuteMigrations(ctx, migrations, limit, migrationTableName, priorityType, protoDescriptor, opts...)
 }
 
-func migrateVersion(c *cobra.Command, _ []string) error {
+func migratePlan(c *cobra.Command, args []string) error {
 	ctx, cancel := context.WithTimeout(c.Context(), timeout)
 	defer cancel()
 
+	planFile := c.Flag(flagPlanFile).Value.String()
+	if planFile == "" {
+		return &Error{
+			cmd: c,
+			err: invalidInput(errors.New("Plan file is not specified.")),
+		}
+	}
+
+	limit := -1
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return &Error{
+				cmd: c,
+				err: invalidInput(err),
+			}
+		}
+		limit = n
+	}
+
 	migrationTableName, err := getMigrationTableName(c)
 	if err != nil {
 		return &Error{
@@ -198,42 +352,94 @@ func migrateVersion(c *cobra.Command, _ []string) error {
 	}
 	defer client.Close()
 
-	if err = client.EnsureMigrationTable(ctx, migrationTableName); err != nil {
+	dir := filepath.Join(c.Flag(flagNameDirectory).Value.String(), migrationsDirName)
+	migrations, err := readMigrations(ctx, c, dir)
+	if err != nil {
 		return &Error{
 			cmd: c,
 			err: err,
 		}
 	}
 
-	v, _, err := client.GetSchemaMigrationVersion(ctx, migrationTableName)
+	repeatable, err := readRepeatableMigrations(ctx, c, dir)
 	if err != nil {
-		var se *spanner.Error
-		if errors.As(err, &se) && se.Code == spanner.ErrorCodeNoMigration {
-			fmt.Println("No migrations.")
-			return nil
+		return &Error{
+			cmd: c,
+			err: err,
 		}
+	}
+
+	opts := []spanner.MigrationOption{spanner.WithRepeatableMigrations(repeatable)}
+	if allow, _ := c.Flags().GetBool(flagAllowChecksumDrift); allow {
+		opts = append(opts, spanner.WithAllowChecksumDrift())
+	}
+	if outOfOrder, _ := c.Flags().GetBool(flagAllowOutOfOrder); outOfOrder {
+		opts = append(opts, spanner.WithAllowOutOfOrder())
+	}
+	opts = append(opts, environmentOptions(c)...)
+
+	plan, err := client.PlanMigrations(ctx, migrations, limit, migrationTableName, opts...)
+	if err != nil {
 		return &Error{
 			cmd: c,
 			err: err,
 		}
 	}
 
-	fmt.Println(v)
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return &Error{
+			cmd: c,
+			err: err,
+		}
+	}
+
+	if err := os.WriteFile(planFile, append(data, '\n'), 0o664); err != nil {
+		return &Error{
+			cmd: c,
+			err: err,
+		}
+	}
+
+	if jsonOutput() {
+		commandResult.Files = append(commandResult.Files, planFile)
+		return nil
+	}
+
+	printPlan(os.Stdout, plan)
+	fmt.Printf("\nThe plan is saved to %s\n", planFile)
 
 	return nil
 }
 
-func migrateSet(c *cobra.Command, args []string) error {
+func migrateApplyPlan(c *cobra.Command, args []string) error {
 	ctx, cancel := context.WithTimeout(c.Context(), timeout)
 	defer cancel()
 
 	if len(args) == 0 {
 		return &Error{
 			cmd: c,
-			err: errors.New("Parameters are not passed."),
+			err: invalidInput(errors.New("Parameters are not passed.")),
 		}
 	}
-	version, err := strconv.Atoi(args[0])
+
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return &Error{
+			cmd: c,
+			err: invalidInput(err),
+		}
+	}
+
+	plan := &spanner.MigrationPlan{}
+	if err := json.Unmarshal(data, plan); err != nil {
+		return &Error{
+			cmd: c,
+			err: invalidInput(fmt.Errorf("invalid plan file: %w", err)),
+		}
+	}
+
+	priorityType, err := priorityTypeOf(priority)
 	if err != nil {
 		return &Error{
 			cmd: c,
@@ -262,37 +468,879 @@ func migrateSet(c *cobra.Command, args []string) error {
 		}
 	}
 
-	if err := client.SetSchemaMigrationVersion(ctx, uint(version), false, migrationTableName); err != nil {
+	dir := filepath.Join(c.Flag(flagNameDirectory).Value.String(), migrationsDirName)
+	migrations, err := readMigrations(ctx, c, dir)
+	if err != nil {
 		return &Error{
 			cmd: c,
 			err: err,
 		}
 	}
 
-	return nil
+	repeatable, err := readRepeatableMigrations(ctx, c, dir)
+	if err != nil {
+		return &Error{
+			cmd: c,
+			err: err,
+		}
+	}
+
+	var protoDescriptor []byte
+	protoDescriptorFile := protoDescriptorFilePath(c)
+	if protoDescriptorFile != "" {
+		protoDescriptor, err = fs.ReadFile(ctx, protoDescriptorFile)
+		if err != nil {
+			return &Error{
+				err: invalidInput(err),
+				cmd: c,
+			}
+		}
+	}
+
+	opts := []spanner.MigrationOption{spanner.WithLockOptions(getLockOptions(c)), spanner.WithRepeatableMigrations(repeatable)}
+	if allow, _ := c.Flags().GetBool(flagAllowChecksumDrift); allow {
+		opts = append(opts, spanner.WithAllowChecksumDrift())
+	}
+	if batch, _ := c.Flags().GetBool(flagBatchDDL); batch {
+		opts = append(opts, spanner.WithBatchDDL())
+	}
+	opts = append(opts, hookOptions(c)...)
+
+	return client.ApplyMigrationPlan(ctx, plan, migrations, migrationTableName, priorityType, protoDescriptor, opts...)
 }
 
-func createMigrationFile(ctx context.Context, dir string, name string, digits int) (string, error) {
-	if name != "" && !spanner.MigrationNameRegex.MatchString(name) {
-		return "", errors.New("Invalid migration file name.")
+// printDryRun prints the plan of migrate up --dry_run, or sets it to the result with --output json.
+func printDryRun(w io.Writer, plan *spanner.MigrationPlan) {
+	if jsonOutput() {
+		commandResult.Plan = plan
+		return
+	}
+
+	printPlan(w, plan)
+}
+
+func printPlan(w io.Writer, plan *spanner.MigrationPlan) {
+	if plan.SourceVersion == 0 {
+		fmt.Fprintln(w, "Database version: none")
+	} else {
+		fmt.Fprintf(w, "Database version: %d\n", plan.SourceVersion)
+	}
+
+	if len(plan.Migrations) == 0 && len(plan.Repeatable) == 0 {
+		fmt.Fprintln(w, "no change")
+		return
+	}
+
+	for _, m := range plan.Migrations {
+		direction := "up"
+		if m.Skipped {
+			direction = "skip"
+		}
+
+		fmt.Fprintln(w)
+		if m.Name != "" {
+			fmt.Fprintf(w, "%d/%s %s (%s)\n", m.Version, direction, m.Name, m.Kind)
+		} else {
+			fmt.Fprintf(w, "%d/%s (%s)\n", m.Version, direction, m.Kind)
+		}
+		if m.Skipped {
+			continue
+		}
+		for _, stmt := range m.Statements {
+			fmt.Fprintf(w, "%s;\n", stmt)
+		}
+	}
+
+	for _, m := range plan.Repeatable {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "R/up %s (%s)\n", m.Name, m.Kind)
+		for _, stmt := range m.Statements {
+			fmt.Fprintf(w, "%s;\n", stmt)
+		}
+	}
+}
+
+func migrateDown(c *cobra.Command, args []string) error {
+	ctx, cancel := context.WithTimeout(c.Context(), timeout)
+	defer cancel()
+
+	limit := 1
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return &Error{
+				cmd: c,
+				err: invalidInput(err),
+			}
+		}
+		limit = n
 	}
 
-	ms, err := spanner.ReadMigrations(ctx, dir)
+	priorityType, err := priorityTypeOf(priority)
 	if err != nil {
-		return "", err
+		return &Error{
+			cmd: c,
+			err: err,
+		}
 	}
 
-	var v uint = 1
-	if len(ms) > 0 {
-		v = ms[len(ms)-1].Version + 1
+	migrationTableName, err := getMigrationTableName(c)
+	if err != nil {
+		return &Error{
+			cmd: c,
+			err: err,
+		}
 	}
-	vStr := fmt.Sprint(v)
 
-	padding := digits - len(vStr)
-	if padding > 0 {
-		vStr = strings.Repeat("0", padding) + vStr
+	client, err := newSpannerClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err = client.EnsureMigrationTable(ctx, migrationTableName); err != nil {
+		return &Error{
+			cmd: c,
+			err: err,
+		}
+	}
+
+	dir := filepath.Join(c.Flag(flagNameDirectory).Value.String(), migrationsDirName)
+	migrations, err := readMigrations(ctx, c, dir)
+	if err != nil {
+		return &Error{
+			cmd: c,
+			err: err,
+		}
+	}
+
+	var protoDescriptor []byte
+	protoDescriptorFile := protoDescriptorFilePath(c)
+	if protoDescriptorFile != "" {
+		protoDescriptor, err = fs.ReadFile(ctx, protoDescriptorFile)
+		if err != nil {
+			return &Error{
+				err: invalidInput(err),
+				cmd: c,
+			}
+		}
+	}
+
+	return client.RollbackMigrations(ctx, migrations, limit, migrationTableName, priorityType, protoDescriptor, spanner.WithLockOptions(getLockOptions(c)))
+}
+
+func migrateVersion(c *cobra.Command, _ []string) error {
+	ctx, cancel := context.WithTimeout(c.Context(), timeout)
+	defer cancel()
+
+	migrationTableName, err := getMigrationTableName(c)
+	if err != nil {
+		return &Error{
+			cmd: c,
+			err: err,
+		}
+	}
+
+	client, err := newSpannerClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err = client.EnsureMigrationTable(ctx, migrationTableName); err != nil {
+		return &Error{
+			cmd: c,
+			err: err,
+		}
+	}
+
+	v, _, err := client.GetSchemaMigrationVersion(ctx, migrationTableName)
+	if err != nil {
+		var se *spanner.Error
+		if errors.As(err, &se) && se.Code == spanner.ErrorCodeNoMigration {
+			if !jsonOutput() {
+				fmt.Println("No migrations.")
+			}
+			return nil
+		}
+		return &Error{
+			cmd: c,
+			err: err,
+		}
+	}
+
+	if jsonOutput() {
+		commandResult.Version = &v
+		return nil
 	}
 
+	fmt.Println(v)
+
+	return nil
+}
+
+func migrateStatus(c *cobra.Command, _ []string) error {
+	ctx, cancel := context.WithTimeout(c.Context(), timeout)
+	defer cancel()
+
+	migrationTableName, err := getMigrationTableName(c)
+	if err != nil {
+		return &Error{
+			cmd: c,
+			err: err,
+		}
+	}
+
+	client, err := newSpannerClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err = client.EnsureMigrationTable(ctx, migrationTableName); err != nil {
+		return &Error{
+			cmd: c,
+			err: err,
+		}
+	}
+
+	dir := filepath.Join(c.Flag(flagNameDirectory).Value.String(), migrationsDirName)
+	migrations, err := readMigrations(ctx, c, dir)
+	if err != nil {
+		return &Error{
+			cmd: c,
+			err: err,
+		}
+	}
+
+	status, err := client.GetMigrationStatus(ctx, migrations, migrationTableName, environmentOptions(c)...)
+	if err != nil {
+		return &Error{
+			cmd: c,
+			err: err,
+		}
+	}
+
+	return printStatus(os.Stdout, status)
+}
+
+// printStatus prints the migration status, or sets it to the result with --output json.
+func printStatus(w io.Writer, status *spanner.MigrationStatus) error {
+	if jsonOutput() {
+		commandResult.Status = newStatusResult(status)
+		return nil
+	}
+
+	switch {
+	case status.Version == 0:
+		fmt.Fprintln(w, "Database version: none")
+	case status.Dirty:
+		fmt.Fprintf(w, "Database version: %d (dirty)\n", status.Version)
+	default:
+		fmt.Fprintf(w, "Database version: %d\n", status.Version)
+	}
+	fmt.Fprintln(w)
+
+	// The environments are shown only if any migration is scoped to environments.
+	var scoped bool
+	for _, m := range status.Migrations {
+		scoped = scoped || len(m.Envs) > 0
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if scoped {
+		fmt.Fprintln(tw, "VERSION\tNAME\tKIND\tENV\tSTATE")
+	} else {
+		fmt.Fprintln(tw, "VERSION\tNAME\tKIND\tSTATE")
+	}
+	for _, m := range status.Migrations {
+		state := string(m.State)
+		if m.Dirty {
+			state += " (dirty)"
+		}
+		if scoped {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", m.Version, orDash(m.Name), orDash(m.Kind), orDash(strings.Join(m.Envs, ",")), state)
+		} else {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", m.Version, orDash(m.Name), orDash(m.Kind), state)
+		}
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+
+	for _, g := range status.Gaps {
+		if g.First == g.Last {
+			fmt.Fprintf(w, "Gap: version %d is skipped\n", g.First)
+		} else {
+			fmt.Fprintf(w, "Gap: versions %d to %d are skipped\n", g.First, g.Last)
+		}
+	}
+	if n := status.Count(spanner.MigrationStateOutOfOrder); n > 0 {
+		fmt.Fprintf(w, "%d out-of-order migrations are older than the database version and will not be applied.\n", n)
+	}
+	if n := status.Count(spanner.MigrationStateMissing); n > 0 {
+		fmt.Fprintf(w, "%d applied migrations are missing in the migration files.\n", n)
+	}
+	if n := status.Count(spanner.MigrationStateSkipped); n > 0 {
+		fmt.Fprintf(w, "%d migrations are skipped since they are scoped to other environments.\n", n)
+	}
+	fmt.Fprintf(w, "%d pending migrations.\n", status.Count(spanner.MigrationStatePending))
+
+	return nil
+}
+
+func migrateHistory(c *cobra.Command, _ []string) error {
+	ctx, cancel := context.WithTimeout(c.Context(), timeout)
+	defer cancel()
+
+	migrationTableName, err := getMigrationTableName(c)
+	if err != nil {
+		return &Error{
+			cmd: c,
+			err: err,
+		}
+	}
+
+	client, err := newSpannerClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err = client.EnsureMigrationTable(ctx, migrationTableName); err != nil {
+		return &Error{
+			cmd: c,
+			err: err,
+		}
+	}
+
+	history, err := client.GetMigrationHistory(ctx, migrationTableName)
+	if err != nil {
+		return &Error{
+			cmd: c,
+			err: err,
+		}
+	}
+
+	return printHistory(os.Stdout, history)
+}
+
+// printHistory prints the migration history as a table, or sets it to the result with --output json.
+func printHistory(w io.Writer, history []*spanner.MigrationHistory) error {
+	if jsonOutput() {
+		commandResult.History = historyResults(history)
+		return nil
+	}
+
+	if len(history) == 0 {
+		fmt.Fprintln(w, "No migrations.")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tDIRTY\tFILE\tCHECKSUM\tSTARTED AT\tFINISHED AT\tDURATION\tWRENCH VERSION\tAPPLIED BY")
+	for _, h := range history {
+		fmt.Fprintf(tw, "%d\t%t\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			h.Version,
+			h.Dirty,
+			orDash(h.FileName),
+			orDash(shortChecksum(h.Checksum)),
+			orDash(formatTime(h.StartedAt)),
+			orDash(formatTime(h.FinishedAt)),
+			orDash(formatDuration(h.FinishedAt, h.Duration)),
+			orDash(h.WrenchVersion),
+			orDash(h.AppliedBy),
+		)
+	}
+
+	return tw.Flush()
+}
+
+func migrateVerify(c *cobra.Command, _ []string) error {
+	ctx, cancel := context.WithTimeout(c.Context(), timeout)
+	defer cancel()
+
+	migrationTableName, err := getMigrationTableName(c)
+	if err != nil {
+		return &Error{
+			cmd: c,
+			err: err,
+		}
+	}
+
+	client, err := newSpannerClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err = client.EnsureMigrationTable(ctx, migrationTableName); err != nil {
+		return &Error{
+			cmd: c,
+			err: err,
+		}
+	}
+
+	dir := filepath.Join(c.Flag(flagNameDirectory).Value.String(), migrationsDirName)
+	migrations, err := readMigrations(ctx, c, dir)
+	if err != nil {
+		return &Error{
+			cmd: c,
+			err: err,
+		}
+	}
+
+	if err := client.VerifyMigrations(ctx, migrations, migrationTableName); err != nil {
+		return &Error{
+			cmd: c,
+			err: err,
+		}
+	}
+
+	printVerified(os.Stdout)
+
+	return nil
+}
+
+// printVerified tells all the applied migrations are verified. The result without an error tells it with --output json.
+func printVerified(w io.Writer) {
+	if jsonOutput() {
+		return
+	}
+	fmt.Fprintln(w, "All applied migrations match the migration files.")
+}
+
+func migrateSet(c *cobra.Command, args []string) error {
+	ctx, cancel := context.WithTimeout(c.Context(), timeout)
+	defer cancel()
+
+	if len(args) == 0 {
+		return &Error{
+			cmd: c,
+			err: invalidInput(errors.New("Parameters are not passed.")),
+		}
+	}
+	version, err := strconv.Atoi(args[0])
+	if err != nil {
+		return &Error{
+			cmd: c,
+			err: invalidInput(err),
+		}
+	}
+
+	migrationTableName, err := getMigrationTableName(c)
+	if err != nil {
+		return &Error{
+			cmd: c,
+			err: err,
+		}
+	}
+
+	client, err := newSpannerClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err = client.EnsureMigrationTable(ctx, migrationTableName); err != nil {
+		return &Error{
+			cmd: c,
+			err: err,
+		}
+	}
+
+	lock, err := client.AcquireMigrationLock(ctx, migrationTableName, getLockOptions(c))
+	if err != nil {
+		return &Error{
+			cmd: c,
+			err: err,
+		}
+	}
+	defer lock.Release(ctx)
+
+	v := uint(version)
+	if err := client.SetSchemaMigrationVersion(ctx, v, false, migrationTableName); err != nil {
+		return &Error{
+			cmd: c,
+			err: err,
+		}
+	}
+	commandResult.Version = &v
+
+	return nil
+}
+
+func migrateRenumber(c *cobra.Command, _ []string) error {
+	ctx, cancel := context.WithTimeout(c.Context(), timeout)
+	defer cancel()
+
+	dir := filepath.Join(c.Flag(flagNameDirectory).Value.String(), migrationsDirName)
+	files, err := spanner.ListMigrationFiles(ctx, dir)
+	if err != nil {
+		return &Error{
+			cmd: c,
+			err: invalidInput(err),
+		}
+	}
+
+	since, err := c.Flags().GetUint(flagSince)
+	if err != nil {
+		return &Error{
+			cmd: c,
+			err: invalidInput(err),
+		}
+	}
+	if !c.Flags().Changed(flagSince) {
+		since, err = databaseVersion(ctx, c)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := checkAppliedCollisions(files, since); err != nil {
+		return &Error{
+			cmd: c,
+			err: invalidInput(err),
+		}
+	}
+
+	renames := spanner.RenumberMigrations(files, since, migrationVersionDigits)
+	printRenames(os.Stdout, renames)
+	if len(renames) == 0 {
+		return nil
+	}
+
+	if dryRun, _ := c.Flags().GetBool(flagDryRun); dryRun {
+		return nil
+	}
+
+	if err := renameMigrationFiles(dir, renames); err != nil {
+		return &Error{
+			cmd: c,
+			err: err,
+		}
+	}
+
+	return nil
+}
+
+// printRenames prints the renames of the migration files, or sets them to the result with --output json.
+func printRenames(w io.Writer, renames []*spanner.MigrationRename) {
+	if jsonOutput() {
+		commandResult.Renames = renameResults(renames)
+		return
+	}
+
+	if len(renames) == 0 {
+		fmt.Fprintln(w, "no change")
+		return
+	}
+	for _, r := range renames {
+		fmt.Fprintf(w, "%s -> %s\n", r.From, r.To)
+	}
+}
+
+// databaseVersion returns the migration version of the database, or zero if no migration has been applied.
+func databaseVersion(ctx context.Context, c *cobra.Command) (uint, error) {
+	migrationTableName, err := getMigrationTableName(c)
+	if err != nil {
+		return 0, &Error{
+			cmd: c,
+			err: err,
+		}
+	}
+
+	client, err := newSpannerClient(ctx, c)
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+
+	if err = client.EnsureMigrationTable(ctx, migrationTableName); err != nil {
+		return 0, &Error{
+			cmd: c,
+			err: err,
+		}
+	}
+
+	version, _, err := client.GetSchemaMigrationVersion(ctx, migrationTableName)
+	if err != nil {
+		var se *spanner.Error
+		if errors.As(err, &se) && se.Code == spanner.ErrorCodeNoMigration {
+			return 0, nil
+		}
+		return 0, &Error{
+			cmd: c,
+			err: err,
+		}
+	}
+
+	return version, nil
+}
+
+// checkAppliedCollisions returns an error if up migration files up to since collide, which renumber must not rename.
+func checkAppliedCollisions(files []*spanner.MigrationFile, since uint) error {
+	seen := map[uint]string{}
+	for _, f := range files {
+		if f.Down || f.Version > since {
+			continue
+		}
+		if prev, ok := seen[f.Version]; ok {
+			return fmt.Errorf("applied migration files %q and %q have the same version %d, rename one of them by hand", prev, f.FileName, f.Version)
+		}
+		seen[f.Version] = f.FileName
+	}
+	return nil
+}
+
+// renameMigrationFiles renames the migration files in dir. The files are renamed via temporary names,
+// since the new name of a file can be the old name of another file.
+func renameMigrationFiles(dir string, renames []*spanner.MigrationRename) error {
+	from := make(map[string]bool, len(renames))
+	for _, r := range renames {
+		from[r.From] = true
+	}
+	for _, r := range renames {
+		if from[r.To] {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, r.To)); err == nil {
+			return fmt.Errorf("%s already exists", r.To)
+		}
+	}
+
+	const tmpSuffix = ".renumber"
+	for _, r := range renames {
+		if err := os.Rename(filepath.Join(dir, r.From), filepath.Join(dir, r.From+tmpSuffix)); err != nil {
+			return err
+		}
+	}
+	for _, r := range renames {
+		if err := os.Rename(filepath.Join(dir, r.From+tmpSuffix), filepath.Join(dir, r.To)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func migrateRepair(c *cobra.Command, _ []string) error {
+	ctx, cancel := context.WithTimeout(c.Context(), timeout)
+	defer cancel()
+
+	priorityType, err := priorityTypeOf(priority)
+	if err != nil {
+		return &Error{
+			cmd: c,
+			err: err,
+		}
+	}
+
+	migrationTableName, err := getMigrationTableName(c)
+	if err != nil {
+		return &Error{
+			cmd: c,
+			err: err,
+		}
+	}
+
+	client, err := newSpannerClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	opts := []spanner.MigrationOption{spanner.WithLockOptions(getLockOptions(c))}
+
+	if markClean, _ := c.Flags().GetBool(flagMarkClean); markClean {
+		if err := client.MarkDirtyMigrationClean(ctx, migrationTableName, opts...); err != nil {
+			return &Error{
+				cmd: c,
+				err: err,
+			}
+		}
+		return nil
+	}
+
+	dir := filepath.Join(c.Flag(flagNameDirectory).Value.String(), migrationsDirName)
+	migrations, err := readMigrations(ctx, c, dir)
+	if err != nil {
+		return &Error{
+			cmd: c,
+			err: err,
+		}
+	}
+
+	if resume, _ := c.Flags().GetBool(flagResume); resume {
+		var protoDescriptor []byte
+		protoDescriptorFile := protoDescriptorFilePath(c)
+		if protoDescriptorFile != "" {
+			protoDescriptor, err = fs.ReadFile(ctx, protoDescriptorFile)
+			if err != nil {
+				return &Error{
+					err: invalidInput(err),
+					cmd: c,
+				}
+			}
+		}
+
+		if err := client.ResumeDirtyMigration(ctx, migrations, migrationTableName, priorityType, protoDescriptor, opts...); err != nil {
+			return &Error{
+				cmd: c,
+				err: err,
+			}
+		}
+		return nil
+	}
+
+	d, err := client.InspectDirtyMigration(ctx, migrations, migrationTableName)
+	if err != nil {
+		return &Error{
+			cmd: c,
+			err: err,
+		}
+	}
+
+	printDirtyMigration(os.Stdout, d)
+
+	return nil
+}
+
+// printDirtyMigration prints the statements of the dirty migration and how to repair it,
+// or sets them to the result with --output json.
+func printDirtyMigration(w io.Writer, d *spanner.DirtyMigration) {
+	if jsonOutput() {
+		commandResult.DirtyMigration = newDirtyMigrationResult(d)
+		return
+	}
+
+	fmt.Fprintf(w, "Database version: %d (dirty)\n", d.Migration.Version)
+	fmt.Fprintf(w, "Migration: %s (%s)\n", d.Migration.FileName, d.Migration.Kind())
+	fmt.Fprintf(w, "Operation: %s\n\n", orDash(d.Operation))
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tSTATE\tCOMMITTED AT\tSTATEMENT")
+	for i, s := range d.Statements {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", i+1, s.State, orDash(formatTime(s.CommittedAt)), strings.Join(strings.Fields(s.Statement), " "))
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w)
+	from, err := d.ResumeFrom()
+	switch {
+	case err != nil:
+		fmt.Fprintf(w, "The migration cannot be resumed, %s.\nFix the database by hand and run `wrench migrate repair --mark_clean`.\n", err)
+	case from == len(d.Statements):
+		fmt.Fprintln(w, "All the statements have been applied. Run `wrench migrate repair --mark_clean` to clear the dirty flag.")
+	default:
+		fmt.Fprintf(w, "Run `wrench migrate repair --resume` to apply the statements from #%d, or `wrench migrate repair --mark_clean` to clear the dirty flag.\n", from+1)
+	}
+}
+
+func migrateUnlock(c *cobra.Command, _ []string) error {
+	ctx, cancel := context.WithTimeout(c.Context(), timeout)
+	defer cancel()
+
+	migrationTableName, err := getMigrationTableName(c)
+	if err != nil {
+		return &Error{
+			cmd: c,
+			err: err,
+		}
+	}
+
+	client, err := newSpannerClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err := client.ForceReleaseMigrationLock(ctx, migrationTableName); err != nil {
+		return &Error{
+			cmd: c,
+			err: err,
+		}
+	}
+
+	return nil
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func shortChecksum(checksum string) string {
+	if len(checksum) > 12 {
+		return checksum[:12]
+	}
+	return checksum
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func formatDuration(finishedAt time.Time, d time.Duration) string {
+	if finishedAt.IsZero() {
+		return ""
+	}
+	return d.String()
+}
+
+// createMigrationFile creates a migration file versioned next to the existing migrations.
+// The versions are given by the file names, so the templates are not rendered and need no --var.
+func createMigrationFile(ctx context.Context, dir string, name string, digits int) (string, error) {
+	if name != "" && !spanner.MigrationNameRegex.MatchString(name) {
+		return "", invalidInput(errors.New("Invalid migration file name."))
+	}
+
+	versions, err := spanner.MigrationVersions(ctx, dir)
+	if err != nil {
+		return "", err
+	}
+
+	var v uint = 1
+	if len(versions) > 0 {
+		v = versions[len(versions)-1] + 1
+	}
+	vStr := fmt.Sprint(v)
+
+	padding := digits - len(vStr)
+	if padding > 0 {
+		vStr = strings.Repeat("0", padding) + vStr
+	}
+
+	return newMigrationFile(dir, vStr, name)
+}
+
+// createTimestampMigrationFile creates a migration file versioned by now in UTC, so that migrations
+// created in different branches hardly collide.
+func createTimestampMigrationFile(ctx context.Context, dir string, name string, now time.Time) (string, error) {
+	if name != "" && !spanner.MigrationNameRegex.MatchString(name) {
+		return "", invalidInput(errors.New("Invalid migration file name."))
+	}
+
+	versions, err := spanner.MigrationVersions(ctx, dir)
+	if err != nil {
+		return "", err
+	}
+
+	vStr := now.UTC().Format(spanner.MigrationTimestampFormat)
+	for _, v := range versions {
+		if fmt.Sprint(v) == vStr {
+			return "", invalidInput(fmt.Errorf("Migration version %s already exists.", vStr))
+		}
+	}
+
+	return newMigrationFile(dir, vStr, name)
+}
+
+func newMigrationFile(dir string, vStr string, name string) (string, error) {
 	var filename string
 	if name == "" {
 		filename = filepath.Join(dir, fmt.Sprintf("%s.sql", vStr))
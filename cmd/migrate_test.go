@@ -25,8 +25,10 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/cloudspannerecosystem/wrench/cmd"
+	"github.com/cloudspannerecosystem/wrench/pkg/spanner"
 	"github.com/spf13/cobra"
 )
 
@@ -66,6 +68,22 @@ func TestCreateMigrationFile(t *testing.T) {
 		})
 	}
 
+	t.Run("template without vars", func(t *testing.T) {
+		// the versions are given by the file names, so the template is not rendered.
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "000001_seed.sql.tmpl"), []byte("INSERT INTO Foo (ID) VALUES ({{.Vars.id}});"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		filename, err := cmd.CreateMigrationFile(context.Background(), dir, "foo", 6)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := filepath.Join(dir, "000002_foo.sql"); want != filename {
+			t.Errorf("filename want %v, but got %v", want, filename)
+		}
+	})
+
 	t.Run("invalid name", func(t *testing.T) {
 		_, err := cmd.CreateMigrationFile(context.Background(), testdatadir, "あああ", 6)
 		if err.Error() != "Invalid migration file name." {
@@ -74,6 +92,59 @@ func TestCreateMigrationFile(t *testing.T) {
 	})
 }
 
+func TestCreateTimestampMigrationFile(t *testing.T) {
+	testdatadir := filepath.Join("testdata", "migrations")
+	now := time.Date(2026, 10, 17, 18, 30, 0, 0, time.FixedZone("JST", 9*60*60))
+
+	filename, err := cmd.CreateTimestampMigrationFile(context.Background(), testdatadir, "foo", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Remove(filename)
+	}()
+
+	if want := filepath.Join(testdatadir, "20261017093000_foo.sql"); want != filename {
+		t.Errorf("filename want %v, but got %v", want, filename)
+	}
+
+	if _, err := cmd.CreateTimestampMigrationFile(context.Background(), testdatadir, "bar", now); err == nil {
+		t.Error("want error for the colliding version, but got nil")
+	}
+}
+
+func TestRenameMigrationFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"000003_foo.sql", "000004_bar.sql"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the new name of a file is the old name of another file.
+	renames := []*spanner.MigrationRename{
+		{From: "000003_foo.sql", To: "000004_foo.sql"},
+		{From: "000004_bar.sql", To: "000003_bar.sql"},
+	}
+	if err := cmd.RenameMigrationFiles(dir, renames); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range renames {
+		data, err := os.ReadFile(filepath.Join(dir, r.To))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != r.From {
+			t.Errorf("%s want to have the content of %s, but got %s", r.To, r.From, data)
+		}
+	}
+
+	if err := cmd.RenameMigrationFiles(dir, []*spanner.MigrationRename{{From: "000003_bar.sql", To: "000004_foo.sql"}}); err == nil {
+		t.Error("want error for the existing file, but got nil")
+	}
+}
+
 func TestGetMigrationTableName(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -116,6 +187,16 @@ func TestGetMigrationTableName(t *testing.T) {
 			flagValue: "SchemaMigrations` WHERE FALSE UNION ALL SELECT 1, FALSE FROM `SchemaMigrations",
 			wantErr:   true,
 		},
+		{
+			name:      "longest table name",
+			flagValue: strings.Repeat("A", 118),
+			want:      strings.Repeat("A", 118),
+		},
+		{
+			name:      "table name one character too long",
+			flagValue: strings.Repeat("A", 119),
+			wantErr:   true,
+		},
 		{
 			name:      "too long table name",
 			flagValue: strings.Repeat("A", 129),
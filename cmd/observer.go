@@ -0,0 +1,61 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/cloudspannerecosystem/wrench/pkg/spanner"
+)
+
+// textObserver renders the progress of the migrations and the statements applied by the client as text.
+type textObserver struct {
+	w io.Writer
+}
+
+func (o *textObserver) OnEvent(e spanner.Event) {
+	switch e.Type {
+	case spanner.EventMigrationFinished:
+		if e.Repeatable {
+			fmt.Fprintf(o.w, "R/%s %s\n", e.Direction, e.Name)
+			return
+		}
+		o.printMigration(e, string(e.Direction))
+	case spanner.EventMigrationSkipped:
+		o.printMigration(e, "skip")
+	case spanner.EventStepApplied:
+		fmt.Fprintf(o.w, "%d/%s step %d/%d\n", e.Version, e.Direction, e.Step, e.Steps)
+	case spanner.EventTransactionCommitted:
+		fmt.Fprintf(o.w, "transaction %d/%d committed, %d rows affected\n", e.Step, e.Steps, e.RowsAffected)
+	case spanner.EventRunFinished:
+		if e.Err == nil && e.Count == 0 {
+			fmt.Fprintln(o.w, "no change")
+		}
+	}
+}
+
+func (o *textObserver) printMigration(e spanner.Event, direction string) {
+	if e.Name != "" {
+		fmt.Fprintf(o.w, "%d/%s %s\n", e.Version, direction, e.Name)
+	} else {
+		fmt.Fprintf(o.w, "%d/%s\n", e.Version, direction)
+	}
+}
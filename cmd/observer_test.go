@@ -0,0 +1,65 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package cmd_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/cloudspannerecosystem/wrench/cmd"
+	"github.com/cloudspannerecosystem/wrench/pkg/spanner"
+)
+
+func TestTextObserver(t *testing.T) {
+	var buf bytes.Buffer
+	o := cmd.NewTextObserver(&buf)
+
+	events := []spanner.Event{
+		{Type: spanner.EventRunStarted, Direction: spanner.MigrationDirectionUp, Count: 4},
+		{Type: spanner.EventDirtySet, Version: 1},
+		{Type: spanner.EventMigrationStarted, Direction: spanner.MigrationDirectionUp, Version: 1, Name: "create_singers"},
+		{Type: spanner.EventStatementApplied, Statement: "CREATE TABLE Singers (SingerID STRING(36)) PRIMARY KEY(SingerID)"},
+		{Type: spanner.EventMigrationFinished, Direction: spanner.MigrationDirectionUp, Version: 1, Name: "create_singers"},
+		{Type: spanner.EventMigrationSkipped, Direction: spanner.MigrationDirectionUp, Version: 2, Name: "seed"},
+		{Type: spanner.EventStepApplied, Direction: spanner.MigrationDirectionUp, Version: 3, Step: 1, Steps: 2},
+		{Type: spanner.EventTransactionCommitted, Step: 1, Steps: 2, RowsAffected: 10},
+		{Type: spanner.EventMigrationFinished, Direction: spanner.MigrationDirectionUp, Version: 3},
+		{Type: spanner.EventMigrationFinished, Direction: spanner.MigrationDirectionUp, Name: "views", Repeatable: true},
+		{Type: spanner.EventRunFinished, Direction: spanner.MigrationDirectionUp, Count: 4},
+		{Type: spanner.EventRunFinished, Direction: spanner.MigrationDirectionDown},
+		{Type: spanner.EventRunFinished, Direction: spanner.MigrationDirectionDown, Err: errors.New("failed")},
+	}
+	for _, e := range events {
+		o.OnEvent(e)
+	}
+
+	want := `1/up create_singers
+2/skip seed
+3/up step 1/2
+transaction 1/2 committed, 10 rows affected
+3/up
+R/up views
+no change
+`
+	if got := buf.String(); got != want {
+		t.Errorf("want %q, but got %q", want, got)
+	}
+}
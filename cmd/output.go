@@ -0,0 +1,275 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/cloudspannerecosystem/wrench/pkg/spanner"
+)
+
+// commandResult is the result of the executed command, printed by Execute in JSON with --output json.
+var commandResult = &result{}
+
+type result struct {
+	Command      string            `json:"command"`
+	Migrations   []migrationResult `json:"migrations,omitempty"`
+	Statements   []statementResult `json:"statements,omitempty"`
+	RowsAffected *int64            `json:"rows_affected,omitempty"`
+	Operations   []string          `json:"operations,omitempty"`
+	Version      *uint             `json:"version,omitempty"`
+	Files        []string          `json:"files,omitempty"`
+
+	History        []historyResult        `json:"history,omitempty"`
+	Renames        []renameResult         `json:"renames,omitempty"`
+	DirtyMigration *dirtyMigrationResult  `json:"dirty_migration,omitempty"`
+	Status         *statusResult          `json:"status,omitempty"`
+	Plan           *spanner.MigrationPlan `json:"plan,omitempty"`
+
+	Error *errorResult `json:"error,omitempty"`
+}
+
+type migrationResult struct {
+	Version        uint   `json:"version,omitempty"`
+	Name           string `json:"name,omitempty"`
+	Direction      string `json:"direction"`
+	Repeatable     bool   `json:"repeatable,omitempty"`
+	Skipped        bool   `json:"skipped,omitempty"`
+	DurationMillis int64  `json:"duration_millis"`
+}
+
+type statementResult struct {
+	Statement    string `json:"statement"`
+	RowsAffected int64  `json:"rows_affected"`
+}
+
+// historyResult is a migration in the history given by migrate history. The times are in RFC 3339.
+type historyResult struct {
+	Version        uint   `json:"version"`
+	Dirty          bool   `json:"dirty"`
+	FileName       string `json:"file_name,omitempty"`
+	Checksum       string `json:"checksum,omitempty"`
+	StartedAt      string `json:"started_at,omitempty"`
+	FinishedAt     string `json:"finished_at,omitempty"`
+	DurationMillis *int64 `json:"duration_millis,omitempty"`
+	WrenchVersion  string `json:"wrench_version,omitempty"`
+	AppliedBy      string `json:"applied_by,omitempty"`
+}
+
+// renameResult is a migration file renamed by migrate renumber.
+type renameResult struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// dirtyMigrationResult is the dirty migration inspected by migrate repair.
+type dirtyMigrationResult struct {
+	Version    uint                   `json:"version"`
+	FileName   string                 `json:"file_name"`
+	Kind       string                 `json:"kind"`
+	Operation  string                 `json:"operation,omitempty"`
+	Statements []dirtyStatementResult `json:"statements"`
+
+	// ResumeFrom is the 0-based index of the statement which migrate repair --resume applies from,
+	// which equals the number of the statements if all of them have been applied.
+	// ResumeError tells why the migration cannot be resumed instead.
+	ResumeFrom  *int   `json:"resume_from,omitempty"`
+	ResumeError string `json:"resume_error,omitempty"`
+}
+
+type dirtyStatementResult struct {
+	Statement   string `json:"statement"`
+	State       string `json:"state"`
+	CommittedAt string `json:"committed_at,omitempty"`
+}
+
+// statusResult is the migration status given by migrate status, with the number of the migrations in each state.
+type statusResult struct {
+	*spanner.MigrationStatus
+	Pending    int `json:"pending"`
+	OutOfOrder int `json:"out_of_order"`
+	Missing    int `json:"missing"`
+	Skipped    int `json:"skipped"`
+}
+
+type errorResult struct {
+	Message   string                `json:"message"`
+	Code      spanner.ErrorCode     `json:"code,omitempty"`
+	Statement *statementErrorResult `json:"statement,omitempty"`
+}
+
+// statementErrorResult is the statement which failed, with its position in the file if known.
+type statementErrorResult struct {
+	Index     int    `json:"index"`
+	Statement string `json:"statement"`
+	FileName  string `json:"file_name,omitempty"`
+	Line      int    `json:"line,omitempty"`
+	Column    int    `json:"column,omitempty"`
+}
+
+// OnEvent collects the migrations, the statements and the operations applied by the client.
+func (r *result) OnEvent(e spanner.Event) {
+	switch e.Type {
+	case spanner.EventMigrationFinished:
+		r.Migrations = append(r.Migrations, migrationResult{
+			Version:        e.Version,
+			Name:           e.Name,
+			Direction:      string(e.Direction),
+			Repeatable:     e.Repeatable,
+			DurationMillis: e.Duration.Milliseconds(),
+		})
+	case spanner.EventMigrationSkipped:
+		r.Migrations = append(r.Migrations, migrationResult{
+			Version:   e.Version,
+			Name:      e.Name,
+			Direction: string(e.Direction),
+			Skipped:   true,
+		})
+	case spanner.EventStatementApplied:
+		r.Statements = append(r.Statements, statementResult{Statement: e.Statement, RowsAffected: e.RowsAffected})
+	case spanner.EventOperationStarted:
+		r.Operations = append(r.Operations, e.Operation)
+	}
+}
+
+// setError sets err to the result with the code of the spanner.Error wrapped in it if any.
+func (r *result) setError(err error) {
+	if err == nil {
+		return
+	}
+
+	r.Error = &errorResult{Message: err.Error()}
+
+	// The message of Error is only the command name, so the wrapped error describes it instead.
+	var ce *Error
+	if errors.As(err, &ce) && ce.err != nil {
+		r.Error.Message = ce.err.Error()
+	}
+
+	var se *spanner.Error
+	if errors.As(err, &se) {
+		r.Error.Code = se.Code
+	}
+
+	var ste *spanner.StatementError
+	if errors.As(err, &ste) {
+		r.Error.Statement = &statementErrorResult{Index: ste.Index, Statement: ste.Statement}
+		if p := ste.Position; p != nil {
+			r.Error.Statement.FileName = p.FileName
+			r.Error.Statement.Line = p.Line
+			r.Error.Statement.Column = p.Column
+		}
+	}
+}
+
+func historyResults(history []*spanner.MigrationHistory) []historyResult {
+	results := make([]historyResult, 0, len(history))
+	for _, h := range history {
+		r := historyResult{
+			Version:       h.Version,
+			Dirty:         h.Dirty,
+			FileName:      h.FileName,
+			Checksum:      h.Checksum,
+			StartedAt:     formatTime(h.StartedAt),
+			FinishedAt:    formatTime(h.FinishedAt),
+			WrenchVersion: h.WrenchVersion,
+			AppliedBy:     h.AppliedBy,
+		}
+		if !h.FinishedAt.IsZero() {
+			d := h.Duration.Milliseconds()
+			r.DurationMillis = &d
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+func renameResults(renames []*spanner.MigrationRename) []renameResult {
+	results := make([]renameResult, 0, len(renames))
+	for _, r := range renames {
+		results = append(results, renameResult{From: r.From, To: r.To})
+	}
+	return results
+}
+
+func newDirtyMigrationResult(d *spanner.DirtyMigration) *dirtyMigrationResult {
+	r := &dirtyMigrationResult{
+		Version:    d.Migration.Version,
+		FileName:   d.Migration.FileName,
+		Kind:       d.Migration.Kind(),
+		Operation:  d.Operation,
+		Statements: make([]dirtyStatementResult, 0, len(d.Statements)),
+	}
+	for _, s := range d.Statements {
+		r.Statements = append(r.Statements, dirtyStatementResult{
+			Statement:   s.Statement,
+			State:       string(s.State),
+			CommittedAt: formatTime(s.CommittedAt),
+		})
+	}
+
+	if from, err := d.ResumeFrom(); err != nil {
+		r.ResumeError = err.Error()
+	} else {
+		r.ResumeFrom = &from
+	}
+	return r
+}
+
+func newStatusResult(status *spanner.MigrationStatus) *statusResult {
+	return &statusResult{
+		MigrationStatus: status,
+		Pending:         status.Count(spanner.MigrationStatePending),
+		OutOfOrder:      status.Count(spanner.MigrationStateOutOfOrder),
+		Missing:         status.Count(spanner.MigrationStateMissing),
+		Skipped:         status.Count(spanner.MigrationStateSkipped),
+	}
+}
+
+func jsonOutput() bool {
+	return outputFormat == outputJSON
+}
+
+// newObserver returns the observer rendering the progress as text, or collecting it into the result with --output json.
+func newObserver() spanner.Observer {
+	if jsonOutput() {
+		return commandResult
+	}
+	return &textObserver{w: os.Stdout}
+}
+
+// printResult prints the result of the command with --output json.
+func printResult(w io.Writer, command string, err error) error {
+	if !jsonOutput() {
+		return nil
+	}
+	commandResult.Command = command
+	commandResult.setError(err)
+	return writeJSON(w, commandResult)
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
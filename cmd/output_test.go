@@ -0,0 +1,258 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package cmd_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cloudspannerecosystem/wrench/cmd"
+	"github.com/cloudspannerecosystem/wrench/pkg/spanner"
+)
+
+func TestWriteResult(t *testing.T) {
+	events := []spanner.Event{
+		{Type: spanner.EventRunStarted, Direction: spanner.MigrationDirectionUp, Count: 3},
+		{Type: spanner.EventOperationStarted, Operation: "projects/p/instances/i/databases/d/operations/o"},
+		{Type: spanner.EventStatementApplied, Statement: "CREATE TABLE Singers (SingerID STRING(36)) PRIMARY KEY(SingerID)"},
+		{Type: spanner.EventMigrationFinished, Direction: spanner.MigrationDirectionUp, Version: 1, Name: "create_singers", Duration: 1500 * time.Millisecond},
+		{Type: spanner.EventMigrationSkipped, Direction: spanner.MigrationDirectionUp, Version: 2, Name: "seed"},
+		{Type: spanner.EventStatementApplied, Statement: "DELETE FROM Singers WHERE true", RowsAffected: 10},
+		{Type: spanner.EventMigrationFinished, Direction: spanner.MigrationDirectionUp, Name: "views", Repeatable: true},
+		{Type: spanner.EventRunFinished, Direction: spanner.MigrationDirectionUp, Count: 3},
+	}
+	err := fmt.Errorf("version 4: %w", &spanner.Error{Code: spanner.ErrorCodeMigrationHook})
+
+	var buf bytes.Buffer
+	if err := cmd.WriteResult(&buf, "migrate up", events, err); err != nil {
+		t.Fatalf("failed to write the result: %v", err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("failed to unmarshal the result: %v", err)
+	}
+
+	want := map[string]interface{}{
+		"command": "migrate up",
+		"migrations": []interface{}{
+			map[string]interface{}{"version": 1.0, "name": "create_singers", "direction": "up", "duration_millis": 1500.0},
+			map[string]interface{}{"version": 2.0, "name": "seed", "direction": "up", "skipped": true, "duration_millis": 0.0},
+			map[string]interface{}{"name": "views", "direction": "up", "repeatable": true, "duration_millis": 0.0},
+		},
+		"statements": []interface{}{
+			map[string]interface{}{"statement": "CREATE TABLE Singers (SingerID STRING(36)) PRIMARY KEY(SingerID)", "rows_affected": 0.0},
+			map[string]interface{}{"statement": "DELETE FROM Singers WHERE true", "rows_affected": 10.0},
+		},
+		"operations": []interface{}{"projects/p/instances/i/databases/d/operations/o"},
+		"error": map[string]interface{}{
+			"message": err.Error(),
+			"code":    float64(spanner.ErrorCodeMigrationHook),
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, but got %v", want, got)
+	}
+}
+
+func TestWriteResultWithoutError(t *testing.T) {
+	var buf bytes.Buffer
+	if err := cmd.WriteResult(&buf, "drop", nil, nil); err != nil {
+		t.Fatalf("failed to write the result: %v", err)
+	}
+
+	want := `{
+  "command": "drop"
+}
+`
+	if got := buf.String(); got != want {
+		t.Errorf("want %q, but got %q", want, got)
+	}
+}
+
+func TestOutputJSON(t *testing.T) {
+	finishedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := map[string]struct {
+		command string
+		print   func(w io.Writer) error
+		want    map[string]interface{}
+	}{
+		"history": {
+			command: "migrate history",
+			print: func(w io.Writer) error {
+				return cmd.PrintHistory(w, []*spanner.MigrationHistory{
+					{Version: 1, FileName: "000001_create_singers.sql", Checksum: "abc", StartedAt: finishedAt.Add(-time.Second), FinishedAt: finishedAt, Duration: time.Second, AppliedBy: "alice"},
+					{Version: 2, Dirty: true, FileName: "000002.sql"},
+				})
+			},
+			want: map[string]interface{}{
+				"command": "migrate history",
+				"history": []interface{}{
+					map[string]interface{}{
+						"version":         1.0,
+						"dirty":           false,
+						"file_name":       "000001_create_singers.sql",
+						"checksum":        "abc",
+						"started_at":      "2024-01-02T03:04:04Z",
+						"finished_at":     "2024-01-02T03:04:05Z",
+						"duration_millis": 1000.0,
+						"applied_by":      "alice",
+					},
+					map[string]interface{}{"version": 2.0, "dirty": true, "file_name": "000002.sql"},
+				},
+			},
+		},
+		"verify": {
+			command: "migrate verify",
+			print: func(w io.Writer) error {
+				cmd.PrintVerified(w)
+				return nil
+			},
+			want: map[string]interface{}{"command": "migrate verify"},
+		},
+		"renumber": {
+			command: "migrate renumber",
+			print: func(w io.Writer) error {
+				cmd.PrintRenames(w, []*spanner.MigrationRename{{From: "000003_a.sql", To: "000004_a.sql", OldVersion: 3, NewVersion: 4}})
+				return nil
+			},
+			want: map[string]interface{}{
+				"command": "migrate renumber",
+				"renames": []interface{}{map[string]interface{}{"from": "000003_a.sql", "to": "000004_a.sql"}},
+			},
+		},
+		"repair": {
+			command: "migrate repair",
+			print: func(w io.Writer) error {
+				cmd.PrintDirtyMigration(w, &spanner.DirtyMigration{
+					Migration: &spanner.Migration{Version: 3, FileName: "000003.sql", Statements: []string{"CREATE TABLE A (ID INT64) PRIMARY KEY(ID)", "CREATE TABLE B (ID INT64) PRIMARY KEY(ID)"}},
+					Operation: "projects/p/instances/i/databases/d/operations/o",
+					Statements: []*spanner.DirtyStatement{
+						{Statement: "CREATE TABLE A (ID INT64) PRIMARY KEY(ID)", State: spanner.StatementStateApplied, CommittedAt: finishedAt},
+						{Statement: "CREATE TABLE B (ID INT64) PRIMARY KEY(ID)", State: spanner.StatementStateNotApplied},
+					},
+				})
+				return nil
+			},
+			want: map[string]interface{}{
+				"command": "migrate repair",
+				"dirty_migration": map[string]interface{}{
+					"version":   3.0,
+					"file_name": "000003.sql",
+					"kind":      "",
+					"operation": "projects/p/instances/i/databases/d/operations/o",
+					"statements": []interface{}{
+						map[string]interface{}{"statement": "CREATE TABLE A (ID INT64) PRIMARY KEY(ID)", "state": "applied", "committed_at": "2024-01-02T03:04:05Z"},
+						map[string]interface{}{"statement": "CREATE TABLE B (ID INT64) PRIMARY KEY(ID)", "state": "not-applied"},
+					},
+					"resume_from": 1.0,
+				},
+			},
+		},
+		"status": {
+			command: "migrate status",
+			print: func(w io.Writer) error {
+				return cmd.PrintStatus(w, &spanner.MigrationStatus{
+					Version: 2,
+					Migrations: []*spanner.MigrationStatusEntry{
+						{Version: 1, Name: "create_singers", FileName: "000001_create_singers.sql", Kind: "ddl", State: spanner.MigrationStateApplied},
+						{Version: 2, Name: "seed", FileName: "000002_seed.sql", Kind: "dml", State: spanner.MigrationStateApplied},
+						{Version: 3, Name: "create_albums", FileName: "000003_create_albums.sql", Kind: "ddl", State: spanner.MigrationStatePending},
+					},
+				})
+			},
+			want: map[string]interface{}{
+				"command": "migrate status",
+				"status": map[string]interface{}{
+					"version": 2.0,
+					"dirty":   false,
+					"migrations": []interface{}{
+						map[string]interface{}{"version": 1.0, "name": "create_singers", "file_name": "000001_create_singers.sql", "kind": "ddl", "state": "applied", "dirty": false},
+						map[string]interface{}{"version": 2.0, "name": "seed", "file_name": "000002_seed.sql", "kind": "dml", "state": "applied", "dirty": false},
+						map[string]interface{}{"version": 3.0, "name": "create_albums", "file_name": "000003_create_albums.sql", "kind": "ddl", "state": "pending", "dirty": false},
+					},
+					"gaps":         nil,
+					"pending":      1.0,
+					"out_of_order": 0.0,
+					"missing":      0.0,
+					"skipped":      0.0,
+				},
+			},
+		},
+		"dry run": {
+			command: "migrate up",
+			print: func(w io.Writer) error {
+				cmd.PrintDryRun(w, &spanner.MigrationPlan{
+					Database:           "projects/p/instances/i/databases/d",
+					SourceVersion:      1,
+					TargetVersion:      2,
+					MigrationsChecksum: "abc",
+					Migrations: []*spanner.PlannedMigration{
+						{Version: 2, Name: "seed", FileName: "000002_seed.sql", Kind: "dml", Statements: []string{"DELETE FROM Singers WHERE true"}},
+					},
+					Repeatable: []*spanner.PlannedRepeatableMigration{
+						{Name: "views", FileName: "R__views.sql", Kind: "ddl", Checksum: "def", Statements: []string{"CREATE OR REPLACE VIEW V SQL SECURITY INVOKER AS SELECT 1 AS One"}},
+					},
+				})
+				return nil
+			},
+			want: map[string]interface{}{
+				"command": "migrate up",
+				"plan": map[string]interface{}{
+					"database":            "projects/p/instances/i/databases/d",
+					"source_version":      1.0,
+					"target_version":      2.0,
+					"migrations_checksum": "abc",
+					"allow_out_of_order":  false,
+					"migrations": []interface{}{
+						map[string]interface{}{"version": 2.0, "name": "seed", "file_name": "000002_seed.sql", "kind": "dml", "statements": []interface{}{"DELETE FROM Singers WHERE true"}},
+					},
+					"repeatable": []interface{}{
+						map[string]interface{}{"name": "views", "file_name": "R__views.sql", "kind": "ddl", "checksum": "def", "statements": []interface{}{"CREATE OR REPLACE VIEW V SQL SECURITY INVOKER AS SELECT 1 AS One"}},
+					},
+				},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			out, err := cmd.OutputJSON(test.command, test.print)
+			if err != nil {
+				t.Fatalf("failed to print: %v", err)
+			}
+
+			// The whole standard output must be a single JSON value.
+			var got map[string]interface{}
+			if err := json.Unmarshal(out, &got); err != nil {
+				t.Fatalf("standard output is not JSON: %v\n%s", err, out)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("want %v, but got %v", test.want, got)
+			}
+		})
+	}
+}
@@ -24,9 +24,11 @@ import (
 	"io/fs"
 	"os"
 	"runtime/debug"
+	"strings"
 	"time"
 
 	wrenchfs "github.com/cloudspannerecosystem/wrench/internal/fs"
+	"github.com/cloudspannerecosystem/wrench/pkg/spanner"
 	"github.com/spf13/cobra"
 )
 
@@ -44,8 +46,15 @@ var (
 	schemaFile      string
 	credentialsFile string
 	timeout         time.Duration
+	maxMutations    int
+	templateVars    []string
+	outputFormat    string
 )
 
+// commandStarted tells whether the command has started, since cobra returns the errors of the flags
+// and the arguments before it, e.g. an unknown flag or a missing required flag.
+var commandStarted bool
+
 // CustomFileSystemFunc is a function that returns a custom fs.FS.
 // This variable allows customizing what kind of fs.FS should be use in wrench CLI execution.
 // e.g. embed.FS for use.
@@ -54,6 +63,12 @@ var CustomFileSystemFunc func() fs.FS
 var rootCmd = &cobra.Command{
 	Use: "wrench",
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		commandStarted = true
+
+		if _, err := getOutput(cmd); err != nil {
+			return err
+		}
+
 		if CustomFileSystemFunc != nil {
 			ctx := cmd.Context()
 			ctx = wrenchfs.WithContext(ctx, CustomFileSystemFunc())
@@ -65,7 +80,16 @@ var rootCmd = &cobra.Command{
 }
 
 func Execute(ctx context.Context) error {
-	return rootCmd.ExecuteContext(ctx)
+	commandStarted = false
+	c, err := rootCmd.ExecuteContextC(ctx)
+	if err != nil && !commandStarted {
+		err = invalidInput(err)
+	}
+	command := strings.TrimPrefix(c.CommandPath(), rootCmd.Name()+" ")
+	if werr := printResult(os.Stdout, command, err); werr != nil && err == nil {
+		return werr
+	}
+	return err
 }
 
 func init() {
@@ -90,6 +114,9 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&schemaFile, flagNameSchemaFile, "", "Name of schema file (optional. if not set, will use default 'schema.sql' file name)")
 	rootCmd.PersistentFlags().StringVar(&credentialsFile, flagCredentialsFile, "", "Specify Credentials File")
 	rootCmd.PersistentFlags().DurationVar(&timeout, flagTimeout, time.Hour, "Context timeout")
+	rootCmd.PersistentFlags().StringArrayVar(&templateVars, flagVar, nil, "Variable given to the template files (*.sql.tmpl) as {{.Vars.key}}, in the form of key=value (can be specified multiple times)")
+	rootCmd.PersistentFlags().StringVar(&outputFormat, flagOutput, outputText, "Output format, text or json")
+	rootCmd.PersistentFlags().IntVar(&maxMutations, flagMaxMutations, spanner.DefaultMaxMutations, "Limit of the estimated mutations of a transaction, over which INSERT statements of DML are split into multiple transactions")
 
 	rootCmd.Version = versionInfo()
 	rootCmd.SetVersionTemplate(versionTemplate)
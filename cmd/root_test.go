@@ -0,0 +1,48 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package cmd_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cloudspannerecosystem/wrench/cmd"
+)
+
+func TestExecuteInputError(t *testing.T) {
+	tests := map[string][]string{
+		"unknown flag":          {"migrate", "up", "--unknown"},
+		"invalid output format": {"migrate", "up", "--output", "yaml"},
+		"invalid limit":         {"migrate", "up", "foo"},
+		"invalid table name":    {"migrate", "history", "--migration_table_name", "1foo"},
+	}
+
+	for name, args := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := cmd.ExecuteArgs(context.Background(), args)
+
+			var ie *cmd.InputError
+			if !errors.As(err, &ie) {
+				t.Errorf("want input error, but got %v", err)
+			}
+		})
+	}
+}
@@ -23,6 +23,8 @@ import (
 	"context"
 
 	"github.com/spf13/cobra"
+
+	"github.com/cloudspannerecosystem/wrench/pkg/spanner"
 )
 
 var truncateCmd = &cobra.Command{
@@ -33,6 +35,8 @@ var truncateCmd = &cobra.Command{
 
 func init() {
 	truncateCmd.Flags().String(flagMigrationTableName, defaultMigrationTableName, "Name of the migration tracking table to be kept")
+	truncateCmd.Flags().Duration(flagLockWait, spanner.DefaultLockWait, "How long to wait for the migration lock held by another process")
+	truncateCmd.Flags().Duration(flagLockLease, spanner.DefaultLockLease, "How long the migration lock stays valid without being renewed")
 }
 
 func truncate(c *cobra.Command, _ []string) error {
@@ -53,6 +57,15 @@ func truncate(c *cobra.Command, _ []string) error {
 	}
 	defer client.Close()
 
+	lock, err := client.AcquireMigrationLock(ctx, migrationTableName, getLockOptions(c))
+	if err != nil {
+		return &Error{
+			err: err,
+			cmd: c,
+		}
+	}
+	defer lock.Release(ctx)
+
 	err = client.TruncateAllTables(ctx, migrationTableName)
 	if err != nil {
 		return &Error{
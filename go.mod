@@ -11,6 +11,7 @@ require (
 	github.com/spf13/cobra v1.9.1
 	google.golang.org/api v0.222.0
 	google.golang.org/grpc v1.82.1
+	google.golang.org/protobuf v1.36.11
 )
 
 require (
@@ -62,6 +63,5 @@ require (
 	google.golang.org/genproto v0.0.0-20250122153221-138b5a5a4fd4 // indirect
 	google.golang.org/genproto/googleapis/api v0.0.0-20260414002931-afd174a4e478 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20260414002931-afd174a4e478 // indirect
-	google.golang.org/protobuf v1.36.11 // indirect
 	spheric.cloud/xiter v0.0.0-20240904151420-c999f37a46b2 // indirect
 )
@@ -25,12 +25,46 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"slices"
 	"syscall"
 
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
 	"github.com/cloudspannerecosystem/wrench/cmd"
 	"github.com/cloudspannerecosystem/wrench/pkg/spanner"
 )
 
+// The exit codes of wrench, which are documented in README.md and must not be changed.
+const (
+	exitCodeOK = 0
+
+	// exitCodeError is for the errors which fall into none of the others, e.g. a failed migration hook.
+	exitCodeError = 1
+
+	// exitCodeInvalidInput is for the invalid flags, arguments and files, e.g. a migration file which cannot be parsed.
+	// The errors are told by cmd.InputError and spanner.ErrorCodeInvalidInput.
+	exitCodeInvalidInput = 2
+
+	// exitCodeDirty is for the dirty database, which needs to be repaired by hand.
+	exitCodeDirty = 3
+
+	// exitCodeLocked is for the migration lock held by another process, which can be retried later.
+	exitCodeLocked = 4
+
+	// exitCodeDrift is for the applied migration files edited or deleted, or the stale migration plan.
+	exitCodeDrift = 5
+
+	// exitCodeConnection is for the failure to connect to Cloud Spanner, e.g. the wrong credentials.
+	exitCodeConnection = 6
+
+	// exitCodeRejected is for the statements and the requests rejected by Cloud Spanner.
+	exitCodeRejected = 7
+
+	// exitCodeRetryable is for the transient failures of Cloud Spanner, which can be retried as they are.
+	exitCodeRetryable = 8
+)
+
 func main() {
 	execute()
 }
@@ -45,8 +79,88 @@ func execute() {
 func handleError(err error) {
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n\t%s\n", err.Error(), errorDetails(err))
-		os.Exit(1)
+		if excerpt := statementExcerpt(err); excerpt != "" {
+			fmt.Fprintf(os.Stderr, "\n%s\n", excerpt)
+		}
+		os.Exit(exitCode(err))
+	}
+}
+
+// statementExcerpt returns the lines of the file around the statement which failed with err if it is known.
+func statementExcerpt(err error) string {
+	var se *spanner.StatementError
+	if errors.As(err, &se) && se.Position != nil {
+		return se.Position.Excerpt
+	}
+	return ""
+}
+
+// exitCode maps err to the exit code by the spanner.ErrorCode and the gRPC status code wrapped in it.
+func exitCode(err error) int {
+	if err == nil {
+		return exitCodeOK
 	}
+
+	errCodes := errorCodes(err)
+	has := func(codes ...spanner.ErrorCode) bool {
+		return slices.ContainsFunc(errCodes, func(code spanner.ErrorCode) bool {
+			return slices.Contains(codes, code)
+		})
+	}
+
+	switch {
+	case has(spanner.ErrorCodeMigrationNotDirty):
+		return exitCodeInvalidInput
+	case has(spanner.ErrorCodeMigrationVersionDirty, spanner.ErrorCodeRepairMigration):
+		return exitCodeDirty
+	case has(spanner.ErrorCodeMigrationChecksumDrift, spanner.ErrorCodeStaleMigrationPlan):
+		return exitCodeDrift
+	case has(spanner.ErrorCodeMigrationLocked):
+		return exitCodeLocked
+	case has(spanner.ErrorCodeCreateClient, spanner.ErrorCodeCloseClient):
+		return exitCodeConnection
+	}
+
+	switch status.Code(err) {
+	case codes.OK, codes.Unknown:
+	case codes.Aborted, codes.ResourceExhausted, codes.Internal, codes.Unavailable:
+		return exitCodeRetryable
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return exitCodeConnection
+	case codes.Canceled, codes.DeadlineExceeded:
+		return exitCodeError
+	default:
+		return exitCodeRejected
+	}
+
+	var ie *cmd.InputError
+	if errors.As(err, &ie) || has(spanner.ErrorCodeInvalidInput) {
+		return exitCodeInvalidInput
+	}
+
+	return exitCodeError
+}
+
+// errorCodes returns the codes of all the spanner.Error wrapped in err.
+func errorCodes(err error) []spanner.ErrorCode {
+	var codes []spanner.ErrorCode
+
+	if se, ok := err.(*spanner.Error); ok {
+		codes = append(codes, se.Code)
+	}
+
+	switch e := err.(type) {
+	case interface{ Unwrap() error }:
+		if inner := e.Unwrap(); inner != nil {
+			codes = append(codes, errorCodes(inner)...)
+		}
+	case interface{ Unwrap() []error }:
+		for _, inner := range e.Unwrap() {
+			codes = append(codes, errorCodes(inner)...)
+		}
+	}
+
+	return codes
 }
 
 func errorDetails(err error) string {
@@ -57,6 +171,16 @@ func errorDetails(err error) string {
 			return fmt.Sprintf("Failed to connect to Cloud Spanner, %s", se.Error())
 		case spanner.ErrorCodeExecuteMigrations, spanner.ErrorCodeMigrationVersionDirty:
 			return fmt.Sprintf("Failed to execute migration, %s", se.Error())
+		case spanner.ErrorCodeStaleMigrationPlan:
+			return fmt.Sprintf("The plan is stale, make a plan again, %s", se.Error())
+		case spanner.ErrorCodeMigrationChecksumDrift:
+			return fmt.Sprintf("Applied migration files were edited or deleted, %s", se.Error())
+		case spanner.ErrorCodeRepairMigration, spanner.ErrorCodeMigrationNotDirty:
+			return fmt.Sprintf("Failed to repair migration, %s", se.Error())
+		case spanner.ErrorCodeMigrationLocked:
+			return fmt.Sprintf("Another process is migrating the database, %s", se.Error())
+		case spanner.ErrorCodeInvalidInput:
+			return fmt.Sprintf("Invalid input, %s", se.Error())
 		default:
 			return fmt.Sprintf("Failed to execute the operation to Cloud Spanner, %s", se.Error())
 		}
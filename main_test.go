@@ -0,0 +1,170 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cloudspannerecosystem/wrench/cmd"
+	"github.com/cloudspannerecosystem/wrench/pkg/spanner"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := map[string]struct {
+		err  error
+		want int
+	}{
+		"no error": {
+			err:  nil,
+			want: exitCodeOK,
+		},
+		"dirty": {
+			err:  &spanner.Error{Code: spanner.ErrorCodeMigrationVersionDirty},
+			want: exitCodeDirty,
+		},
+		"repair": {
+			err:  fmt.Errorf("version 2: %w", &spanner.Error{Code: spanner.ErrorCodeRepairMigration}),
+			want: exitCodeDirty,
+		},
+		"not dirty": {
+			err:  &spanner.Error{Code: spanner.ErrorCodeMigrationNotDirty},
+			want: exitCodeInvalidInput,
+		},
+		"locked": {
+			err:  &spanner.Error{Code: spanner.ErrorCodeMigrationLocked},
+			want: exitCodeLocked,
+		},
+		"lock permission denied": {
+			err:  fmt.Errorf("%w: %w", &spanner.Error{Code: spanner.ErrorCodeAcquireMigrationLock}, status.Error(codes.PermissionDenied, "permission denied")),
+			want: exitCodeConnection,
+		},
+		"lock unavailable": {
+			err:  fmt.Errorf("%w: %w", &spanner.Error{Code: spanner.ErrorCodeReleaseMigrationLock}, status.Error(codes.Unavailable, "connection refused")),
+			want: exitCodeRetryable,
+		},
+		"lock without status": {
+			err:  fmt.Errorf("%w: %w", &spanner.Error{Code: spanner.ErrorCodeAcquireMigrationLock}, errors.New("lock row is broken")),
+			want: exitCodeError,
+		},
+		"drift": {
+			err:  &spanner.Error{Code: spanner.ErrorCodeMigrationChecksumDrift},
+			want: exitCodeDrift,
+		},
+		"stale plan": {
+			err:  &spanner.Error{Code: spanner.ErrorCodeStaleMigrationPlan},
+			want: exitCodeDrift,
+		},
+		"create client": {
+			err:  &spanner.Error{Code: spanner.ErrorCodeCreateClient},
+			want: exitCodeConnection,
+		},
+		"unavailable": {
+			err:  fmt.Errorf("failed to apply: %w", status.Error(codes.Unavailable, "connection refused")),
+			want: exitCodeRetryable,
+		},
+		"aborted": {
+			err:  fmt.Errorf("%w: %w", &spanner.Error{Code: spanner.ErrorCodeExecuteMigrations}, status.Error(codes.Aborted, "transaction was aborted")),
+			want: exitCodeRetryable,
+		},
+		"resource exhausted": {
+			err:  status.Error(codes.ResourceExhausted, "quota exceeded"),
+			want: exitCodeRetryable,
+		},
+		"internal": {
+			err:  status.Error(codes.Internal, "internal error"),
+			want: exitCodeRetryable,
+		},
+		"permission denied": {
+			err:  status.Error(codes.PermissionDenied, "permission denied"),
+			want: exitCodeConnection,
+		},
+		"canceled": {
+			err:  status.Error(codes.Canceled, "canceled"),
+			want: exitCodeError,
+		},
+		"unauthenticated": {
+			err:  status.Error(codes.Unauthenticated, "invalid credentials"),
+			want: exitCodeConnection,
+		},
+		"rejected": {
+			err:  fmt.Errorf("version 3: %w", status.Error(codes.InvalidArgument, "Syntax error")),
+			want: exitCodeRejected,
+		},
+		"locked and rejected": {
+			err:  errors.Join(&spanner.Error{Code: spanner.ErrorCodeMigrationLocked}, status.Error(codes.FailedPrecondition, "")),
+			want: exitCodeLocked,
+		},
+		"dirty wrapped in another code": {
+			err:  fmt.Errorf("%w: %w", &spanner.Error{Code: spanner.ErrorCodeExecuteMigrations}, &spanner.Error{Code: spanner.ErrorCodeMigrationVersionDirty}),
+			want: exitCodeDirty,
+		},
+		"hook": {
+			err:  &spanner.Error{Code: spanner.ErrorCodeMigrationHook},
+			want: exitCodeError,
+		},
+		"timeout": {
+			err:  fmt.Errorf("failed to read: %w", context.DeadlineExceeded),
+			want: exitCodeError,
+		},
+		"go migration": {
+			err:  fmt.Errorf("%w: %w", &spanner.Error{Code: spanner.ErrorCodeExecuteMigrations}, errors.New("backfill failed")),
+			want: exitCodeError,
+		},
+		"partial commit": {
+			err:  &spanner.Error{Code: spanner.ErrorCodeExecuteMigrations},
+			want: exitCodeError,
+		},
+		"plan file not written": {
+			err:  &os.PathError{Op: "open", Path: "plan.json", Err: os.ErrPermission},
+			want: exitCodeError,
+		},
+		"invalid migration file": {
+			err:  fmt.Errorf("%w: %w", &spanner.Error{Code: spanner.ErrorCodeInvalidInput}, errors.New("syntax error")),
+			want: exitCodeInvalidInput,
+		},
+		"invalid flag": {
+			err:  &cmd.InputError{Err: errors.New("unknown flag: --foo")},
+			want: exitCodeInvalidInput,
+		},
+		"invalid file path": {
+			err:  &cmd.InputError{Err: &os.PathError{Op: "open", Path: "schema.sql", Err: os.ErrNotExist}},
+			want: exitCodeInvalidInput,
+		},
+		"unknown": {
+			err:  errors.New("unknown"),
+			want: exitCodeError,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := exitCode(tt.err); got != tt.want {
+				t.Errorf("want %d, but got %d", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,510 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package schema
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/cloudspannerecosystem/memefish"
+	"github.com/cloudspannerecosystem/memefish/ast"
+	"github.com/cloudspannerecosystem/memefish/token"
+)
+
+// Directly use of memefish is permitted only in this file.
+
+// ddlKeywords are the first keywords of the DDL statements. The other statements, e.g. DML or BEGIN and COMMIT
+// of a migration file, are skipped since they do not change the schema.
+var ddlKeywords = []string{"CREATE", "ALTER", "DROP", "RENAME"}
+
+// Parse returns the catalog of the schema defined by the DDL statements in data, e.g. schema.sql.
+// filename is used for the positions of the errors.
+func Parse(filename string, data []byte) (*Catalog, error) {
+	c := NewCatalog()
+	if err := c.ApplyFile(filename, data); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ApplyFile applies the DDL statements in data, e.g. a migration file, to the catalog in order.
+// The error tells the position of the failed statement in the file, and the statements before it have been applied.
+func (c *Catalog) ApplyFile(filename string, data []byte) error {
+	rawStmts, err := memefish.SplitRawStatements(filename, string(data))
+	if err != nil {
+		return err
+	}
+
+	file := &token.File{FilePath: filename, Buffer: string(data)}
+	for i, rawStmt := range rawStmts {
+		pos, ok := ddlPos(rawStmt.Statement)
+		if !ok {
+			continue
+		}
+		if err := c.apply(rawStmt.Statement); err != nil {
+			p := file.Position(rawStmt.Pos+pos, rawStmt.Pos+pos)
+			return fmt.Errorf("statement #%d at %s:%d:%d: %w", i+1, filename, p.Line+1, p.Column+1, err)
+		}
+	}
+	return nil
+}
+
+// Apply applies the statements to the catalog in order, e.g. the statements of a migration.
+// The statements which are not DDL are skipped.
+func (c *Catalog) Apply(statements ...string) error {
+	for i, statement := range statements {
+		if _, ok := ddlPos(statement); !ok {
+			continue
+		}
+		if err := c.apply(statement); err != nil {
+			return fmt.Errorf("statement #%d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// Applied reports whether the effect of the DDL statement is found in the catalog, e.g. the table created by it exists.
+// known is false if it cannot be told from the names of the objects, e.g. for ALTER COLUMN or CREATE OR REPLACE VIEW.
+func (c *Catalog) Applied(statement string) (applied bool, known bool) {
+	ddl, err := memefish.ParseDDL("", statement)
+	if err != nil {
+		return false, false
+	}
+
+	switch d := ddl.(type) {
+	case *ast.CreateTable:
+		return c.Table(pathName(d.Name)) != nil, true
+	case *ast.CreateIndex:
+		return c.Index(pathName(d.Name)) != nil, true
+	case *ast.CreateSearchIndex:
+		return c.Index(d.Name.Name) != nil, true
+	case *ast.CreateView:
+		if d.OrReplace {
+			return false, false
+		}
+		return c.View(pathName(d.Name)) != nil, true
+	case *ast.CreateChangeStream:
+		return c.ChangeStream(d.Name.Name) != nil, true
+	case *ast.CreateSequence:
+		return c.Sequence(pathName(d.Name)) != nil, true
+	case *ast.DropTable:
+		return c.Table(pathName(d.Name)) == nil, true
+	case *ast.DropIndex:
+		return c.Index(pathName(d.Name)) == nil, true
+	case *ast.DropSearchIndex:
+		return c.Index(d.Name.Name) == nil, true
+	case *ast.DropView:
+		return c.View(pathName(d.Name)) == nil, true
+	case *ast.DropChangeStream:
+		return c.ChangeStream(d.Name.Name) == nil, true
+	case *ast.DropSequence:
+		return c.Sequence(pathName(d.Name)) == nil, true
+	case *ast.AlterTable:
+		t := c.Table(pathName(d.Name))
+		switch a := d.TableAlteration.(type) {
+		case *ast.AddColumn:
+			return t != nil && t.Column(a.Column.Name.Name) != nil, true
+		case *ast.DropColumn:
+			return t == nil || t.Column(a.Name.Name) == nil, true
+		}
+	}
+	return false, false
+}
+
+// ddlPos returns the position of the first token of statement, and whether statement is a DDL statement.
+func ddlPos(statement string) (token.Pos, bool) {
+	lex := &memefish.Lexer{File: &token.File{Buffer: statement}}
+	if err := lex.NextToken(); err != nil {
+		return 0, false
+	}
+	return lex.Token.Pos, slices.ContainsFunc(ddlKeywords, func(k string) bool { return strings.EqualFold(lex.Token.Raw, k) })
+}
+
+// apply applies a DDL statement to the catalog.
+// The statements which do not define the objects in the catalog, e.g. GRANT or ALTER DATABASE, are ignored.
+func (c *Catalog) apply(statement string) error {
+	ddl, err := memefish.ParseDDL("", statement)
+	if err != nil {
+		return err
+	}
+
+	switch d := ddl.(type) {
+	case *ast.CreateTable:
+		return c.createTable(newTable(d), d.IfNotExists)
+	case *ast.DropTable:
+		return c.dropTable(pathName(d.Name), d.IfExists)
+	case *ast.RenameTable:
+		for _, to := range d.Tos {
+			if err := c.renameTable(to.Old.Name, to.New.Name); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *ast.AlterTable:
+		return c.alterTable(pathName(d.Name), d.TableAlteration)
+	case *ast.CreateIndex:
+		idx := &Index{
+			Name:         pathName(d.Name),
+			Table:        pathName(d.TableName),
+			Kind:         IndexKindSecondary,
+			Keys:         keyParts(d.Keys),
+			Unique:       d.Unique,
+			NullFiltered: d.NullFiltered,
+			Storing:      storing(d.Storing),
+		}
+		if d.InterleaveIn != nil {
+			idx.Interleave = d.InterleaveIn.TableName.Name
+		}
+		return c.createIndex(idx, d.IfNotExists)
+	case *ast.CreateSearchIndex:
+		idx := &Index{
+			Name:    d.Name.Name,
+			Table:   d.TableName.Name,
+			Kind:    IndexKindSearch,
+			Storing: storing(d.Storing),
+		}
+		for _, col := range d.TokenListPart {
+			idx.Keys = append(idx.Keys, &KeyPart{Column: col.Name})
+		}
+		if d.Interleave != nil {
+			idx.Interleave = d.Interleave.TableName.Name
+		}
+		return c.createIndex(idx, false)
+	case *ast.CreateVectorIndex:
+		return c.createIndex(&Index{
+			Name:    d.Name.Name,
+			Table:   d.TableName.Name,
+			Kind:    IndexKindVector,
+			Keys:    []*KeyPart{{Column: d.ColumnName.Name}},
+			Storing: storing(d.Storing),
+		}, d.IfNotExists)
+	case *ast.DropIndex:
+		return c.dropIndex(pathName(d.Name), IndexKindSecondary, d.IfExists)
+	case *ast.DropSearchIndex:
+		return c.dropIndex(d.Name.Name, IndexKindSearch, d.IfExists)
+	case *ast.DropVectorIndex:
+		return c.dropIndex(d.Name.Name, IndexKindVector, d.IfExists)
+	case *ast.AlterIndex:
+		return c.alterIndex(pathName(d.Name), d.IndexAlteration)
+	case *ast.AlterSearchIndex:
+		return c.alterIndex(d.Name.Name, d.IndexAlteration)
+	case *ast.AlterVectorIndex:
+		return c.alterIndex(pathName(d.Name), d.Alteration)
+	case *ast.CreateView:
+		return c.createView(&View{
+			Name:         pathName(d.Name),
+			SecurityType: string(d.SecurityType),
+			Query:        d.Query.SQL(),
+		}, d.OrReplace)
+	case *ast.DropView:
+		return c.dropView(pathName(d.Name))
+	case *ast.CreateChangeStream:
+		s := &ChangeStream{Name: d.Name.Name}
+		setChangeStreamFor(s, d.For)
+		return c.createChangeStream(s)
+	case *ast.AlterChangeStream:
+		return c.alterChangeStream(d.Name.Name, d.ChangeStreamAlteration)
+	case *ast.DropChangeStream:
+		return c.dropChangeStream(d.Name.Name)
+	case *ast.CreateSequence:
+		return c.createSequence(&Sequence{Name: pathName(d.Name)}, d.IfNotExists)
+	case *ast.DropSequence:
+		return c.dropSequence(pathName(d.Name), d.IfExists)
+	case *ast.CreateProtoBundle:
+		return c.createProtoBundle(protoTypes(d.Types))
+	case *ast.AlterProtoBundle:
+		var insert, update, del []string
+		if d.Insert != nil {
+			insert = protoTypes(d.Insert.Types)
+		}
+		if d.Update != nil {
+			update = protoTypes(d.Update.Types)
+		}
+		if d.Delete != nil {
+			del = protoTypes(d.Delete.Types)
+		}
+		return c.alterProtoBundle(insert, update, del)
+	case *ast.DropProtoBundle:
+		return c.dropProtoBundle()
+	case *ast.CreateSchema:
+		return c.createSchema(d.Name.Name)
+	case *ast.DropSchema:
+		return c.dropSchema(d.Name.Name)
+	}
+	return nil
+}
+
+func newTable(d *ast.CreateTable) *Table {
+	t := &Table{
+		Name:       pathName(d.Name),
+		PrimaryKey: keyParts(d.PrimaryKeys),
+	}
+	for _, def := range d.Columns {
+		t.Columns = append(t.Columns, newColumn(def))
+		if def.PrimaryKey {
+			t.PrimaryKey = append(t.PrimaryKey, &KeyPart{Column: def.Name.Name})
+		}
+	}
+	for _, tc := range d.TableConstraints {
+		fk, check := newConstraint(tc)
+		if fk != nil {
+			t.ForeignKeys = append(t.ForeignKeys, fk)
+		} else {
+			t.Checks = append(t.Checks, check)
+		}
+	}
+	for _, s := range d.Synonyms {
+		t.Synonyms = append(t.Synonyms, s.Name.Name)
+	}
+	if d.Cluster != nil {
+		t.Interleave = &Interleave{
+			Parent:   pathName(d.Cluster.TableName),
+			InParent: d.Cluster.Enforced,
+			OnDelete: onDelete(d.Cluster.OnDelete),
+		}
+	}
+	if d.RowDeletionPolicy != nil {
+		t.RowDeletionPolicy = rowDeletionPolicy(d.RowDeletionPolicy.RowDeletionPolicy)
+	}
+	return t
+}
+
+func newColumn(def *ast.ColumnDef) *Column {
+	col := &Column{
+		Name:    def.Name.Name,
+		Type:    def.Type.SQL(),
+		NotNull: def.NotNull,
+		Hidden:  !def.Hidden.Invalid(),
+	}
+	switch s := def.DefaultSemantics.(type) {
+	case *ast.ColumnDefaultExpr:
+		col.Default = s.Expr.SQL()
+	case *ast.GeneratedColumnExpr:
+		col.Generated = s.Expr.SQL()
+		col.Stored = !s.Stored.Invalid()
+	case *ast.IdentityColumn, *ast.AutoIncrement:
+		col.Identity = true
+	}
+	return col
+}
+
+// newConstraint returns either a foreign key or a check constraint.
+func newConstraint(tc *ast.TableConstraint) (*ForeignKey, *Check) {
+	var name string
+	if tc.Name != nil {
+		name = tc.Name.Name
+	}
+
+	switch c := tc.Constraint.(type) {
+	case *ast.ForeignKey:
+		return &ForeignKey{
+			Name:             name,
+			Columns:          identNames(c.Columns),
+			ReferenceTable:   pathName(c.ReferenceTable),
+			ReferenceColumns: identNames(c.ReferenceColumns),
+			OnDelete:         onDelete(c.OnDelete),
+			NotEnforced:      c.Enforcement == ast.NotEnforced,
+		}, nil
+	case *ast.Check:
+		return nil, &Check{Name: name, Expr: c.Expr.SQL()}
+	}
+	return nil, &Check{Name: name}
+}
+
+func (c *Catalog) alterTable(name string, alteration ast.TableAlteration) error {
+	t, err := c.table(name)
+	if err != nil {
+		return err
+	}
+
+	switch a := alteration.(type) {
+	case *ast.AddColumn:
+		return c.addColumn(t, newColumn(a.Column), a.IfNotExists)
+	case *ast.DropColumn:
+		return c.dropColumn(t, a.Name.Name)
+	case *ast.AlterColumn:
+		col, err := c.column(t, a.Name.Name)
+		if err != nil {
+			return err
+		}
+		switch ca := a.Alteration.(type) {
+		case *ast.AlterColumnType:
+			col.Type = ca.Type.SQL()
+			col.NotNull = ca.NotNull
+			col.Default = ""
+			if ca.DefaultExpr != nil {
+				col.Default = ca.DefaultExpr.Expr.SQL()
+			}
+		case *ast.AlterColumnSetDefault:
+			col.Default = ca.DefaultExpr.Expr.SQL()
+		case *ast.AlterColumnDropDefault:
+			col.Default = ""
+		}
+		return nil
+	case *ast.AddTableConstraint:
+		fk, check := newConstraint(a.TableConstraint)
+		return c.addConstraint(t, fk, check)
+	case *ast.DropConstraint:
+		return c.dropConstraint(t, a.Name.Name)
+	case *ast.SetOnDelete:
+		if t.Interleave == nil {
+			return fmt.Errorf("table %s is not interleaved", t.Name)
+		}
+		t.Interleave.OnDelete = onDelete(a.OnDelete)
+		return nil
+	case *ast.SetInterleaveIn:
+		parent := pathName(a.TableName)
+		if err := c.checkInterleave(t, parent); err != nil {
+			return err
+		}
+		t.Interleave = &Interleave{Parent: parent, InParent: a.Enforced, OnDelete: onDelete(a.OnDelete)}
+		return nil
+	case *ast.AddSynonym:
+		return c.addSynonym(t, a.Name.Name)
+	case *ast.DropSynonym:
+		return c.dropSynonym(t, a.Name.Name)
+	case *ast.RenameTo:
+		if err := c.renameTable(t.Name, a.Name.Name); err != nil {
+			return err
+		}
+		if a.AddSynonym != nil {
+			return c.addSynonym(t, a.AddSynonym.Name.Name)
+		}
+		return nil
+	case *ast.AddRowDeletionPolicy:
+		if t.RowDeletionPolicy != "" {
+			return fmt.Errorf("table %s already has row deletion policy", t.Name)
+		}
+		t.RowDeletionPolicy = rowDeletionPolicy(a.RowDeletionPolicy)
+		return nil
+	case *ast.ReplaceRowDeletionPolicy:
+		if t.RowDeletionPolicy == "" {
+			return fmt.Errorf("table %s does not have row deletion policy", t.Name)
+		}
+		t.RowDeletionPolicy = rowDeletionPolicy(a.RowDeletionPolicy)
+		return nil
+	case *ast.DropRowDeletionPolicy:
+		if t.RowDeletionPolicy == "" {
+			return fmt.Errorf("table %s does not have row deletion policy", t.Name)
+		}
+		t.RowDeletionPolicy = ""
+		return nil
+	}
+	return nil
+}
+
+// alterIndex alters the stored columns of a secondary index, a search index or a vector index.
+func (c *Catalog) alterIndex(name string, alteration ast.Node) error {
+	idx, err := c.index(name)
+	if err != nil {
+		return err
+	}
+
+	switch a := alteration.(type) {
+	case *ast.AddStoredColumn:
+		return c.addStoredColumn(idx, a.Name.Name)
+	case *ast.DropStoredColumn:
+		return c.dropStoredColumn(idx, a.Name.Name)
+	}
+	return nil
+}
+
+func (c *Catalog) alterChangeStream(name string, alteration ast.ChangeStreamAlteration) error {
+	s, err := c.changeStream(name)
+	if err != nil {
+		return err
+	}
+
+	switch a := alteration.(type) {
+	case *ast.ChangeStreamSetFor:
+		altered := &ChangeStream{Name: s.Name}
+		setChangeStreamFor(altered, a.For)
+		if err := c.checkChangeStreamTables(altered); err != nil {
+			return err
+		}
+		*s = *altered
+	case *ast.ChangeStreamDropForAll:
+		s.All = false
+		s.Tables = nil
+	}
+	return nil
+}
+
+func setChangeStreamFor(s *ChangeStream, f ast.ChangeStreamFor) {
+	switch f := f.(type) {
+	case *ast.ChangeStreamForAll:
+		s.All = true
+	case *ast.ChangeStreamForTables:
+		for _, t := range f.Tables {
+			s.Tables = append(s.Tables, &ChangeStreamTable{Table: t.TableName.Name, Columns: identNames(t.Columns)})
+		}
+	}
+}
+
+func keyParts(keys []*ast.IndexKey) []*KeyPart {
+	parts := make([]*KeyPart, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, &KeyPart{Column: k.Name.Name, Desc: k.Dir == ast.DirectionDesc})
+	}
+	return parts
+}
+
+func storing(s *ast.Storing) []string {
+	if s == nil {
+		return nil
+	}
+	return identNames(s.Columns)
+}
+
+func protoTypes(types *ast.ProtoBundleTypes) []string {
+	names := make([]string, 0, len(types.Types))
+	for _, typ := range types.Types {
+		names = append(names, joinIdents(typ.Path))
+	}
+	return names
+}
+
+// onDelete returns CASCADE or NO ACTION of action, or empty if it is not given.
+func onDelete(action ast.OnDeleteAction) string {
+	return strings.TrimPrefix(string(action), "ON DELETE ")
+}
+
+func rowDeletionPolicy(p *ast.RowDeletionPolicy) string {
+	return fmt.Sprintf("OLDER_THAN(%s, INTERVAL %s DAY)", p.ColumnName.Name, p.NumDays.Value)
+}
+
+// pathName returns the name of the object in a named schema qualified by the schema name, e.g. sch.Singers.
+// The case of the name is preserved, since the lookups of the catalog are case insensitive.
+func pathName(p *ast.Path) string {
+	return joinIdents(p.Idents)
+}
+
+func joinIdents(idents []*ast.Ident) string {
+	return strings.Join(identNames(idents), ".")
+}
+
+func identNames(idents []*ast.Ident) []string {
+	names := make([]string, 0, len(idents))
+	for _, ident := range idents {
+		names = append(names, ident.Name)
+	}
+	return names
+}
@@ -0,0 +1,806 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package schema provides the catalog of the schema objects of a Cloud Spanner database built from DDL statements,
+// e.g. schema.sql and migration files, without the database. It is for the tasks which need to understand the schema
+// offline, e.g. diffing, linting, validation and documentation.
+package schema
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Catalog is the schema objects of a database. Every kind of the objects is kept in the order they are created.
+// The names of the objects in a named schema are qualified by the schema name, e.g. sch.Singers.
+type Catalog struct {
+	Tables        []*Table
+	Indexes       []*Index
+	Views         []*View
+	ChangeStreams []*ChangeStream
+	Sequences     []*Sequence
+	Schemas       []*NamedSchema
+
+	// ProtoBundle is the proto bundle of the database, which is nil if it is not created.
+	ProtoBundle *ProtoBundle
+}
+
+// Table is a table and its constraints.
+type Table struct {
+	Name       string
+	Columns    []*Column
+	PrimaryKey []*KeyPart
+
+	// Interleave is the parent table which the table is interleaved in, which is nil for a top-level table.
+	Interleave *Interleave
+
+	ForeignKeys []*ForeignKey
+	Checks      []*Check
+	Synonyms    []string
+
+	// RowDeletionPolicy is the expression of the row deletion policy, e.g. OLDER_THAN(CreatedAt, INTERVAL 30 DAY),
+	// which is empty if it is not set.
+	RowDeletionPolicy string
+}
+
+// Column is a column of a table.
+type Column struct {
+	Name string
+
+	// Type is the type in DDL, e.g. STRING(MAX) or ARRAY<INT64>.
+	Type string
+
+	NotNull bool
+
+	// Default is the expression of the default value, and Generated is the one of the generated column.
+	// They are empty if not set.
+	Default   string
+	Generated string
+
+	// Stored tells the generated column is stored.
+	Stored bool
+
+	// Identity tells the column is an identity column, or an AUTO_INCREMENT column.
+	Identity bool
+
+	Hidden bool
+}
+
+// KeyPart is a column of a primary key or an index key.
+type KeyPart struct {
+	Column string
+	Desc   bool
+}
+
+// Interleave is the parent table of an interleaved table.
+type Interleave struct {
+	Parent string
+
+	// InParent tells the table is interleaved by INTERLEAVE IN PARENT, which requires the parent row to exist,
+	// rather than by INTERLEAVE IN.
+	InParent bool
+
+	// OnDelete is either CASCADE or NO ACTION, which is empty if it is not given.
+	OnDelete string
+}
+
+// ForeignKey is a foreign key constraint of a table.
+type ForeignKey struct {
+	// Name is the name of the constraint, which is empty if it is not named.
+	Name string
+
+	Columns          []string
+	ReferenceTable   string
+	ReferenceColumns []string
+
+	// OnDelete is either CASCADE or NO ACTION, which is empty if it is not given.
+	OnDelete string
+
+	// NotEnforced tells the foreign key is declared as NOT ENFORCED.
+	NotEnforced bool
+}
+
+// Check is a check constraint of a table.
+type Check struct {
+	// Name is the name of the constraint, which is empty if it is not named.
+	Name string
+	Expr string
+}
+
+// IndexKind is the kind of an index.
+type IndexKind string
+
+const (
+	IndexKindSecondary IndexKind = "SECONDARY"
+	IndexKindSearch    IndexKind = "SEARCH"
+	IndexKindVector    IndexKind = "VECTOR"
+)
+
+// Index is a secondary index, a search index or a vector index of a table.
+type Index struct {
+	Name  string
+	Table string
+	Kind  IndexKind
+
+	// Keys are the key columns of a secondary index, the token list columns of a search index,
+	// or the embedding column of a vector index.
+	Keys []*KeyPart
+
+	Unique       bool
+	NullFiltered bool
+	Storing      []string
+
+	// Interleave is the table which the index is interleaved in, which is empty if it is not interleaved.
+	Interleave string
+}
+
+// View is a view.
+type View struct {
+	Name string
+
+	// SecurityType is either INVOKER or DEFINER.
+	SecurityType string
+
+	Query string
+}
+
+// ChangeStream is a change stream.
+type ChangeStream struct {
+	Name string
+
+	// All tells the change stream watches all the tables by FOR ALL.
+	All bool
+
+	Tables []*ChangeStreamTable
+}
+
+// ChangeStreamTable is a table watched by a change stream.
+type ChangeStreamTable struct {
+	Table string
+
+	// Columns are the watched columns, which are empty if all the columns are watched.
+	Columns []string
+}
+
+// Sequence is a sequence.
+type Sequence struct {
+	Name string
+}
+
+// ProtoBundle is the proto bundle of a database.
+type ProtoBundle struct {
+	// Types are the fully qualified names of the proto messages and enums, e.g. examples.music.SingerInfo.
+	Types []string
+}
+
+// NamedSchema is a named schema, which qualifies the names of the objects in it.
+type NamedSchema struct {
+	Name string
+}
+
+// NewCatalog returns the empty catalog of a new database.
+func NewCatalog() *Catalog {
+	return &Catalog{}
+}
+
+// Table returns the table named name, or nil if it does not exist. The name is case insensitive, and can be a synonym.
+func (c *Catalog) Table(name string) *Table {
+	if i := indexOf(c.Tables, name); i >= 0 {
+		return c.Tables[i]
+	}
+	for _, t := range c.Tables {
+		if slices.ContainsFunc(t.Synonyms, func(s string) bool { return strings.EqualFold(s, name) }) {
+			return t
+		}
+	}
+	return nil
+}
+
+// Index returns the index named name, or nil if it does not exist.
+func (c *Catalog) Index(name string) *Index {
+	return find(c.Indexes, name)
+}
+
+// View returns the view named name, or nil if it does not exist.
+func (c *Catalog) View(name string) *View {
+	return find(c.Views, name)
+}
+
+// ChangeStream returns the change stream named name, or nil if it does not exist.
+func (c *Catalog) ChangeStream(name string) *ChangeStream {
+	return find(c.ChangeStreams, name)
+}
+
+// Sequence returns the sequence named name, or nil if it does not exist.
+func (c *Catalog) Sequence(name string) *Sequence {
+	return find(c.Sequences, name)
+}
+
+// Schema returns the named schema named name, or nil if it does not exist.
+func (c *Catalog) Schema(name string) *NamedSchema {
+	return find(c.Schemas, name)
+}
+
+// TableIndexes returns the indexes of the table named table.
+func (c *Catalog) TableIndexes(table string) []*Index {
+	var indexes []*Index
+	for _, idx := range c.Indexes {
+		if strings.EqualFold(idx.Table, table) {
+			indexes = append(indexes, idx)
+		}
+	}
+	return indexes
+}
+
+// InterleavedTables returns the tables interleaved in the table named parent.
+func (c *Catalog) InterleavedTables(parent string) []*Table {
+	var tables []*Table
+	for _, t := range c.Tables {
+		if t.Interleave != nil && strings.EqualFold(t.Interleave.Parent, parent) {
+			tables = append(tables, t)
+		}
+	}
+	return tables
+}
+
+// Column returns the column named name, or nil if it does not exist.
+func (t *Table) Column(name string) *Column {
+	return find(t.Columns, name)
+}
+
+// IsKey reports whether the column named name is a part of the primary key.
+func (t *Table) IsKey(name string) bool {
+	return slices.ContainsFunc(t.PrimaryKey, func(k *KeyPart) bool { return strings.EqualFold(k.Column, name) })
+}
+
+func (t *Table) objectName() string        { return t.Name }
+func (c *Column) objectName() string       { return c.Name }
+func (i *Index) objectName() string        { return i.Name }
+func (v *View) objectName() string         { return v.Name }
+func (s *ChangeStream) objectName() string { return s.Name }
+func (s *Sequence) objectName() string     { return s.Name }
+func (s *NamedSchema) objectName() string  { return s.Name }
+
+type object interface {
+	objectName() string
+}
+
+// indexOf returns the index of the object named name in objects, or -1. Cloud Spanner names are case insensitive.
+func indexOf[T object](objects []T, name string) int {
+	return slices.IndexFunc(objects, func(o T) bool { return strings.EqualFold(o.objectName(), name) })
+}
+
+func find[T object](objects []T, name string) T {
+	var zero T
+	if i := indexOf(objects, name); i >= 0 {
+		return objects[i]
+	}
+	return zero
+}
+
+func remove[T object](objects []T, name string) []T {
+	return slices.DeleteFunc(objects, func(o T) bool { return strings.EqualFold(o.objectName(), name) })
+}
+
+func containsFold(names []string, name string) bool {
+	return slices.ContainsFunc(names, func(n string) bool { return strings.EqualFold(n, name) })
+}
+
+func removeFold(names []string, name string) []string {
+	return slices.DeleteFunc(names, func(n string) bool { return strings.EqualFold(n, name) })
+}
+
+func (c *Catalog) createTable(t *Table, ifNotExists bool) error {
+	if c.Table(t.Name) != nil || c.View(t.Name) != nil {
+		if ifNotExists {
+			return nil
+		}
+		return fmt.Errorf("table %s already exists", t.Name)
+	}
+	if err := c.checkSchema(t.Name); err != nil {
+		return err
+	}
+
+	for _, k := range t.PrimaryKey {
+		if t.Column(k.Column) == nil {
+			return fmt.Errorf("key column %s is not found in table %s", k.Column, t.Name)
+		}
+	}
+	if t.Interleave != nil {
+		if err := c.checkInterleave(t, t.Interleave.Parent); err != nil {
+			return err
+		}
+	}
+	for _, fk := range t.ForeignKeys {
+		if err := c.checkForeignKey(t, fk); err != nil {
+			return err
+		}
+	}
+
+	c.Tables = append(c.Tables, t)
+	return nil
+}
+
+// checkInterleave checks the primary key of t is prefixed by the one of the parent table.
+func (c *Catalog) checkInterleave(t *Table, parent string) error {
+	p := c.Table(parent)
+	if p == nil {
+		return fmt.Errorf("parent table %s of table %s is not found", parent, t.Name)
+	}
+	if len(p.PrimaryKey) > len(t.PrimaryKey) {
+		return fmt.Errorf("table %s does not have the primary key of parent table %s", t.Name, p.Name)
+	}
+	for i, k := range p.PrimaryKey {
+		if !strings.EqualFold(k.Column, t.PrimaryKey[i].Column) {
+			return fmt.Errorf("table %s does not have the primary key of parent table %s", t.Name, p.Name)
+		}
+	}
+	return nil
+}
+
+func (c *Catalog) checkForeignKey(t *Table, fk *ForeignKey) error {
+	for _, col := range fk.Columns {
+		if t.Column(col) == nil {
+			return fmt.Errorf("column %s of foreign key is not found in table %s", col, t.Name)
+		}
+	}
+
+	ref := t
+	if !strings.EqualFold(fk.ReferenceTable, t.Name) {
+		ref = c.Table(fk.ReferenceTable)
+	}
+	if ref == nil {
+		return fmt.Errorf("referenced table %s of table %s is not found", fk.ReferenceTable, t.Name)
+	}
+	for _, col := range fk.ReferenceColumns {
+		if ref.Column(col) == nil {
+			return fmt.Errorf("referenced column %s is not found in table %s", col, ref.Name)
+		}
+	}
+	return nil
+}
+
+// checkSchema checks the named schema which qualifies name exists if any.
+func (c *Catalog) checkSchema(name string) error {
+	schema, _, ok := strings.Cut(name, ".")
+	if ok && c.Schema(schema) == nil {
+		return fmt.Errorf("schema %s of %s is not found", schema, name)
+	}
+	return nil
+}
+
+func (c *Catalog) dropTable(name string, ifExists bool) error {
+	t := c.Table(name)
+	if t == nil {
+		if ifExists {
+			return nil
+		}
+		return fmt.Errorf("table %s is not found", name)
+	}
+
+	if children := c.InterleavedTables(t.Name); len(children) > 0 {
+		return fmt.Errorf("table %s has interleaved table %s", t.Name, children[0].Name)
+	}
+	if indexes := c.TableIndexes(t.Name); len(indexes) > 0 {
+		return fmt.Errorf("table %s has index %s", t.Name, indexes[0].Name)
+	}
+	for _, other := range c.Tables {
+		if other == t {
+			continue
+		}
+		for _, fk := range other.ForeignKeys {
+			if strings.EqualFold(fk.ReferenceTable, t.Name) {
+				return fmt.Errorf("table %s is referenced by foreign key of table %s", t.Name, other.Name)
+			}
+		}
+	}
+
+	c.Tables = remove(c.Tables, t.Name)
+	return nil
+}
+
+// renameTable renames the table old to name, and the references to it.
+func (c *Catalog) renameTable(old, name string) error {
+	t := c.Table(old)
+	if t == nil {
+		return fmt.Errorf("table %s is not found", old)
+	}
+	if other := c.Table(name); other != nil && other != t {
+		return fmt.Errorf("table %s already exists", name)
+	}
+
+	from := t.Name
+	t.Name = name
+	t.Synonyms = removeFold(t.Synonyms, name)
+
+	for _, other := range c.Tables {
+		if other.Interleave != nil && strings.EqualFold(other.Interleave.Parent, from) {
+			other.Interleave.Parent = name
+		}
+		for _, fk := range other.ForeignKeys {
+			if strings.EqualFold(fk.ReferenceTable, from) {
+				fk.ReferenceTable = name
+			}
+		}
+	}
+	for _, idx := range c.Indexes {
+		if strings.EqualFold(idx.Table, from) {
+			idx.Table = name
+		}
+		if strings.EqualFold(idx.Interleave, from) {
+			idx.Interleave = name
+		}
+	}
+	for _, s := range c.ChangeStreams {
+		for _, st := range s.Tables {
+			if strings.EqualFold(st.Table, from) {
+				st.Table = name
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Catalog) table(name string) (*Table, error) {
+	t := c.Table(name)
+	if t == nil {
+		return nil, fmt.Errorf("table %s is not found", name)
+	}
+	return t, nil
+}
+
+func (c *Catalog) addColumn(t *Table, col *Column, ifNotExists bool) error {
+	if t.Column(col.Name) != nil {
+		if ifNotExists {
+			return nil
+		}
+		return fmt.Errorf("column %s already exists in table %s", col.Name, t.Name)
+	}
+	t.Columns = append(t.Columns, col)
+	return nil
+}
+
+func (c *Catalog) dropColumn(t *Table, name string) error {
+	col := t.Column(name)
+	if col == nil {
+		return fmt.Errorf("column %s is not found in table %s", name, t.Name)
+	}
+	if t.IsKey(name) {
+		return fmt.Errorf("column %s is a key column of table %s", col.Name, t.Name)
+	}
+	for _, idx := range c.TableIndexes(t.Name) {
+		if slices.ContainsFunc(idx.Keys, func(k *KeyPart) bool { return strings.EqualFold(k.Column, name) }) || containsFold(idx.Storing, name) {
+			return fmt.Errorf("column %s of table %s is used by index %s", col.Name, t.Name, idx.Name)
+		}
+	}
+	for _, fk := range t.ForeignKeys {
+		if containsFold(fk.Columns, name) {
+			return fmt.Errorf("column %s of table %s is used by foreign key %s", col.Name, t.Name, fk.Name)
+		}
+	}
+
+	t.Columns = remove(t.Columns, col.Name)
+	return nil
+}
+
+func (c *Catalog) column(t *Table, name string) (*Column, error) {
+	col := t.Column(name)
+	if col == nil {
+		return nil, fmt.Errorf("column %s is not found in table %s", name, t.Name)
+	}
+	return col, nil
+}
+
+func (c *Catalog) addConstraint(t *Table, fk *ForeignKey, check *Check) error {
+	name := ""
+	if fk != nil {
+		name = fk.Name
+	} else {
+		name = check.Name
+	}
+	if name != "" && t.hasConstraint(name) {
+		return fmt.Errorf("constraint %s already exists in table %s", name, t.Name)
+	}
+
+	if fk != nil {
+		if err := c.checkForeignKey(t, fk); err != nil {
+			return err
+		}
+		t.ForeignKeys = append(t.ForeignKeys, fk)
+	} else {
+		t.Checks = append(t.Checks, check)
+	}
+	return nil
+}
+
+func (t *Table) hasConstraint(name string) bool {
+	return slices.ContainsFunc(t.ForeignKeys, func(fk *ForeignKey) bool { return strings.EqualFold(fk.Name, name) }) ||
+		slices.ContainsFunc(t.Checks, func(ck *Check) bool { return strings.EqualFold(ck.Name, name) })
+}
+
+func (c *Catalog) dropConstraint(t *Table, name string) error {
+	if !t.hasConstraint(name) {
+		return fmt.Errorf("constraint %s is not found in table %s", name, t.Name)
+	}
+	t.ForeignKeys = slices.DeleteFunc(t.ForeignKeys, func(fk *ForeignKey) bool { return strings.EqualFold(fk.Name, name) })
+	t.Checks = slices.DeleteFunc(t.Checks, func(ck *Check) bool { return strings.EqualFold(ck.Name, name) })
+	return nil
+}
+
+func (c *Catalog) addSynonym(t *Table, name string) error {
+	if c.Table(name) != nil {
+		return fmt.Errorf("table %s already exists", name)
+	}
+	t.Synonyms = append(t.Synonyms, name)
+	return nil
+}
+
+func (c *Catalog) dropSynonym(t *Table, name string) error {
+	if !containsFold(t.Synonyms, name) {
+		return fmt.Errorf("synonym %s is not found in table %s", name, t.Name)
+	}
+	t.Synonyms = removeFold(t.Synonyms, name)
+	return nil
+}
+
+func (c *Catalog) createIndex(idx *Index, ifNotExists bool) error {
+	if c.Index(idx.Name) != nil {
+		if ifNotExists {
+			return nil
+		}
+		return fmt.Errorf("index %s already exists", idx.Name)
+	}
+	if err := c.checkSchema(idx.Name); err != nil {
+		return err
+	}
+
+	t, err := c.table(idx.Table)
+	if err != nil {
+		return err
+	}
+	idx.Table = t.Name
+	for _, k := range idx.Keys {
+		if t.Column(k.Column) == nil {
+			return fmt.Errorf("column %s of index %s is not found in table %s", k.Column, idx.Name, t.Name)
+		}
+	}
+	for _, col := range idx.Storing {
+		if t.Column(col) == nil {
+			return fmt.Errorf("stored column %s of index %s is not found in table %s", col, idx.Name, t.Name)
+		}
+	}
+	if idx.Interleave != "" && c.Table(idx.Interleave) == nil {
+		return fmt.Errorf("table %s which index %s is interleaved in is not found", idx.Interleave, idx.Name)
+	}
+
+	c.Indexes = append(c.Indexes, idx)
+	return nil
+}
+
+func (c *Catalog) dropIndex(name string, kind IndexKind, ifExists bool) error {
+	idx := c.Index(name)
+	if idx == nil || idx.Kind != kind {
+		if ifExists {
+			return nil
+		}
+		return fmt.Errorf("%s index %s is not found", strings.ToLower(string(kind)), name)
+	}
+	c.Indexes = remove(c.Indexes, idx.Name)
+	return nil
+}
+
+func (c *Catalog) index(name string) (*Index, error) {
+	idx := c.Index(name)
+	if idx == nil {
+		return nil, fmt.Errorf("index %s is not found", name)
+	}
+	return idx, nil
+}
+
+func (c *Catalog) addStoredColumn(idx *Index, name string) error {
+	t, err := c.table(idx.Table)
+	if err != nil {
+		return err
+	}
+	if t.Column(name) == nil {
+		return fmt.Errorf("stored column %s of index %s is not found in table %s", name, idx.Name, t.Name)
+	}
+	if containsFold(idx.Storing, name) {
+		return fmt.Errorf("column %s is already stored in index %s", name, idx.Name)
+	}
+	idx.Storing = append(idx.Storing, name)
+	return nil
+}
+
+func (c *Catalog) dropStoredColumn(idx *Index, name string) error {
+	if !containsFold(idx.Storing, name) {
+		return fmt.Errorf("column %s is not stored in index %s", name, idx.Name)
+	}
+	idx.Storing = removeFold(idx.Storing, name)
+	return nil
+}
+
+func (c *Catalog) createView(v *View, orReplace bool) error {
+	if i := indexOf(c.Views, v.Name); i >= 0 {
+		if !orReplace {
+			return fmt.Errorf("view %s already exists", v.Name)
+		}
+		c.Views[i] = v
+		return nil
+	}
+	if c.Table(v.Name) != nil {
+		return fmt.Errorf("table %s already exists", v.Name)
+	}
+	if err := c.checkSchema(v.Name); err != nil {
+		return err
+	}
+	c.Views = append(c.Views, v)
+	return nil
+}
+
+func (c *Catalog) dropView(name string) error {
+	if c.View(name) == nil {
+		return fmt.Errorf("view %s is not found", name)
+	}
+	c.Views = remove(c.Views, name)
+	return nil
+}
+
+func (c *Catalog) createChangeStream(s *ChangeStream) error {
+	if c.ChangeStream(s.Name) != nil {
+		return fmt.Errorf("change stream %s already exists", s.Name)
+	}
+	if err := c.checkChangeStreamTables(s); err != nil {
+		return err
+	}
+	c.ChangeStreams = append(c.ChangeStreams, s)
+	return nil
+}
+
+func (c *Catalog) checkChangeStreamTables(s *ChangeStream) error {
+	for _, st := range s.Tables {
+		t := c.Table(st.Table)
+		if t == nil {
+			return fmt.Errorf("table %s watched by change stream %s is not found", st.Table, s.Name)
+		}
+		for _, col := range st.Columns {
+			if t.Column(col) == nil {
+				return fmt.Errorf("column %s watched by change stream %s is not found in table %s", col, s.Name, t.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Catalog) changeStream(name string) (*ChangeStream, error) {
+	s := c.ChangeStream(name)
+	if s == nil {
+		return nil, fmt.Errorf("change stream %s is not found", name)
+	}
+	return s, nil
+}
+
+func (c *Catalog) dropChangeStream(name string) error {
+	if _, err := c.changeStream(name); err != nil {
+		return err
+	}
+	c.ChangeStreams = remove(c.ChangeStreams, name)
+	return nil
+}
+
+func (c *Catalog) createSequence(s *Sequence, ifNotExists bool) error {
+	if c.Sequence(s.Name) != nil {
+		if ifNotExists {
+			return nil
+		}
+		return fmt.Errorf("sequence %s already exists", s.Name)
+	}
+	if err := c.checkSchema(s.Name); err != nil {
+		return err
+	}
+	c.Sequences = append(c.Sequences, s)
+	return nil
+}
+
+func (c *Catalog) dropSequence(name string, ifExists bool) error {
+	if c.Sequence(name) == nil {
+		if ifExists {
+			return nil
+		}
+		return fmt.Errorf("sequence %s is not found", name)
+	}
+	c.Sequences = remove(c.Sequences, name)
+	return nil
+}
+
+func (c *Catalog) createProtoBundle(types []string) error {
+	if c.ProtoBundle != nil {
+		return fmt.Errorf("proto bundle already exists")
+	}
+	c.ProtoBundle = &ProtoBundle{Types: types}
+	return nil
+}
+
+// alterProtoBundle inserts, updates and deletes the types of the proto bundle. Updating a type does not change the catalog.
+func (c *Catalog) alterProtoBundle(insert, update, del []string) error {
+	b := c.ProtoBundle
+	if b == nil {
+		return fmt.Errorf("proto bundle is not found")
+	}
+	for _, typ := range insert {
+		if slices.Contains(b.Types, typ) {
+			return fmt.Errorf("proto type %s already exists in proto bundle", typ)
+		}
+		b.Types = append(b.Types, typ)
+	}
+	for _, typ := range slices.Concat(update, del) {
+		if !slices.Contains(b.Types, typ) {
+			return fmt.Errorf("proto type %s is not found in proto bundle", typ)
+		}
+	}
+	b.Types = slices.DeleteFunc(b.Types, func(typ string) bool { return slices.Contains(del, typ) })
+	return nil
+}
+
+func (c *Catalog) dropProtoBundle() error {
+	if c.ProtoBundle == nil {
+		return fmt.Errorf("proto bundle is not found")
+	}
+	c.ProtoBundle = nil
+	return nil
+}
+
+func (c *Catalog) createSchema(name string) error {
+	if c.Schema(name) != nil {
+		return fmt.Errorf("schema %s already exists", name)
+	}
+	c.Schemas = append(c.Schemas, &NamedSchema{Name: name})
+	return nil
+}
+
+// dropSchema drops the named schema, which must have no objects in it.
+func (c *Catalog) dropSchema(name string) error {
+	s := c.Schema(name)
+	if s == nil {
+		return fmt.Errorf("schema %s is not found", name)
+	}
+
+	var names []string
+	for _, t := range c.Tables {
+		names = append(names, t.Name)
+	}
+	for _, idx := range c.Indexes {
+		names = append(names, idx.Name)
+	}
+	for _, v := range c.Views {
+		names = append(names, v.Name)
+	}
+	for _, seq := range c.Sequences {
+		names = append(names, seq.Name)
+	}
+	for _, n := range names {
+		if schema, _, ok := strings.Cut(n, "."); ok && strings.EqualFold(schema, s.Name) {
+			return fmt.Errorf("schema %s has %s", s.Name, n)
+		}
+	}
+
+	c.Schemas = remove(c.Schemas, s.Name)
+	return nil
+}
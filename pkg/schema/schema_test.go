@@ -0,0 +1,349 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package schema_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cloudspannerecosystem/wrench/pkg/schema"
+)
+
+const schemaSQL = `-- header comment
+CREATE SCHEMA sch;
+
+CREATE PROTO BUNDLE (examples.music.SingerInfo, examples.music.Genre);
+
+CREATE TABLE Singers (
+  SingerID STRING(36) NOT NULL,
+  FirstName STRING(1024),
+  CreatedAt TIMESTAMP NOT NULL DEFAULT (CURRENT_TIMESTAMP()),
+  FullName STRING(MAX) AS (FirstName) STORED,
+  SYNONYM(Artists),
+) PRIMARY KEY(SingerID), ROW DELETION POLICY (OLDER_THAN(CreatedAt, INTERVAL 30 DAY));
+
+CREATE TABLE Albums (
+  SingerID STRING(36) NOT NULL,
+  AlbumID INT64 NOT NULL,
+  Title STRING(MAX),
+  CONSTRAINT CK_Title CHECK (Title != ''),
+) PRIMARY KEY(SingerID, AlbumID DESC), INTERLEAVE IN PARENT Singers ON DELETE CASCADE;
+
+CREATE TABLE Concerts (
+  ConcertID INT64 NOT NULL,
+  SingerID STRING(36) NOT NULL,
+  CONSTRAINT FK_Singer FOREIGN KEY (SingerID) REFERENCES Singers (SingerID),
+) PRIMARY KEY(ConcertID);
+
+CREATE UNIQUE NULL_FILTERED INDEX AlbumsByTitle ON Albums(Title) STORING (AlbumID), INTERLEAVE IN Singers;
+CREATE VIEW SingerNames SQL SECURITY INVOKER AS SELECT Singers.FirstName FROM Singers;
+CREATE CHANGE STREAM SingerStream FOR Singers(FirstName), Albums;
+CREATE SEQUENCE sch.Seq OPTIONS (sequence_kind = 'bit_reversed_positive');
+CREATE TABLE sch.Venues (VenueID INT64 NOT NULL) PRIMARY KEY(VenueID);
+`
+
+func TestParse(t *testing.T) {
+	c, err := schema.Parse("schema.sql", []byte(schemaSQL))
+	if err != nil {
+		t.Fatalf("failed to parse schema: %v", err)
+	}
+
+	var tables []string
+	for _, table := range c.Tables {
+		tables = append(tables, table.Name)
+	}
+	if want := []string{"Singers", "Albums", "Concerts", "sch.Venues"}; !reflect.DeepEqual(tables, want) {
+		t.Errorf("want tables %v, but got %v", want, tables)
+	}
+
+	singers := c.Table("singers")
+	if singers == nil {
+		t.Fatal("table Singers is not found")
+	}
+	if c.Table("Artists") != singers {
+		t.Error("table Singers is not found by synonym Artists")
+	}
+	if want := (&schema.Column{Name: "CreatedAt", Type: "TIMESTAMP", NotNull: true, Default: "CURRENT_TIMESTAMP()"}); !reflect.DeepEqual(singers.Column("CreatedAt"), want) {
+		t.Errorf("want column %+v, but got %+v", want, singers.Column("CreatedAt"))
+	}
+	if want := (&schema.Column{Name: "FullName", Type: "STRING(MAX)", Generated: "FirstName", Stored: true}); !reflect.DeepEqual(singers.Column("FullName"), want) {
+		t.Errorf("want column %+v, but got %+v", want, singers.Column("FullName"))
+	}
+	if want := "OLDER_THAN(CreatedAt, INTERVAL 30 DAY)"; singers.RowDeletionPolicy != want {
+		t.Errorf("want row deletion policy %q, but got %q", want, singers.RowDeletionPolicy)
+	}
+
+	albums := c.Table("Albums")
+	if want := []*schema.KeyPart{{Column: "SingerID"}, {Column: "AlbumID", Desc: true}}; !reflect.DeepEqual(albums.PrimaryKey, want) {
+		t.Errorf("want primary key %+v, but got %+v", want, albums.PrimaryKey)
+	}
+	if want := (&schema.Interleave{Parent: "Singers", InParent: true, OnDelete: "CASCADE"}); !reflect.DeepEqual(albums.Interleave, want) {
+		t.Errorf("want interleave %+v, but got %+v", want, albums.Interleave)
+	}
+	if want := []*schema.Check{{Name: "CK_Title", Expr: "Title != \"\""}}; !reflect.DeepEqual(albums.Checks, want) {
+		t.Errorf("want checks %+v, but got %+v", want, albums.Checks)
+	}
+	if got := c.InterleavedTables("Singers"); len(got) != 1 || got[0] != albums {
+		t.Errorf("want interleaved table Albums, but got %v", got)
+	}
+
+	want := []*schema.ForeignKey{{Name: "FK_Singer", Columns: []string{"SingerID"}, ReferenceTable: "Singers", ReferenceColumns: []string{"SingerID"}}}
+	if got := c.Table("Concerts").ForeignKeys; !reflect.DeepEqual(got, want) {
+		t.Errorf("want foreign keys %+v, but got %+v", want, got)
+	}
+
+	wantIndex := &schema.Index{
+		Name:         "AlbumsByTitle",
+		Table:        "Albums",
+		Kind:         schema.IndexKindSecondary,
+		Keys:         []*schema.KeyPart{{Column: "Title"}},
+		Unique:       true,
+		NullFiltered: true,
+		Storing:      []string{"AlbumID"},
+		Interleave:   "Singers",
+	}
+	if got := c.Index("AlbumsByTitle"); !reflect.DeepEqual(got, wantIndex) {
+		t.Errorf("want index %+v, but got %+v", wantIndex, got)
+	}
+
+	if v := c.View("SingerNames"); v == nil || v.SecurityType != "INVOKER" || v.Query == "" {
+		t.Errorf("unexpected view %+v", v)
+	}
+
+	wantStream := &schema.ChangeStream{
+		Name: "SingerStream",
+		Tables: []*schema.ChangeStreamTable{
+			{Table: "Singers", Columns: []string{"FirstName"}},
+			{Table: "Albums", Columns: []string{}},
+		},
+	}
+	if got := c.ChangeStream("SingerStream"); !reflect.DeepEqual(got, wantStream) {
+		t.Errorf("want change stream %+v, but got %+v", wantStream, got)
+	}
+
+	if c.Sequence("sch.Seq") == nil || c.Schema("sch") == nil {
+		t.Error("sequence sch.Seq or schema sch is not found")
+	}
+	if want := []string{"examples.music.SingerInfo", "examples.music.Genre"}; c.ProtoBundle == nil || !reflect.DeepEqual(c.ProtoBundle.Types, want) {
+		t.Errorf("want proto bundle %v, but got %+v", want, c.ProtoBundle)
+	}
+}
+
+func TestApply(t *testing.T) {
+	c, err := schema.Parse("schema.sql", []byte(schemaSQL))
+	if err != nil {
+		t.Fatalf("failed to parse schema: %v", err)
+	}
+
+	// the statements of migrations, including DML and transaction control which are skipped.
+	err = c.Apply(
+		"ALTER TABLE Singers ADD COLUMN LastName STRING(1024)",
+		"INSERT INTO Singers (SingerID, FirstName) VALUES ('1', 'Marc')",
+		"BEGIN",
+		"UPDATE Singers SET LastName = 'Richards' WHERE TRUE",
+		"COMMIT",
+		"ALTER TABLE Singers ALTER COLUMN FirstName STRING(MAX) NOT NULL",
+		"ALTER TABLE Singers ALTER COLUMN CreatedAt DROP DEFAULT",
+		"ALTER TABLE Singers DROP ROW DELETION POLICY",
+		"ALTER TABLE Albums SET ON DELETE NO ACTION",
+		"ALTER TABLE Albums DROP CONSTRAINT CK_Title",
+		"ALTER INDEX AlbumsByTitle DROP STORED COLUMN AlbumID",
+		"ALTER CHANGE STREAM SingerStream SET FOR ALL",
+		"ALTER PROTO BUNDLE DELETE (examples.music.Genre)",
+		"DROP VIEW SingerNames",
+		"DROP SEQUENCE sch.Seq",
+		"DROP TABLE sch.Venues",
+		"DROP SCHEMA sch",
+		"ALTER TABLE Singers RENAME TO Performers, ADD SYNONYM Singers",
+		"CREATE INDEX IF NOT EXISTS AlbumsByTitle ON Albums(Title)",
+	)
+	if err != nil {
+		t.Fatalf("failed to apply statements: %v", err)
+	}
+
+	performers := c.Table("Performers")
+	if performers == nil || c.Table("Singers") != performers {
+		t.Fatal("table Singers is not renamed to Performers with synonym Singers")
+	}
+	if want := (&schema.Column{Name: "FirstName", Type: "STRING(MAX)", NotNull: true}); !reflect.DeepEqual(performers.Column("FirstName"), want) {
+		t.Errorf("want column %+v, but got %+v", want, performers.Column("FirstName"))
+	}
+	if performers.Column("LastName") == nil || performers.Column("CreatedAt").Default != "" || performers.RowDeletionPolicy != "" {
+		t.Errorf("table Performers is not altered: %+v", performers)
+	}
+
+	albums := c.Table("Albums")
+	if want := (&schema.Interleave{Parent: "Performers", InParent: true, OnDelete: "NO ACTION"}); !reflect.DeepEqual(albums.Interleave, want) {
+		t.Errorf("want interleave %+v, but got %+v", want, albums.Interleave)
+	}
+	if len(albums.Checks) != 0 {
+		t.Errorf("want no checks, but got %+v", albums.Checks)
+	}
+	if got := c.Table("Concerts").ForeignKeys[0].ReferenceTable; got != "Performers" {
+		t.Errorf("want foreign key referencing Performers, but got %s", got)
+	}
+	if idx := c.Index("AlbumsByTitle"); len(idx.Storing) != 0 || idx.Interleave != "Performers" {
+		t.Errorf("index AlbumsByTitle is not altered: %+v", idx)
+	}
+	if s := c.ChangeStream("SingerStream"); !s.All || len(s.Tables) != 0 {
+		t.Errorf("change stream SingerStream is not altered: %+v", s)
+	}
+	if want := []string{"examples.music.SingerInfo"}; !reflect.DeepEqual(c.ProtoBundle.Types, want) {
+		t.Errorf("want proto bundle %v, but got %v", want, c.ProtoBundle.Types)
+	}
+	if len(c.Views) != 0 || len(c.Sequences) != 0 || len(c.Schemas) != 0 || len(c.Tables) != 3 {
+		t.Errorf("objects are not dropped: %+v", c)
+	}
+}
+
+func TestApplyError(t *testing.T) {
+	tests := map[string]struct {
+		statement string
+		want      string
+	}{
+		"syntax error":                 {statement: "CREATE TABLE Foo (", want: "syntax error"},
+		"table already exists":         {statement: "CREATE TABLE Singers (ID INT64) PRIMARY KEY(ID)", want: "table Singers already exists"},
+		"key column not found":         {statement: "CREATE TABLE Foo (ID INT64) PRIMARY KEY(Missing)", want: "key column Missing is not found in table Foo"},
+		"parent key mismatch":          {statement: "CREATE TABLE Foo (ID INT64) PRIMARY KEY(ID), INTERLEAVE IN PARENT Singers", want: "does not have the primary key of parent table Singers"},
+		"schema not found":             {statement: "CREATE TABLE other.Foo (ID INT64) PRIMARY KEY(ID)", want: "schema other of other.Foo is not found"},
+		"drop missing table":           {statement: "DROP TABLE Missing", want: "table Missing is not found"},
+		"drop parent table":            {statement: "DROP TABLE Singers", want: "table Singers has interleaved table Albums"},
+		"drop indexed table":           {statement: "DROP TABLE Albums", want: "table Albums has index AlbumsByTitle"},
+		"drop referencing table":       {statement: "DROP TABLE Concerts", want: ""},
+		"drop key column":              {statement: "ALTER TABLE Albums DROP COLUMN AlbumID", want: "column AlbumID is a key column of table Albums"},
+		"drop indexed column":          {statement: "ALTER TABLE Albums DROP COLUMN Title", want: "column Title of table Albums is used by index AlbumsByTitle"},
+		"alter missing column":         {statement: "ALTER TABLE Singers ALTER COLUMN Missing STRING(MAX)", want: "column Missing is not found in table Singers"},
+		"add existing column":          {statement: "ALTER TABLE Singers ADD COLUMN FirstName STRING(MAX)", want: "column FirstName already exists in table Singers"},
+		"drop missing constraint":      {statement: "ALTER TABLE Singers DROP CONSTRAINT Missing", want: "constraint Missing is not found in table Singers"},
+		"foreign key to missing table": {statement: "ALTER TABLE Concerts ADD FOREIGN KEY (SingerID) REFERENCES Missing (ID)", want: "referenced table Missing of table Concerts is not found"},
+		"drop non-empty schema":        {statement: "DROP SCHEMA sch", want: "schema sch has sch.Venues"},
+		"create existing view":         {statement: "CREATE VIEW SingerNames SQL SECURITY INVOKER AS SELECT 1 AS One", want: "view SingerNames already exists"},
+		"change stream missing column": {statement: "ALTER CHANGE STREAM SingerStream SET FOR Singers(Missing)", want: "column Missing watched by change stream SingerStream is not found in table Singers"},
+		"insert existing proto type":   {statement: "ALTER PROTO BUNDLE INSERT (examples.music.Genre)", want: "proto type examples.music.Genre already exists in proto bundle"},
+		"drop missing search index":    {statement: "DROP SEARCH INDEX AlbumsByTitle", want: "search index AlbumsByTitle is not found"},
+		"drop missing index if exists": {statement: "DROP INDEX IF EXISTS Missing", want: ""},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			c, err := schema.Parse("schema.sql", []byte(schemaSQL))
+			if err != nil {
+				t.Fatalf("failed to parse schema: %v", err)
+			}
+
+			err = c.Apply(test.statement)
+			if test.want == "" {
+				if err != nil {
+					t.Errorf("want no error, but got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("want error containing %q, but got %v", test.want, err)
+			}
+		})
+	}
+}
+
+func TestApplyFileErrorPosition(t *testing.T) {
+	c := schema.NewCatalog()
+	ddl := "-- comment\nCREATE TABLE Foo (ID INT64) PRIMARY KEY(ID);\n\n  DROP TABLE Bar;\n"
+
+	err := c.ApplyFile("000001.sql", []byte(ddl))
+	if want := "statement #2 at 000001.sql:4:3: table Bar is not found"; err == nil || err.Error() != want {
+		t.Errorf("want error %q, but got %v", want, err)
+	}
+	if c.Table("Foo") == nil {
+		t.Error("the statement before the failed one is not applied")
+	}
+}
+
+func TestApplied(t *testing.T) {
+	ddl := []byte(`CREATE TABLE Singers (
+  SingerID STRING(36) NOT NULL,
+  FirstName STRING(1024),
+) PRIMARY KEY(SingerID);
+
+CREATE INDEX SingersByFirstName ON Singers(FirstName);
+
+ALTER TABLE Singers ADD COLUMN LastName STRING(MAX);
+`)
+
+	catalog, err := schema.Parse("schema.sql", ddl)
+	if err != nil {
+		t.Fatalf("failed to parse schema: %v", err)
+	}
+
+	tests := map[string]struct {
+		statement   string
+		wantApplied bool
+		wantKnown   bool
+	}{
+		"created table": {
+			statement:   "CREATE TABLE singers (ID INT64) PRIMARY KEY(ID)",
+			wantApplied: true,
+			wantKnown:   true,
+		},
+		"not created table": {
+			statement: "CREATE TABLE Albums (ID INT64) PRIMARY KEY(ID)",
+			wantKnown: true,
+		},
+		"created index": {
+			statement:   "CREATE INDEX SingersByFirstName ON Singers(FirstName)",
+			wantApplied: true,
+			wantKnown:   true,
+		},
+		"dropped index": {
+			statement:   "DROP INDEX SingersByLastName",
+			wantApplied: true,
+			wantKnown:   true,
+		},
+		"added column": {
+			statement:   "ALTER TABLE Singers ADD COLUMN LastName STRING(MAX)",
+			wantApplied: true,
+			wantKnown:   true,
+		},
+		"not dropped column": {
+			statement: "ALTER TABLE Singers DROP COLUMN FirstName",
+			wantKnown: true,
+		},
+		"replaced view": {
+			statement: "CREATE OR REPLACE VIEW SingerNames SQL SECURITY INVOKER AS SELECT FirstName FROM Singers",
+			wantKnown: false,
+		},
+		"altered column": {
+			statement: "ALTER TABLE Singers ALTER COLUMN LastName STRING(MAX) NOT NULL",
+			wantKnown: false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			applied, known := catalog.Applied(test.statement)
+			if known != test.wantKnown {
+				t.Fatalf("known want %t, but got %t", test.wantKnown, known)
+			}
+			if applied != test.wantApplied {
+				t.Errorf("applied want %t, but got %t", test.wantApplied, applied)
+			}
+		})
+	}
+}
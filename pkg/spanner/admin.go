@@ -64,6 +64,7 @@ func (c *AdminClient) CreateInstance(ctx context.Context, node int32) error {
 			err:  err,
 		}
 	}
+	c.emit(Event{Type: EventOperationStarted, Operation: op.Name()})
 
 	_, err = op.Wait(ctx)
 	if err != nil {
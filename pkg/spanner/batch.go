@@ -0,0 +1,255 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package spanner
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	databasepb "cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// groupMigrations splits sorted migrations into the groups applied at once.
+// Adjacent DDL migrations are grouped if batchDDL is true, and every other migration makes its own group.
+// DDL migrations with directives are not grouped, since they need their own timeout or proto descriptors,
+// nor the ones scoped to environments, which may be skipped, nor the empty ones, which have no commit timestamps.
+func groupMigrations(migrations Migrations, batchDDL bool) []Migrations {
+	batchable := func(m *Migration) bool {
+		return m.kind == statementKindDDL && len(m.Statements) > 0 && m.Directives.IsZero() && !m.IsEnvScoped()
+	}
+
+	var groups []Migrations
+	for _, m := range migrations {
+		if batchDDL && batchable(m) && len(groups) > 0 {
+			last := groups[len(groups)-1]
+			if batchable(last[0]) {
+				groups[len(groups)-1] = append(last, m)
+				continue
+			}
+		}
+		groups = append(groups, Migrations{m})
+	}
+	return groups
+}
+
+// completedMigrations returns the number of migrations in batch whose statements are all committed,
+// given the number of the committed statements of the batch.
+func completedMigrations(batch Migrations, committed int) int {
+	for i, m := range batch {
+		committed -= len(m.Statements)
+		if committed < 0 {
+			return i
+		}
+	}
+	return len(batch)
+}
+
+// migrationFinishedAt returns the commit timestamp of the last statement of a migration in a batch,
+// given the number of the statements committed until the end of the migration.
+// A migration without statements finishes when it starts.
+func migrationFinishedAt(commitTimestamps []*timestamppb.Timestamp, committed int, startedAt time.Time) time.Time {
+	if committed == 0 {
+		return startedAt
+	}
+	return commitTimestamps[committed-1].AsTime()
+}
+
+// applyMigrationBatch applies the DDL migrations in batch by a single schema update operation.
+// The commit timestamps of the statements tell which migrations have completed, so that they are recorded
+// even if the operation fails halfway. It returns the number of the completed migrations.
+func (c *Client) applyMigrationBatch(ctx context.Context, tableName string, batch Migrations, protoDescriptors []byte) (int, error) {
+	startedAt, err := c.startMigration(ctx, tableName, batch[0])
+	if err != nil {
+		return 0, &Error{
+			Code: ErrorCodeExecuteMigrations,
+			err:  err,
+		}
+	}
+
+	for _, m := range batch {
+		c.emit(migrationEvent(EventMigrationStarted, MigrationDirectionUp, m))
+	}
+
+	var statements []string
+	for _, m := range batch {
+		statements = append(statements, m.Statements...)
+	}
+
+	op, err := c.spannerAdminClient.UpdateDatabaseDdl(ctx, &databasepb.UpdateDatabaseDdlRequest{
+		Database:         c.config.URL(),
+		Statements:       statements,
+		ProtoDescriptors: protoDescriptors,
+	})
+	if err != nil {
+		return 0, &Error{
+			Code: ErrorCodeExecuteMigrations,
+			err:  fmt.Errorf("%w, version: %d", &Error{Code: ErrorCodeUpdateDDL, err: err}, batch[0].Version),
+		}
+	}
+	c.emit(Event{Type: EventOperationStarted, Operation: op.Name()})
+
+	opErr := op.Wait(ctx)
+
+	metadata, err := op.Metadata()
+	if err != nil || metadata == nil {
+		// Which statements were committed is unknown, so the first migration is left dirty.
+		if opErr == nil {
+			opErr = fmt.Errorf("failed to get the metadata of the schema update operation: %w", err)
+		}
+		return 0, &Error{
+			Code: ErrorCodeExecuteMigrations,
+			err:  fmt.Errorf("%w, version: %d", &Error{Code: ErrorCodeWaitOperation, err: opErr}, batch[0].Version),
+		}
+	}
+
+	commitTimestamps := metadata.GetCommitTimestamps()
+	n := completedMigrations(batch, len(commitTimestamps))
+	if n == len(batch) {
+		opErr = nil
+	} else if opErr == nil {
+		opErr = fmt.Errorf("only %d of %d statements are committed", len(commitTimestamps), len(statements))
+	}
+
+	if err := c.finishMigrationBatch(ctx, tableName, batch, n, startedAt, commitTimestamps); err != nil {
+		return 0, &Error{
+			Code: ErrorCodeExecuteMigrations,
+			err:  err,
+		}
+	}
+
+	var committed int
+	for _, m := range batch[:n] {
+		committed += len(m.Statements)
+		finishedAt := migrationFinishedAt(commitTimestamps, committed, startedAt)
+
+		e := migrationEvent(EventMigrationFinished, MigrationDirectionUp, m)
+		e.Duration = finishedAt.Sub(startedAt)
+		c.emit(e)
+
+		startedAt = finishedAt
+	}
+
+	if opErr != nil {
+		// The operation stops at the failed statement, which is the first one without the commit timestamp.
+		m := batch[n]
+		opErr = statementError(opErr, m.Statements, len(commitTimestamps)-committed)
+		return n, &Error{
+			Code: ErrorCodeExecuteMigrations,
+			err:  fmt.Errorf("%w, version: %d", &Error{Code: ErrorCodeWaitOperation, err: locateStatement(opErr, m.Statements, m.positions)}, m.Version),
+		}
+	}
+
+	return n, nil
+}
+
+// finishMigrationBatch records the first n migrations of batch as completed at the commit timestamps of their last statements,
+// and leaves the next migration dirty if it exists.
+// The database version is kept at the newest applied version if the batch is applied out of order.
+func (c *Client) finishMigrationBatch(ctx context.Context, tableName string, batch Migrations, n int, startedAt time.Time, commitTimestamps []*timestamppb.Timestamp) error {
+	var m []*spanner.Mutation
+
+	var committed int
+	for _, mig := range batch[:n] {
+		committed += len(mig.Statements)
+		finishedAt := migrationFinishedAt(commitTimestamps, committed, startedAt)
+
+		m = append(m, spanner.InsertOrUpdate(
+			historyTableName(tableName),
+			migrationHistoryColumns,
+			[]interface{}{
+				int64(mig.Version),
+				false,
+				mig.FileName,
+				mig.Checksum(),
+				startedAt,
+				finishedAt,
+				finishedAt.Sub(startedAt).Milliseconds(),
+				c.config.WrenchVersion,
+				c.operator(),
+				spanner.NullInt64{},
+				spanner.NullBool{},
+			},
+		))
+		startedAt = finishedAt
+	}
+
+	var (
+		version uint
+		dirty   bool
+	)
+	if n < len(batch) {
+		mig := batch[n]
+		version, dirty = mig.Version, true
+
+		m = append(m, spanner.InsertOrUpdate(
+			historyTableName(tableName),
+			migrationHistoryColumns,
+			[]interface{}{
+				int64(mig.Version),
+				true,
+				mig.FileName,
+				mig.Checksum(),
+				startedAt,
+				spanner.NullTime{},
+				spanner.NullInt64{},
+				c.config.WrenchVersion,
+				c.operator(),
+				spanner.NullInt64{},
+				spanner.NullBool{},
+			},
+		))
+	}
+
+	_, err := c.spannerClient.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+		// The last migration recorded is the dirty one if any, otherwise the last completed one.
+		latest, err := latestVersion(ctx, tx, tableName, batch[min(n, len(batch)-1)].Version)
+		if err != nil {
+			return err
+		}
+
+		return tx.BufferWrite(append(m,
+			spanner.Delete(tableName, spanner.AllKeys()),
+			spanner.Insert(
+				tableName,
+				[]string{"Version", "Dirty"},
+				[]interface{}{int64(latest), dirty},
+			),
+		))
+	})
+	if err != nil {
+		return &Error{
+			Code: ErrorCodeSetMigrationVersion,
+			err:  err,
+		}
+	}
+
+	// The dirty flag moves from the first migration to the next of the completed ones, if any is completed.
+	if n > 0 {
+		c.emit(Event{Type: EventDirtyCleared, Version: batch[0].Version})
+		if dirty {
+			c.emit(Event{Type: EventDirtySet, Version: version})
+		}
+	}
+
+	return nil
+}
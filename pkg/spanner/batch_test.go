@@ -0,0 +1,133 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package spanner
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestGroupMigrations(t *testing.T) {
+	ddl := []string{"CREATE TABLE T (ID INT64) PRIMARY KEY(ID)"}
+	ddl1 := &Migration{Version: 1, Statements: ddl, kind: statementKindDDL}
+	ddl2 := &Migration{Version: 2, Statements: ddl, kind: statementKindDDL}
+	dml3 := &Migration{Version: 3, kind: statementKindDML}
+	ddl4 := &Migration{Version: 4, Statements: ddl, kind: statementKindDDL}
+	pdml5 := &Migration{Version: 5, kind: statementKindPartitionedDML}
+	ddl6 := &Migration{Version: 6, Statements: ddl, kind: statementKindDDL}
+	ddl7 := &Migration{Version: 7, Statements: ddl, kind: statementKindDDL}
+	ddl8 := &Migration{Version: 8, Statements: ddl, kind: statementKindDDL, Directives: MigrationDirectives{Timeout: time.Hour}}
+	// empty and comment-only files are DDL migrations without statements.
+	empty9 := &Migration{Version: 9, kind: statementKindDDL}
+	ddl10 := &Migration{Version: 10, Statements: ddl, kind: statementKindDDL}
+	ddl11 := &Migration{Version: 11, Statements: ddl, kind: statementKindDDL}
+
+	migrations := Migrations{ddl1, ddl2, dml3, ddl4, pdml5, ddl6, ddl7, ddl8, empty9, ddl10, ddl11}
+
+	tests := map[string]struct {
+		batchDDL bool
+		want     [][]uint
+	}{
+		"batch": {
+			batchDDL: true,
+			want:     [][]uint{{1, 2}, {3}, {4}, {5}, {6, 7}, {8}, {9}, {10, 11}},
+		},
+		"no batch": {
+			batchDDL: false,
+			want:     [][]uint{{1}, {2}, {3}, {4}, {5}, {6}, {7}, {8}, {9}, {10}, {11}},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			groups := groupMigrations(migrations, test.batchDDL)
+
+			if len(groups) != len(test.want) {
+				t.Fatalf("groups length want %d, but got %d", len(test.want), len(groups))
+			}
+			for i, g := range groups {
+				if len(g) != len(test.want[i]) {
+					t.Fatalf("group %d length want %d, but got %d", i, len(test.want[i]), len(g))
+				}
+				for j, m := range g {
+					if m.Version != test.want[i][j] {
+						t.Errorf("group %d want version %d, but got %d", i, test.want[i][j], m.Version)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCompletedMigrations(t *testing.T) {
+	batch := Migrations{
+		{Version: 1, Statements: []string{"a", "b"}},
+		{Version: 2, Statements: []string{"c"}},
+		{Version: 3},
+		{Version: 4, Statements: []string{"d", "e", "f"}},
+	}
+
+	tests := map[string]struct {
+		committed int
+		want      int
+	}{
+		"nothing committed":        {committed: 0, want: 0},
+		"first migration partly":   {committed: 1, want: 0},
+		"first migration":          {committed: 2, want: 1},
+		"empty migration":          {committed: 3, want: 3},
+		"fourth migration partly":  {committed: 5, want: 3},
+		"all statements committed": {committed: 6, want: 4},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := completedMigrations(batch, test.committed); got != test.want {
+				t.Errorf("want %d, but got %d", test.want, got)
+			}
+		})
+	}
+}
+
+func TestMigrationFinishedAt(t *testing.T) {
+	startedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	commitTimestamps := []*timestamppb.Timestamp{
+		timestamppb.New(startedAt.Add(time.Second)),
+		timestamppb.New(startedAt.Add(2 * time.Second)),
+	}
+
+	tests := map[string]struct {
+		committed int
+		want      time.Time
+	}{
+		"empty migration first": {committed: 0, want: startedAt},
+		"first statement":       {committed: 1, want: startedAt.Add(time.Second)},
+		"second statement":      {committed: 2, want: startedAt.Add(2 * time.Second)},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := migrationFinishedAt(commitTimestamps, test.committed, startedAt); !got.Equal(test.want) {
+				t.Errorf("want %v, but got %v", test.want, got)
+			}
+		})
+	}
+}
@@ -25,6 +25,8 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"cloud.google.com/go/spanner"
 	databasev1 "cloud.google.com/go/spanner/admin/database/apiv1"
@@ -47,6 +49,10 @@ type Client struct {
 	config             *Config
 	spannerClient      *spanner.Client
 	spannerAdminClient *databasev1.DatabaseAdminClient
+
+	mu sync.Mutex
+	// historyTables holds the migration table names whose history table is known to exist.
+	historyTables map[string]bool
 }
 
 func NewClient(ctx context.Context, config *Config) (*Client, error) {
@@ -93,6 +99,7 @@ func NewClient(ctx context.Context, config *Config) (*Client, error) {
 		config:             config,
 		spannerClient:      spannerClient,
 		spannerAdminClient: spannerAdminClient,
+		historyTables:      map[string]bool{},
 	}, nil
 }
 
@@ -100,7 +107,7 @@ func (c *Client) CreateDatabase(ctx context.Context, filename string, ddl []byte
 	statements, err := ddlToStatements(filename, ddl)
 	if err != nil {
 		return &Error{
-			Code: ErrorCodeLoadSchema,
+			Code: ErrorCodeInvalidInput,
 			err:  err,
 		}
 	}
@@ -119,6 +126,7 @@ func (c *Client) CreateDatabase(ctx context.Context, filename string, ddl []byte
 			err:  err,
 		}
 	}
+	c.emit(Event{Type: EventOperationStarted, Operation: op.Name()})
 
 	_, err = op.Wait(ctx)
 	if err != nil {
@@ -128,6 +136,10 @@ func (c *Client) CreateDatabase(ctx context.Context, filename string, ddl []byte
 		}
 	}
 
+	for _, s := range statements {
+		c.emit(Event{Type: EventStatementApplied, Statement: s})
+	}
+
 	return nil
 }
 
@@ -145,7 +157,7 @@ func (c *Client) DropDatabase(ctx context.Context) error {
 }
 
 // TruncateAllTables deletes all rows of all tables except the migration table
-// named migrationTableName, so that the database keeps its migration version.
+// named migrationTableName and its history and lock tables, so that the database keeps its migration version.
 func (c *Client) TruncateAllTables(ctx context.Context, migrationTableName string) error {
 	var stms []spanner.Statement
 
@@ -160,7 +172,11 @@ func (c *Client) TruncateAllTables(ctx context.Context, migrationTableName strin
 
 		// Cloud Spanner identifiers are case insensitive, while INFORMATION_SCHEMA
 		// returns the name as it was declared.
-		if strings.EqualFold(t.TableName, migrationTableName) {
+		switch {
+		case strings.EqualFold(t.TableName, migrationTableName),
+			strings.EqualFold(t.TableName, historyTableName(migrationTableName)),
+			strings.EqualFold(t.TableName, lockTableName(migrationTableName)),
+			strings.EqualFold(t.TableName, repeatableTableName(migrationTableName)):
 			return nil
 		}
 
@@ -175,10 +191,12 @@ func (c *Client) TruncateAllTables(ctx context.Context, migrationTableName strin
 	}
 
 	g := &multierror.Group{}
-	for _, stmt := range stms {
-		stmt := stmt
+	nums := make([]int64, len(stms))
+	for i, stmt := range stms {
+		i, stmt := i, stmt
 		g.Go(func() error {
-			_, err := c.spannerClient.PartitionedUpdate(ctx, stmt)
+			num, err := c.spannerClient.PartitionedUpdate(ctx, stmt)
+			nums[i] = num
 			return err
 		})
 	}
@@ -189,6 +207,10 @@ func (c *Client) TruncateAllTables(ctx context.Context, migrationTableName strin
 		}
 	}
 
+	for i, stmt := range stms {
+		c.emit(Event{Type: EventStatementApplied, Statement: stmt.SQL, RowsAffected: nums[i]})
+	}
+
 	return nil
 }
 
@@ -219,12 +241,22 @@ func (c *Client) LoadDDL(ctx context.Context) ([]byte, []byte, error) {
 }
 
 func (c *Client) ApplyDDLFile(ctx context.Context, filename string, ddl []byte, protoDescriptors []byte) error {
-	statements, err := ddlToStatements(filename, ddl)
+	statements, positions, err := toStatementsWithPositions(filename, ddl)
 	if err != nil {
-		return err
+		return &Error{
+			Code: ErrorCodeInvalidInput,
+			err:  err,
+		}
+	}
+
+	if err := c.ApplyDDL(ctx, statements, protoDescriptors); err != nil {
+		return locateStatement(err, statements, positions)
+	}
+	for _, s := range statements {
+		c.emit(Event{Type: EventStatementApplied, Statement: s})
 	}
 
-	return c.ApplyDDL(ctx, statements, protoDescriptors)
+	return nil
 }
 
 func (c *Client) ApplyDDL(ctx context.Context, statements []string, protoDescriptors []byte) error {
@@ -241,9 +273,14 @@ func (c *Client) ApplyDDL(ctx context.Context, statements []string, protoDescrip
 			err:  err,
 		}
 	}
+	c.emit(Event{Type: EventOperationStarted, Operation: op.Name()})
 
 	err = op.Wait(ctx)
 	if err != nil {
+		// The operation stops at the failed statement, so the statements before it have the commit timestamps.
+		if metadata, merr := op.Metadata(); merr == nil && metadata != nil {
+			err = statementError(err, statements, len(metadata.GetCommitTimestamps()))
+		}
 		return &Error{
 			Code: ErrorCodeWaitOperation,
 			err:  err,
@@ -263,79 +300,179 @@ const (
 )
 
 func (c *Client) ApplyDMLFile(ctx context.Context, filename string, ddl []byte, partitioned bool, priority PriorityType) (int64, error) {
-	statements, err := dmlToStatements(filename, ddl)
+	return c.ApplyDMLFileFrom(ctx, filename, ddl, partitioned, priority, 1)
+}
+
+// ApplyDMLFileFrom applies the DML file like ApplyDMLFile, skipping the transactions before the from-th one,
+// so that the file can be rerun after a failure without replaying the committed transaction blocks.
+func (c *Client) ApplyDMLFileFrom(ctx context.Context, filename string, ddl []byte, partitioned bool, priority PriorityType, from int) (int64, error) {
+	statements, positions, err := toStatementsWithPositions(filename, ddl)
 	if err != nil {
-		return 0, err
+		return 0, &Error{
+			Code: ErrorCodeInvalidInput,
+			err:  err,
+		}
 	}
 
+	var num int64
 	if partitioned {
-		return c.ApplyPartitionedDML(ctx, statements, priority)
+		if hasTransactionBlocks(statements) {
+			return 0, &Error{
+				Code: ErrorCodeInvalidInput,
+				err:  errors.New("transaction blocks cannot be executed as partitioned DML"),
+			}
+		}
+		num, err = c.ApplyPartitionedDML(ctx, statements, priority)
+	} else {
+		num, err = c.applyDMLTransactions(ctx, statements, priority, "", from)
 	}
-	return c.ApplyDML(ctx, statements, priority)
+	if err != nil {
+		return num, locateStatement(err, statements, positions)
+	}
+	return num, nil
 }
 
+// ApplyDML applies the DML statements in a transaction.
+// If the statements contain BEGIN; ... COMMIT; blocks, every block is run in its own transaction in order,
+// and so are consecutive statements out of the blocks.
 func (c *Client) ApplyDML(ctx context.Context, statements []string, priority PriorityType) (int64, error) {
-	p := priorityPBOf(priority)
+	return c.applyDMLTransactions(ctx, statements, priority, "", 1)
+}
+
+// applyDMLTransactions applies the DML statements in the transactions split by the transaction blocks and the limit of
+// the mutations, skipping the transactions before the from-th one. The error tells how many transactions have been committed.
+func (c *Client) applyDMLTransactions(ctx context.Context, statements []string, priority PriorityType, transactionTag string, from int) (int64, error) {
+	steps, err := dmlTransactions(statements, c.config.maxMutations())
+	if err != nil {
+		return 0, &Error{
+			Code: ErrorCodeUpdateDML,
+			err:  err,
+		}
+	}
+	if len(steps) <= 1 && from == 1 {
+		num, err := c.applyDML(ctx, dmlStatements(statements), priority, transactionTag)
+		return num, locateStatement(err, statements, nil)
+	}
+	if from < 1 || from > len(steps) {
+		return 0, &Error{
+			Code: ErrorCodeUpdateDML,
+			err:  fmt.Errorf("transaction #%d is out of the %d transactions", from, len(steps)),
+		}
+	}
+
 	numAffectedRows := int64(0)
+	for i, step := range steps[from-1:] {
+		num, err := c.applyDML(ctx, dmlStatements(step.statements), priority, transactionTag)
+		if err != nil {
+			return numAffectedRows, &Error{
+				Code: ErrorCodeUpdateDML,
+				err:  fmt.Errorf("%w, transaction #%d failed after %d of %d transactions were committed", locateStatement(err, statements, nil), from+i, from-1+i, len(steps)),
+			}
+		}
+		numAffectedRows += num
+
+		c.emit(Event{Type: EventTransactionCommitted, Step: from + i, Steps: len(steps), RowsAffected: num})
+	}
+
+	return numAffectedRows, nil
+}
+
+// applyDML applies the DML statements in a transaction tagged with transactionTag, which also writes mutations if any.
+func (c *Client) applyDML(ctx context.Context, statements []string, priority PriorityType, transactionTag string, mutations ...*spanner.Mutation) (int64, error) {
+	p := priorityPBOf(priority)
+	var (
+		numAffectedRows int64
+		counts          []int64
+		failed          int
+	)
 	_, err := c.spannerClient.ReadWriteTransactionWithOptions(
 		ctx,
 		func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
-			stmts := make([]spanner.Statement, len(statements))
-			for i, s := range statements {
-				stmts[i] = spanner.Statement{SQL: s}
-			}
-			counts, err := tx.BatchUpdateWithOptions(ctx, stmts, spanner.QueryOptions{
-				Priority: p,
-			})
-			if err != nil {
-				return err
-			}
+			numAffectedRows, counts, failed = 0, nil, -1
+			if len(statements) > 0 {
+				stmts := make([]spanner.Statement, len(statements))
+				for i, s := range statements {
+					stmts[i] = spanner.Statement{SQL: s}
+				}
+				var err error
+				counts, err = tx.BatchUpdateWithOptions(ctx, stmts, spanner.QueryOptions{
+					Priority: p,
+				})
+				if err != nil {
+					// The batch stops at the failed statement, so the statements before it have the counts.
+					failed = len(counts)
+					return err
+				}
 
-			for _, num := range counts {
-				numAffectedRows += num
+				for _, num := range counts {
+					numAffectedRows += num
+				}
 			}
 
+			if len(mutations) > 0 {
+				return tx.BufferWrite(mutations)
+			}
 			return nil
 		},
 		spanner.TransactionOptions{
 			CommitPriority: p,
+			TransactionTag: transactionTag,
 		},
 	)
 	if err != nil {
 		return 0, &Error{
 			Code: ErrorCodeUpdateDML,
-			err:  err,
+			err:  statementError(err, statements, failed),
 		}
 	}
 
+	for i, num := range counts {
+		c.emit(Event{Type: EventStatementApplied, Statement: statements[i], RowsAffected: num})
+	}
+
 	return numAffectedRows, nil
 }
 
 func (c *Client) ApplyPartitionedDML(ctx context.Context, statements []string, priority PriorityType) (int64, error) {
+	return c.applyPartitionedDML(ctx, statements, priority, "")
+}
+
+func (c *Client) applyPartitionedDML(ctx context.Context, statements []string, priority PriorityType, requestTag string) (int64, error) {
 	p := priorityPBOf(priority)
 	numAffectedRows := int64(0)
-	for _, s := range statements {
+	for i, s := range statements {
 		num, err := c.spannerClient.PartitionedUpdateWithOptions(ctx, spanner.Statement{
 			SQL: s,
 		}, spanner.QueryOptions{
-			Priority: p,
+			Priority:   p,
+			RequestTag: requestTag,
 		})
 		if err != nil {
 			return numAffectedRows, &Error{
 				Code: ErrorCodeUpdatePartitionedDML,
-				err:  err,
+				err:  statementError(err, statements, i),
 			}
 		}
 
 		numAffectedRows += num
+
+		c.emit(Event{Type: EventStatementApplied, Statement: s, RowsAffected: num})
 	}
 
 	return numAffectedRows, nil
 }
 
-func (c *Client) ExecuteMigrations(ctx context.Context, migrations Migrations, limit int, tableName string, priorityType PriorityType, protoDescriptors []byte) error {
+func (c *Client) ExecuteMigrations(ctx context.Context, migrations Migrations, limit int, tableName string, priorityType PriorityType, protoDescriptors []byte, opts ...MigrationOption) error {
+	o := newMigrationOptions(opts)
+
 	sort.Sort(migrations)
 
+	lock, err := c.AcquireMigrationLock(ctx, tableName, o.lock)
+	if err != nil {
+		return err
+	}
+	defer lock.Release(ctx)
+
 	version, dirty, err := c.GetSchemaMigrationVersion(ctx, tableName)
 	if err != nil {
 		var se *Error
@@ -354,78 +491,407 @@ func (c *Client) ExecuteMigrations(ctx context.Context, migrations Migrations, l
 		}
 	}
 
-	var count int
-	for _, m := range migrations {
-		if limit == 0 {
-			break
+	if err := c.ensureMigrationHistoryTable(ctx, tableName); err != nil {
+		return &Error{
+			Code: ErrorCodeExecuteMigrations,
+			err:  err,
 		}
+	}
 
-		if m.Version <= version {
-			continue
+	if !o.allowChecksumDrift {
+		if err := c.VerifyMigrations(ctx, migrations, tableName); err != nil {
+			return err
 		}
+	}
 
-		if err := c.SetSchemaMigrationVersion(ctx, m.Version, true, tableName); err != nil {
-			return &Error{
-				Code: ErrorCodeExecuteMigrations,
-				err:  err,
-			}
+	pending := pendingMigrations(migrations, version, limit)
+	if o.allowOutOfOrder {
+		history, err := c.readMigrationHistory(ctx, tableName)
+		if err != nil {
+			return err
+		}
+		pending = unappliedMigrations(migrations, history, limit)
+	}
+	if o.plan != nil {
+		if err := verifyPlan(o.plan, version, pending); err != nil {
+			return err
+		}
+
+		repeatable, err := c.PendingRepeatableMigrations(ctx, o.repeatable, tableName)
+		if err != nil {
+			return err
 		}
+		if o.repeatable, err = plannedRepeatableMigrations(o.plan, repeatable); err != nil {
+			return err
+		}
+	}
+	if err := verifyEnvironment(pending, o.env); err != nil {
+		return err
+	}
+
+	if err := o.hooks.beforeRun(ctx, pending); err != nil {
+		return err
+	}
+
+	c.emit(Event{Type: EventRunStarted, Direction: MigrationDirectionUp, Count: len(pending)})
+
+	applied, count, err := c.applyPendingMigrations(ctx, lock, pending, limit, tableName, priorityType, protoDescriptors, o)
 
-		switch m.kind {
-		case statementKindDDL:
-			if err := c.ApplyDDL(ctx, m.Statements, protoDescriptors); err != nil {
-				return &Error{
+	c.emit(Event{Type: EventRunFinished, Direction: MigrationDirectionUp, Count: count, Err: err})
+
+	if hookErr := o.hooks.afterRun(ctx, applied, err); hookErr != nil && err == nil {
+		return hookErr
+	}
+
+	return err
+}
+
+// applyPendingMigrations applies pending migrations and then the repeatable migrations if no limit is given or they are planned.
+// It returns the applied migrations, which do not include the skipped ones, and the number of the applied,
+// skipped and repeatable migrations.
+func (c *Client) applyPendingMigrations(ctx context.Context, lock *MigrationLock, pending Migrations, limit int, tableName string, priorityType PriorityType, protoDescriptors []byte, o *migrationOptions) (Migrations, int, error) {
+	var (
+		applied Migrations
+		count   int
+	)
+	for _, group := range groupMigrations(pending, o.batchDDL) {
+		if err := lock.Err(); err != nil {
+			return applied, count, err
+		}
+
+		if m := group[0]; !m.InEnv(o.env) {
+			if err := c.skipMigration(ctx, tableName, m); err != nil {
+				return applied, count, &Error{
 					Code: ErrorCodeExecuteMigrations,
 					err:  err,
 				}
 			}
-		case statementKindDML:
-			if _, err := c.ApplyDML(ctx, m.Statements, priorityType); err != nil {
-				return &Error{
-					Code: ErrorCodeExecuteMigrations,
-					err:  err,
-				}
+			c.emit(migrationEvent(EventMigrationSkipped, MigrationDirectionUp, m))
+			count++
+			continue
+		}
+
+		// The hooks of all the migrations in a batch are called around the batch.
+		for _, m := range group {
+			if err := o.hooks.beforeMigration(ctx, m); err != nil {
+				return applied, count, err
 			}
-		case statementKindPartitionedDML:
-			if _, err := c.ApplyPartitionedDML(ctx, m.Statements, priorityType); err != nil {
-				return &Error{
-					Code: ErrorCodeExecuteMigrations,
-					err:  err,
-				}
+		}
+
+		if len(group) > 1 {
+			n, err := c.applyMigrationBatch(ctx, tableName, group, protoDescriptors)
+			applied = append(applied, group[:n]...)
+			count += n
+			if err != nil {
+				return applied, count, err
 			}
-		default:
-			return &Error{
-				Code: ErrorCodeExecuteMigrations,
-				err:  fmt.Errorf("unknown query type, version: %d", m.Version),
+		} else {
+			if err := c.executeMigration(ctx, tableName, group[0], priorityType, protoDescriptors); err != nil {
+				return applied, count, err
 			}
+			applied = append(applied, group[0])
+			count++
 		}
 
-		if m.Name != "" {
-			fmt.Printf("%d/up %s\n", m.Version, m.Name)
-		} else {
-			fmt.Printf("%d/up\n", m.Version)
+		for _, m := range group {
+			if err := o.hooks.afterMigration(ctx, m); err != nil {
+				return applied, count, err
+			}
 		}
+	}
 
-		if err := c.SetSchemaMigrationVersion(ctx, m.Version, false, tableName); err != nil {
+	if (limit < 0 || o.plan != nil) && len(o.repeatable) > 0 {
+		if err := lock.Err(); err != nil {
+			return applied, count, err
+		}
+
+		n, err := c.applyRepeatableMigrations(ctx, o.repeatable, tableName, priorityType, protoDescriptors)
+		count += n
+		if err != nil {
+			return applied, count, err
+		}
+	}
+
+	return applied, count, nil
+}
+
+// executeMigration applies m and records it in the history, within the timeout directive of m if any.
+func (c *Client) executeMigration(ctx context.Context, tableName string, m *Migration, priorityType PriorityType, protoDescriptors []byte) error {
+	ctx, cancel := migrationContext(ctx, m.Directives)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := c.startMigration(ctx, tableName, m); err != nil {
+		return &Error{
+			Code: ErrorCodeExecuteMigrations,
+			err:  err,
+		}
+	}
+
+	c.emit(migrationEvent(EventMigrationStarted, MigrationDirectionUp, m))
+
+	if err := c.applyMigration(ctx, tableName, m, priorityType, protoDescriptors); err != nil {
+		return &Error{
+			Code: ErrorCodeExecuteMigrations,
+			err:  fmt.Errorf("%w, version: %d", locateStatement(err, m.Statements, m.positions), m.Version),
+		}
+	}
+
+	d := time.Since(start)
+	if err := c.finishMigration(ctx, tableName, m, d); err != nil {
+		return &Error{
+			Code: ErrorCodeExecuteMigrations,
+			err:  err,
+		}
+	}
+
+	e := migrationEvent(EventMigrationFinished, MigrationDirectionUp, m)
+	e.Duration = d
+	c.emit(e)
+
+	return nil
+}
+
+// pendingMigrations returns all or limit migrations newer than version from sorted migrations.
+func pendingMigrations(migrations Migrations, version uint, limit int) Migrations {
+	var pending Migrations
+	for _, m := range migrations {
+		if limit >= 0 && len(pending) == limit {
+			break
+		}
+
+		if m.Version <= version {
+			continue
+		}
+
+		pending = append(pending, m)
+	}
+	return pending
+}
+
+// unappliedMigrations returns all or limit migrations from sorted migrations which are not recorded as applied in history,
+// including the ones older than the database version. The migrations up to the baseline version are regarded as applied.
+func unappliedMigrations(migrations Migrations, history []*MigrationHistory, limit int) Migrations {
+	applied, baseline := appliedVersions(history)
+
+	var pending Migrations
+	for _, m := range migrations {
+		if limit >= 0 && len(pending) == limit {
+			break
+		}
+
+		if applied[m.Version] || m.Version <= baseline {
+			continue
+		}
+
+		pending = append(pending, m)
+	}
+	return pending
+}
+
+// RollbackMigrations applies the down migrations of all or limit applied migrations in reverse order,
+// starting from the current version. Every migration to be rolled back must have a paired down migration.
+func (c *Client) RollbackMigrations(ctx context.Context, migrations Migrations, limit int, tableName string, priorityType PriorityType, protoDescriptors []byte, opts ...MigrationOption) error {
+	o := newMigrationOptions(opts)
+
+	sort.Sort(migrations)
+
+	lock, err := c.AcquireMigrationLock(ctx, tableName, o.lock)
+	if err != nil {
+		return err
+	}
+	defer lock.Release(ctx)
+
+	version, dirty, err := c.GetSchemaMigrationVersion(ctx, tableName)
+	if err != nil {
+		var se *Error
+		if errors.As(err, &se) && se.Code == ErrorCodeNoMigration {
+			c.emit(Event{Type: EventRunStarted, Direction: MigrationDirectionDown})
+			c.emit(Event{Type: EventRunFinished, Direction: MigrationDirectionDown})
+			return nil
+		}
+		return &Error{
+			Code: ErrorCodeExecuteMigrations,
+			err:  err,
+		}
+	}
+
+	if dirty {
+		return &Error{
+			Code: ErrorCodeMigrationVersionDirty,
+			err:  fmt.Errorf("database version: %d is dirty, please fix it", version),
+		}
+	}
+
+	if err := c.ensureMigrationHistoryTable(ctx, tableName); err != nil {
+		return &Error{
+			Code: ErrorCodeExecuteMigrations,
+			err:  err,
+		}
+	}
+
+	history, err := c.readMigrationHistory(ctx, tableName)
+	if err != nil {
+		return err
+	}
+
+	// The migrations are rolled back in reverse order skipping the ones which have not been applied,
+	// e.g. the migrations older than the database version added after it was applied.
+	applied, baseline := appliedVersions(history)
+	var targets Migrations
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.Version <= version && (applied[m.Version] || m.Version <= baseline) {
+			targets = append(targets, m)
+		}
+	}
+	if len(targets) == 0 || targets[0].Version != version {
+		return &Error{
+			Code: ErrorCodeExecuteMigrations,
+			err:  fmt.Errorf("database version: %d is not found in migrations", version),
+		}
+	}
+
+	skipped := skippedVersions(history)
+
+	// Validate all the targets before changing anything so that the rollback does not stop halfway.
+	n := len(targets)
+	if limit >= 0 && limit < n {
+		n = limit
+	}
+	for _, m := range targets[:n] {
+		if !m.hasDown && !skipped[m.Version] {
 			return &Error{
 				Code: ErrorCodeExecuteMigrations,
-				err:  err,
+				err:  fmt.Errorf("down migration is not found, version: %d", m.Version),
 			}
 		}
+	}
 
-		count++
-		if limit > 0 && count == limit {
+	c.emit(Event{Type: EventRunStarted, Direction: MigrationDirectionDown, Count: n})
+
+	var (
+		count  int
+		runErr error
+	)
+	for i, m := range targets[:n] {
+		if runErr = lock.Err(); runErr != nil {
+			break
+		}
+
+		var prev *Migration
+		if i+1 < len(targets) {
+			prev = targets[i+1]
+		}
+		if runErr = c.rollbackMigration(ctx, tableName, m, prev, skipped[m.Version], priorityType, protoDescriptors); runErr != nil {
 			break
 		}
+
+		count++
+	}
+
+	c.emit(Event{Type: EventRunFinished, Direction: MigrationDirectionDown, Count: count, Err: runErr})
+
+	return runErr
+}
+
+// rollbackMigration applies the down migration of m within its timeout directive if any,
+// and sets the database version to prev, or deletes it if prev is nil.
+// The down migration is not applied if m was skipped, since m was not applied either.
+func (c *Client) rollbackMigration(ctx context.Context, tableName string, m, prev *Migration, skipped bool, priorityType PriorityType, protoDescriptors []byte) error {
+	ctx, cancel := migrationContext(ctx, m.DownDirectives)
+	defer cancel()
+
+	start := time.Now()
+	if err := c.SetSchemaMigrationVersion(ctx, m.Version, true, tableName); err != nil {
+		return &Error{
+			Code: ErrorCodeExecuteMigrations,
+			err:  err,
+		}
 	}
 
-	if count == 0 {
-		fmt.Println("no change")
+	c.emit(Event{Type: EventDirtySet, Version: m.Version})
+	c.emit(migrationEvent(EventMigrationStarted, MigrationDirectionDown, m))
+
+	if !skipped {
+		if err := c.applyStatements(ctx, m.downKind, m.DownStatements, m.DownDirectives, priorityType, protoDescriptors); err != nil {
+			return &Error{
+				Code: ErrorCodeExecuteMigrations,
+				err:  fmt.Errorf("%w, version: %d", locateStatement(err, m.DownStatements, m.downPositions), m.Version),
+			}
+		}
 	}
 
+	var err error
+	if prev != nil {
+		err = c.SetSchemaMigrationVersion(ctx, prev.Version, false, tableName)
+	} else {
+		err = c.deleteSchemaMigrationVersion(ctx, tableName)
+	}
+	if err != nil {
+		return &Error{
+			Code: ErrorCodeExecuteMigrations,
+			err:  err,
+		}
+	}
+
+	c.emit(Event{Type: EventDirtyCleared, Version: m.Version})
+
+	e := migrationEvent(EventMigrationFinished, MigrationDirectionDown, m)
+	e.Duration = time.Since(start)
+	c.emit(e)
+
 	return nil
 }
 
+func (c *Client) applyMigration(ctx context.Context, tableName string, m *Migration, priorityType PriorityType, protoDescriptors []byte) error {
+	if m.kind == statementKindGo {
+		return c.runGoMigration(ctx, m)
+	}
+
+	steps, err := m.steps(c.config.maxMutations())
+	if err != nil {
+		return err
+	}
+	if steps != nil {
+		return c.applyMigrationSteps(ctx, tableName, m, steps, 0, priorityType, protoDescriptors)
+	}
+	return c.applyStatements(ctx, m.kind, m.Statements, m.Directives, priorityType, protoDescriptors)
+}
+
+// applyStatements applies the statements of kind. The directives override priorityType and protoDescriptors.
+func (c *Client) applyStatements(ctx context.Context, kind statementKind, statements []string, directives MigrationDirectives, priorityType PriorityType, protoDescriptors []byte) error {
+	switch kind {
+	case statementKindDDL:
+		if err := c.ApplyDDL(ctx, statements, directives.protoDescriptorsOr(protoDescriptors)); err != nil {
+			return err
+		}
+		for _, s := range statements {
+			c.emit(Event{Type: EventStatementApplied, Statement: s})
+		}
+		return nil
+	case statementKindDML:
+		_, err := c.applyDMLTransactions(ctx, statements, directives.priorityOr(priorityType), directives.TransactionTag, 1)
+		return err
+	case statementKindPartitionedDML:
+		_, err := c.applyPartitionedDML(ctx, statements, directives.priorityOr(priorityType), directives.TransactionTag)
+		return err
+	case statementKindMixed:
+		steps, err := splitSteps(statements, directives.Partitioned)
+		if err != nil {
+			return err
+		}
+		for _, step := range steps {
+			if err := c.applyStatements(ctx, step.kind, step.statements, directives, priorityType, protoDescriptors); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return errors.New("unknown query type")
+	}
+}
+
 func (c *Client) GetSchemaMigrationVersion(ctx context.Context, tableName string) (uint, bool, error) {
 	stmt := spanner.Statement{
 		SQL: fmt.Sprintf("SELECT Version, Dirty FROM `%s` LIMIT 1", tableName),
@@ -461,7 +927,17 @@ func (c *Client) GetSchemaMigrationVersion(ctx context.Context, tableName string
 	return uint(v), dirty, nil
 }
 
+// SetSchemaMigrationVersion sets the version and the dirty flag of the database.
+// The history of the versions newer than version is deleted, and version is recorded in the history
+// without the details of the migration.
 func (c *Client) SetSchemaMigrationVersion(ctx context.Context, version uint, dirty bool, tableName string) error {
+	if err := c.ensureMigrationHistoryTable(ctx, tableName); err != nil {
+		return &Error{
+			Code: ErrorCodeSetMigrationVersion,
+			err:  err,
+		}
+	}
+
 	_, err := c.spannerClient.ReadWriteTransaction(ctx, func(_ context.Context, tx *spanner.ReadWriteTransaction) error {
 		m := []*spanner.Mutation{
 			spanner.Delete(tableName, spanner.AllKeys()),
@@ -470,6 +946,16 @@ func (c *Client) SetSchemaMigrationVersion(ctx context.Context, version uint, di
 				[]string{"Version", "Dirty"},
 				[]interface{}{int64(version), dirty},
 			),
+			spanner.Delete(historyTableName(tableName), spanner.KeyRange{
+				Start: spanner.Key{int64(version)},
+				End:   spanner.Key{},
+				Kind:  spanner.OpenClosed,
+			}),
+			spanner.InsertOrUpdate(
+				historyTableName(tableName),
+				[]string{"Version", "Dirty"},
+				[]interface{}{int64(version), dirty},
+			),
 		}
 		return tx.BufferWrite(m)
 	})
@@ -483,21 +969,40 @@ func (c *Client) SetSchemaMigrationVersion(ctx context.Context, version uint, di
 	return nil
 }
 
+// deleteSchemaMigrationVersion deletes the version record and the history so that no migration is applied to the database.
+func (c *Client) deleteSchemaMigrationVersion(ctx context.Context, tableName string) error {
+	_, err := c.spannerClient.Apply(ctx, []*spanner.Mutation{
+		spanner.Delete(tableName, spanner.AllKeys()),
+		spanner.Delete(historyTableName(tableName), spanner.AllKeys()),
+	})
+	if err != nil {
+		return &Error{
+			Code: ErrorCodeSetMigrationVersion,
+			err:  err,
+		}
+	}
+
+	return nil
+}
+
+// EnsureMigrationTable creates the migration table and its history table if they do not exist.
 func (c *Client) EnsureMigrationTable(ctx context.Context, tableName string) error {
 	iter := c.spannerClient.Single().Read(ctx, tableName, spanner.AllKeys(), []string{"Version"})
 	err := iter.Do(func(r *spanner.Row) error {
 		return nil
 	})
-	if err == nil {
-		return nil
-	}
-
-	stmt := fmt.Sprintf("CREATE TABLE `%s` ("+`
+	if err != nil {
+		stmt := fmt.Sprintf("CREATE TABLE `%s` ("+`
     Version INT64 NOT NULL,
     Dirty    BOOL NOT NULL
 	) PRIMARY KEY(Version)`, tableName)
 
-	return c.ApplyDDL(ctx, []string{stmt}, nil)
+		if err := c.ApplyDDL(ctx, []string{stmt}, nil); err != nil {
+			return err
+		}
+	}
+
+	return c.ensureMigrationHistoryTable(ctx, tableName)
 }
 
 func (c *Client) Close() error {
@@ -20,11 +20,14 @@
 package spanner
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"cloud.google.com/go/spanner"
 	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
@@ -319,6 +322,142 @@ func TestApplyDMLFile(t *testing.T) {
 	}
 }
 
+func TestApplyDMLFileWithTransactionBlocks(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, done := testClientWithDatabase(t, ctx)
+	defer done()
+
+	failing := []byte(`
+BEGIN;
+INSERT INTO Singers (SingerID, FirstName) VALUES ('1', 'Foo');
+COMMIT;
+BEGIN;
+INSERT INTO Singers (SingerID, FirstName) VALUES ('2', 'Bar');
+INSERT INTO Missing (ID) VALUES (1);
+COMMIT;
+`)
+	if _, err := client.ApplyDMLFile(ctx, "failing.sql", failing, false, PriorityTypeUnspecified); err == nil {
+		t.Fatal("want error, but got nil")
+	}
+
+	ensureSingers := func(want int64) {
+		t.Helper()
+
+		iter := client.spannerClient.Single().Query(ctx, spanner.Statement{SQL: "SELECT COUNT(*) FROM Singers"})
+		defer iter.Stop()
+		row, err := iter.Next()
+		if err != nil {
+			t.Fatalf("failed to count singers: %v", err)
+		}
+		var got int64
+		if err := row.Columns(&got); err != nil {
+			t.Fatalf("failed to count singers: %v", err)
+		}
+		if want != got {
+			t.Errorf("want %d singers, but got %d", want, got)
+		}
+	}
+
+	// The first transaction is committed, while the second one is rolled back.
+	ensureSingers(1)
+
+	fixed := []byte(`
+BEGIN;
+INSERT INTO Singers (SingerID, FirstName) VALUES ('1', 'Foo');
+COMMIT;
+BEGIN;
+INSERT INTO Singers (SingerID, FirstName) VALUES ('2', 'Bar');
+COMMIT;
+`)
+	n, err := client.ApplyDMLFileFrom(ctx, "fixed.sql", fixed, false, PriorityTypeUnspecified, 2)
+	if err != nil {
+		t.Fatalf("failed to apply dml file: %v", err)
+	}
+	if want, got := int64(1), n; want != got {
+		t.Errorf("want %d, but got %d", want, got)
+	}
+
+	ensureSingers(2)
+}
+
+func TestApplyDMLFileWithChunks(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, done := testClientWithDatabase(t, ctx)
+	defer done()
+
+	// Every statement makes its own chunk by the limit.
+	client.config.MaxMutations = 3
+
+	dml := []byte(`
+INSERT INTO Singers (SingerID, FirstName) VALUES ('1', 'Foo');
+INSERT INTO Singers (SingerID, FirstName) VALUES ('2', 'Bar');
+INSERT INTO Singers (SingerID, FirstName) VALUES ('1', 'Baz');
+`)
+	if _, err := client.ApplyDMLFile(ctx, "dml.sql", dml, false, PriorityTypeUnspecified); err == nil {
+		t.Fatal("want error, but got nil")
+	}
+
+	// The first two chunks are committed, and the file is resumed from the third one.
+	fixed := bytes.Replace(dml, []byte("('1', 'Baz')"), []byte("('3', 'Baz')"), 1)
+	n, err := client.ApplyDMLFileFrom(ctx, "dml.sql", fixed, false, PriorityTypeUnspecified, 3)
+	if err != nil {
+		t.Fatalf("failed to apply dml file: %v", err)
+	}
+	if want, got := int64(1), n; want != got {
+		t.Errorf("want %d, but got %d", want, got)
+	}
+}
+
+func TestApplyFileStatementError(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, done := testClientWithDatabase(t, ctx)
+	defer done()
+
+	t.Run("DDL", func(t *testing.T) {
+		ddl := []byte(`-- The second statement fails.
+ALTER TABLE Singers ADD COLUMN Bar STRING(MAX);
+
+CREATE INDEX SingersByUnknown ON Singers(Unknown);
+`)
+		err := client.ApplyDDLFile(ctx, "ddl.sql", ddl, nil)
+
+		var se *StatementError
+		if !errors.As(err, &se) {
+			t.Fatalf("want StatementError, but got %v", err)
+		}
+		if want, got := 1, se.Index; want != got {
+			t.Errorf("want index %d, but got %d", want, got)
+		}
+		if want, got := "ddl.sql:4:1", se.Position.String(); want != got {
+			t.Errorf("want position %s, but got %s", want, got)
+		}
+	})
+
+	t.Run("DML", func(t *testing.T) {
+		dml := []byte(`INSERT INTO Singers (SingerID, FirstName) VALUES ('10', 'Foo');
+  INSERT INTO Singers (SingerID, FirstName) VALUES ('10', 'Bar');
+`)
+		_, err := client.ApplyDMLFile(ctx, "dml.sql", dml, false, PriorityTypeUnspecified)
+
+		var se *StatementError
+		if !errors.As(err, &se) {
+			t.Fatalf("want StatementError, but got %v", err)
+		}
+		if want, got := 1, se.Index; want != got {
+			t.Errorf("want index %d, but got %d", want, got)
+		}
+		if want, got := "dml.sql:2:3", se.Position.String(); want != got {
+			t.Errorf("want position %s, but got %s", want, got)
+		}
+	})
+}
+
 func TestExecuteMigrations(t *testing.T) {
 	t.Parallel()
 	ctx := context.Background()
@@ -379,6 +518,138 @@ func TestExecuteMigrations(t *testing.T) {
 	}
 }
 
+func TestExecuteMigrationsWithBatchDDL(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, done := testClientWithDatabase(t, ctx)
+	defer done()
+
+	migrations := Migrations{
+		{Version: 2, FileName: "000002.sql", kind: statementKindDDL, Statements: []string{"ALTER TABLE Singers ADD COLUMN Nickname STRING(MAX)"}},
+		{Version: 3, FileName: "000003.sql", kind: statementKindDDL, Statements: []string{"CREATE INDEX SingersByNickname ON Singers(Nickname)"}},
+		{Version: 4, FileName: "000004.sql", kind: statementKindDDL, Statements: []string{
+			"ALTER TABLE Singers ADD COLUMN Alias STRING(MAX)",
+			"ALTER TABLE NotFound ADD COLUMN Foo INT64",
+		}},
+	}
+
+	// 000004.sql fails at its second statement, after 000002.sql and 000003.sql have been committed.
+	if err := client.ExecuteMigrations(ctx, migrations, -1, migrationTable, PriorityTypeUnspecified, nil, WithBatchDDL()); err == nil {
+		t.Fatal("want error, but got nil")
+	}
+
+	ensureMigrationColumn(t, ctx, client, "Nickname", "STRING(MAX)", "YES")
+	ensureMigrationVersionRecord(t, ctx, client, 4, true)
+
+	history, err := client.GetMigrationHistory(ctx, migrationTable)
+	if err != nil {
+		t.Fatalf("failed to get migration history: %v", err)
+	}
+
+	if len(history) != 3 {
+		t.Fatalf("history length want 3, but got %d", len(history))
+	}
+	for i, h := range history[:2] {
+		if want, got := migrations[i].Version, h.Version; want != got {
+			t.Errorf("want %d, but got %d", want, got)
+		}
+		if h.Dirty || h.FinishedAt.IsZero() || h.Checksum != migrations[i].Checksum() {
+			t.Errorf("want the completed migration, but got %+v", h)
+		}
+	}
+	if h := history[2]; !h.Dirty || !h.FinishedAt.IsZero() {
+		t.Errorf("want the dirty migration, but got %+v", h)
+	}
+}
+
+func TestExecuteGoMigrations(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, done := testClientWithDatabase(t, ctx)
+	defer done()
+
+	migrations, err := ReadMigrations(ctx, "testdata/migrations")
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+
+	migrations = append(migrations, &Migration{
+		Version: 6,
+		Name:    "go",
+		kind:    statementKindGo,
+		goTxFunc: func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+			return tx.BufferWrite([]*spanner.Mutation{
+				spanner.Insert(singerTable, []string{"SingerID", "FirstName", "LastName"}, []interface{}{"3", "Go", "Migration"}),
+			})
+		},
+	})
+
+	if err := client.ExecuteMigrations(ctx, migrations, -1, migrationTable, PriorityTypeUnspecified, nil); err != nil {
+		t.Fatalf("failed to execute migration: %v", err)
+	}
+
+	ensureMigrationVersionRecord(t, ctx, client, 6, false)
+
+	row, err := client.spannerClient.Single().ReadRow(ctx, singerTable, spanner.Key{"3"}, []string{"FirstName"})
+	if err != nil {
+		t.Fatalf("failed to read the row written by the Go migration: %v", err)
+	}
+	var firstName string
+	if err := row.Columns(&firstName); err != nil {
+		t.Fatal(err)
+	}
+	if firstName != "Go" {
+		t.Errorf("want Go, but got %s", firstName)
+	}
+}
+
+func TestRollbackMigrations(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, done := testClientWithDatabase(t, ctx)
+	defer done()
+
+	_, err := client.spannerClient.Apply(
+		ctx,
+		[]*spanner.Mutation{
+			spanner.Insert(singerTable, []string{"SingerID", "FirstName"}, []interface{}{"1", "foo"}),
+		},
+	)
+	if err != nil {
+		t.Fatalf("failed to apply mutation: %v", err)
+	}
+
+	migrations, err := ReadMigrations(ctx, "testdata/migrations")
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+
+	if err := client.ExecuteMigrations(ctx, migrations, len(migrations), migrationTable, PriorityTypeUnspecified, nil); err != nil {
+		t.Fatalf("failed to execute migration: %v", err)
+	}
+
+	// roll back 000005.sql and 000004.sql.
+	if err := client.RollbackMigrations(ctx, migrations, 2, migrationTable, PriorityTypeUnspecified, nil); err != nil {
+		t.Fatalf("failed to rollback migration: %v", err)
+	}
+
+	ensureMigrationColumn(t, ctx, client, "LastName", "STRING(MAX)", "YES")
+	ensureMigrationVersionRecord(t, ctx, client, 3, false)
+
+	if got := countRows(t, ctx, client, singerTable); got != 1 {
+		t.Errorf("%s want 1 row, but got %d", singerTable, got)
+	}
+
+	// 000003.sql has no down migration.
+	if err := client.RollbackMigrations(ctx, migrations, 1, migrationTable, PriorityTypeUnspecified, nil); err == nil {
+		t.Error("want error, but got nil")
+	}
+	ensureMigrationVersionRecord(t, ctx, client, 3, false)
+}
+
 func ensureMigrationColumn(t *testing.T, ctx context.Context, client *Client, columnName, spannerType, isNullable string) {
 	t.Helper()
 
@@ -541,6 +812,758 @@ func TestEnsureMigrationTable(t *testing.T) {
 	}
 }
 
+func TestGetMigrationHistory(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, done := testClientWithDatabase(t, ctx)
+	defer done()
+
+	// the migration table created by an older wrench version only has a single row.
+	_, err := client.spannerClient.Apply(
+		ctx,
+		[]*spanner.Mutation{
+			spanner.Insert(migrationTable, []string{"Version", "Dirty"}, []interface{}{1, false}),
+		},
+	)
+	if err != nil {
+		t.Fatalf("failed to apply mutation: %v", err)
+	}
+
+	if err := client.EnsureMigrationTable(ctx, migrationTable); err != nil {
+		t.Fatalf("failed to ensure migration table: %v", err)
+	}
+
+	migrations, err := ReadMigrations(ctx, "testdata/migrations")
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+
+	if err := client.ExecuteMigrations(ctx, migrations, 1, migrationTable, PriorityTypeUnspecified, nil); err != nil {
+		t.Fatalf("failed to execute migration: %v", err)
+	}
+
+	history, err := client.GetMigrationHistory(ctx, migrationTable)
+	if err != nil {
+		t.Fatalf("failed to get migration history: %v", err)
+	}
+
+	if len(history) != 2 {
+		t.Fatalf("history length want 2, but got %d", len(history))
+	}
+
+	if want, got := uint(1), history[0].Version; want != got {
+		t.Errorf("want %d, but got %d", want, got)
+	}
+	if history[0].FileName != "" || !history[0].StartedAt.IsZero() {
+		t.Errorf("want the carried over version without details, but got %+v", history[0])
+	}
+
+	h := history[1]
+	if want, got := uint(2), h.Version; want != got {
+		t.Errorf("want %d, but got %d", want, got)
+	}
+	if h.Dirty {
+		t.Errorf("want clean, but got dirty")
+	}
+	if want, got := "000002_test.sql", h.FileName; want != got {
+		t.Errorf("want %s, but got %s", want, got)
+	}
+	if want, got := migrations[0].Checksum(), h.Checksum; want != got {
+		t.Errorf("want %s, but got %s", want, got)
+	}
+	if h.StartedAt.IsZero() || h.FinishedAt.Before(h.StartedAt) {
+		t.Errorf("want valid timestamps, but got started at %v and finished at %v", h.StartedAt, h.FinishedAt)
+	}
+	if h.AppliedBy == "" {
+		t.Error("want applied by, but got empty")
+	}
+
+	// ensure the history of newer versions is deleted by setting an older version.
+	if err := client.SetSchemaMigrationVersion(ctx, 1, false, migrationTable); err != nil {
+		t.Fatalf("failed to set version: %v", err)
+	}
+
+	history, err = client.GetMigrationHistory(ctx, migrationTable)
+	if err != nil {
+		t.Fatalf("failed to get migration history: %v", err)
+	}
+
+	if len(history) != 1 {
+		t.Fatalf("history length want 1, but got %d", len(history))
+	}
+}
+
+func TestPendingMigrations(t *testing.T) {
+	t.Parallel()
+
+	migrations := Migrations{{Version: 1}, {Version: 2}, {Version: 3}, {Version: 4}}
+
+	tests := map[string]struct {
+		version uint
+		limit   int
+		want    []uint
+	}{
+		"all":             {version: 0, limit: -1, want: []uint{1, 2, 3, 4}},
+		"newer than 2":    {version: 2, limit: -1, want: []uint{3, 4}},
+		"limit 1":         {version: 2, limit: 1, want: []uint{3}},
+		"limit 0":         {version: 2, limit: 0, want: nil},
+		"already applied": {version: 4, limit: -1, want: nil},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := pendingMigrations(migrations, test.version, test.limit)
+			if len(got) != len(test.want) {
+				t.Fatalf("want %d migrations, but got %d", len(test.want), len(got))
+			}
+			for i := range got {
+				if got[i].Version != test.want[i] {
+					t.Errorf("want version %d, but got %d", test.want[i], got[i].Version)
+				}
+			}
+		})
+	}
+}
+
+func TestUnappliedMigrations(t *testing.T) {
+	t.Parallel()
+
+	migrations := Migrations{{Version: 1}, {Version: 2}, {Version: 3}, {Version: 4}, {Version: 5}}
+
+	tests := map[string]struct {
+		history []*MigrationHistory
+		limit   int
+		want    []uint
+	}{
+		"no history": {
+			history: nil,
+			limit:   -1,
+			want:    []uint{1, 2, 3, 4, 5},
+		},
+		"out of order": {
+			history: []*MigrationHistory{{Version: 1, Checksum: "a"}, {Version: 2, Checksum: "b"}, {Version: 4, Checksum: "c"}},
+			limit:   -1,
+			want:    []uint{3, 5},
+		},
+		"limit 1": {
+			history: []*MigrationHistory{{Version: 1, Checksum: "a"}, {Version: 2, Checksum: "b"}, {Version: 4, Checksum: "c"}},
+			limit:   1,
+			want:    []uint{3},
+		},
+		"baseline": {
+			history: []*MigrationHistory{{Version: 2}, {Version: 4, Checksum: "c"}},
+			limit:   -1,
+			want:    []uint{3, 5},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := unappliedMigrations(migrations, test.history, test.limit)
+			if len(got) != len(test.want) {
+				t.Fatalf("want %d migrations, but got %d", len(test.want), len(got))
+			}
+			for i := range got {
+				if got[i].Version != test.want[i] {
+					t.Errorf("want version %d, but got %d", test.want[i], got[i].Version)
+				}
+			}
+		})
+	}
+}
+
+func TestExecuteMigrationsOutOfOrder(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, done := testClientWithDatabase(t, ctx)
+	defer done()
+
+	migrations, err := ReadMigrations(ctx, "testdata/migrations")
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+
+	// 000003.sql is merged after 000004.sql has been applied.
+	var merged Migrations
+	for _, m := range migrations {
+		if m.Version != 3 && m.Version != 5 {
+			merged = append(merged, m)
+		}
+	}
+	if err := client.ExecuteMigrations(ctx, merged, -1, migrationTable, PriorityTypeUnspecified, nil); err != nil {
+		t.Fatalf("failed to execute migration: %v", err)
+	}
+
+	ensureMigrationVersionRecord(t, ctx, client, 4, false)
+
+	if err := client.ExecuteMigrations(ctx, migrations, 1, migrationTable, PriorityTypeUnspecified, nil, WithAllowOutOfOrder()); err != nil {
+		t.Fatalf("failed to execute migration: %v", err)
+	}
+
+	// the database version must not go backward.
+	ensureMigrationVersionRecord(t, ctx, client, 4, false)
+
+	history, err := client.GetMigrationHistory(ctx, migrationTable)
+	if err != nil {
+		t.Fatalf("failed to get migration history: %v", err)
+	}
+
+	var versions []uint
+	for _, h := range history {
+		versions = append(versions, h.Version)
+	}
+	if want, got := fmt.Sprint([]uint{2, 3, 4}), fmt.Sprint(versions); want != got {
+		t.Errorf("want %s, but got %s", want, got)
+	}
+
+	// 000006.sql fails out of order, and the database version stays at 7 while it is dirty.
+	failed := &Migration{Version: 6, Name: "failed", FileName: "000006_failed.sql", Statements: []string{"CREATE TABLE Invalid"}, kind: statementKindDDL}
+	latest := &Migration{Version: 7, Name: "latest", FileName: "000007_latest.sql", Statements: []string{"CREATE TABLE Latest (ID INT64) PRIMARY KEY(ID)"}, kind: statementKindDDL}
+	merged = append(migrations[:4:4], latest)
+	if err := client.ExecuteMigrations(ctx, merged, -1, migrationTable, PriorityTypeUnspecified, nil); err != nil {
+		t.Fatalf("failed to execute migration: %v", err)
+	}
+	merged = append(migrations[:4:4], failed, latest)
+	if err := client.ExecuteMigrations(ctx, merged, -1, migrationTable, PriorityTypeUnspecified, nil, WithAllowOutOfOrder()); err == nil {
+		t.Fatal("want error, but got nil")
+	}
+
+	ensureMigrationVersionRecord(t, ctx, client, 7, true)
+
+	d, err := client.InspectDirtyMigration(ctx, merged, migrationTable)
+	if err != nil {
+		t.Fatalf("failed to inspect dirty migration: %v", err)
+	}
+	if want, got := uint(6), d.Migration.Version; want != got {
+		t.Errorf("want %d, but got %d", want, got)
+	}
+
+	if err := client.MarkDirtyMigrationClean(ctx, migrationTable); err != nil {
+		t.Fatalf("failed to mark dirty migration clean: %v", err)
+	}
+
+	ensureMigrationVersionRecord(t, ctx, client, 7, false)
+}
+
+func TestExecuteMigrationsWithEnvironment(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, done := testClientWithDatabase(t, ctx)
+	defer done()
+
+	migrations, err := ReadMigrations(ctx, "testdata/migrations")
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+
+	// 000005.sql inserts a seed row only in dev.
+	migrations[len(migrations)-1].Envs = []string{"dev"}
+
+	if err := client.ExecuteMigrations(ctx, migrations, -1, migrationTable, PriorityTypeUnspecified, nil); err == nil {
+		t.Fatal("want error without the environment, but got nil")
+	}
+
+	if err := client.ExecuteMigrations(ctx, migrations, -1, migrationTable, PriorityTypeUnspecified, nil, WithEnvironment("prod")); err != nil {
+		t.Fatalf("failed to execute migration: %v", err)
+	}
+
+	ensureMigrationVersionRecord(t, ctx, client, 5, false)
+
+	history, err := client.GetMigrationHistory(ctx, migrationTable)
+	if err != nil {
+		t.Fatalf("failed to get migration history: %v", err)
+	}
+	if h := history[len(history)-1]; h.Version != 5 || !h.Skipped {
+		t.Errorf("want version 5 recorded as skipped, but got %+v", h)
+	}
+	for _, h := range history[:len(history)-1] {
+		if h.Skipped {
+			t.Errorf("want version %d not skipped", h.Version)
+		}
+	}
+
+	status, err := client.GetMigrationStatus(ctx, migrations, migrationTable, WithEnvironment("dev"))
+	if err != nil {
+		t.Fatalf("failed to get migration status: %v", err)
+	}
+	if n := status.Count(MigrationStateSkipped); n != 1 {
+		t.Errorf("skipped migrations want 1, but got %d", n)
+	}
+
+	// The down migration of the skipped migration is not applied.
+	if err := client.RollbackMigrations(ctx, migrations, 1, migrationTable, PriorityTypeUnspecified, nil); err != nil {
+		t.Fatalf("failed to rollback migration: %v", err)
+	}
+
+	ensureMigrationVersionRecord(t, ctx, client, 4, false)
+}
+
+func TestExecuteMigrationsWithHooks(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, done := testClientWithDatabase(t, ctx)
+	defer done()
+
+	migrations, err := ReadMigrations(ctx, "testdata/migrations")
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+
+	var (
+		calls  []string
+		runErr error
+	)
+	hooks := MigrationHooks{
+		BeforeRun: func(_ context.Context, pending Migrations) error {
+			calls = append(calls, fmt.Sprintf("before run %d", len(pending)))
+			return nil
+		},
+		AfterRun: func(_ context.Context, applied Migrations, err error) error {
+			calls = append(calls, fmt.Sprintf("after run %d", len(applied)))
+			runErr = err
+			return nil
+		},
+		BeforeMigration: func(_ context.Context, m *Migration) error {
+			calls = append(calls, fmt.Sprintf("before %d", m.Version))
+			if m.Version == 4 {
+				return errors.New("aborted")
+			}
+			return nil
+		},
+		AfterMigration: func(_ context.Context, m *Migration) error {
+			calls = append(calls, fmt.Sprintf("after %d", m.Version))
+			return nil
+		},
+	}
+
+	if err := client.ExecuteMigrations(ctx, migrations, -1, migrationTable, PriorityTypeUnspecified, nil, WithHooks(hooks)); err == nil {
+		t.Fatal("want error by the hook, but got nil")
+	}
+
+	want := []string{"before run 4", "before 2", "after 2", "before 3", "after 3", "before 4", "after run 2"}
+	if fmt.Sprint(want) != fmt.Sprint(calls) {
+		t.Errorf("want hooks %v called, but got %v", want, calls)
+	}
+	if runErr == nil {
+		t.Error("want the error of the run given to the after run hook, but got nil")
+	}
+
+	// the migration aborted by the hook is not applied.
+	ensureMigrationVersionRecord(t, ctx, client, 3, false)
+}
+
+func TestExecuteMigrationsEvents(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, done := testClientWithDatabase(t, ctx)
+	defer done()
+
+	var events []string
+	client.config.Observer = ObserverFunc(func(e Event) {
+		switch e.Type {
+		case EventRunStarted, EventRunFinished:
+			events = append(events, fmt.Sprintf("%s %s %d", e.Type, e.Direction, e.Count))
+		case EventMigrationFinished, EventDirtySet, EventDirtyCleared:
+			events = append(events, fmt.Sprintf("%s %d", e.Type, e.Version))
+		}
+	})
+
+	migrations, err := ReadMigrations(ctx, "testdata/migrations")
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+
+	if err := client.ExecuteMigrations(ctx, migrations, 3, migrationTable, PriorityTypeUnspecified, nil); err != nil {
+		t.Fatalf("failed to execute migration: %v", err)
+	}
+	if err := client.RollbackMigrations(ctx, migrations, 1, migrationTable, PriorityTypeUnspecified, nil); err != nil {
+		t.Fatalf("failed to rollback migration: %v", err)
+	}
+
+	want := []string{
+		"run_started up 3",
+		"dirty_set 2", "dirty_cleared 2", "migration_finished 2",
+		"dirty_set 3", "dirty_cleared 3", "migration_finished 3",
+		"dirty_set 4", "dirty_cleared 4", "migration_finished 4",
+		"run_finished up 3",
+		"run_started down 1",
+		"dirty_set 4", "dirty_cleared 4", "migration_finished 4",
+		"run_finished down 1",
+	}
+	if fmt.Sprint(want) != fmt.Sprint(events) {
+		t.Errorf("want events %v, but got %v", want, events)
+	}
+}
+
+func TestExecuteRepeatableMigrations(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, done := testClientWithDatabase(t, ctx)
+	defer done()
+
+	migrations, err := ReadMigrations(ctx, "testdata/migrations")
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+
+	view := &RepeatableMigration{
+		Name:       "views",
+		FileName:   "R_views.sql",
+		Statements: []string{"CREATE OR REPLACE VIEW SingerNames SQL SECURITY INVOKER AS SELECT Singers.FirstName FROM Singers"},
+		kind:       statementKindDDL,
+	}
+
+	if err := client.ExecuteMigrations(ctx, migrations, -1, migrationTable, PriorityTypeUnspecified, nil, WithRepeatableMigrations([]*RepeatableMigration{view})); err != nil {
+		t.Fatalf("failed to execute migration: %v", err)
+	}
+
+	pending, err := client.PendingRepeatableMigrations(ctx, []*RepeatableMigration{view}, migrationTable)
+	if err != nil {
+		t.Fatalf("failed to get pending repeatable migrations: %v", err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("pending repeatable migrations want 0, but got %d", len(pending))
+	}
+
+	// The changed migration is applied again.
+	changed := *view
+	changed.Statements = []string{"CREATE OR REPLACE VIEW SingerNames SQL SECURITY INVOKER AS SELECT Singers.SingerID, Singers.FirstName FROM Singers"}
+	pending, err = client.PendingRepeatableMigrations(ctx, []*RepeatableMigration{&changed}, migrationTable)
+	if err != nil {
+		t.Fatalf("failed to get pending repeatable migrations: %v", err)
+	}
+	if len(pending) != 1 {
+		t.Fatalf("pending repeatable migrations want 1, but got %d", len(pending))
+	}
+
+	if err := client.ExecuteMigrations(ctx, migrations, -1, migrationTable, PriorityTypeUnspecified, nil, WithRepeatableMigrations([]*RepeatableMigration{&changed})); err != nil {
+		t.Fatalf("failed to execute migration: %v", err)
+	}
+
+	pending, err = client.PendingRepeatableMigrations(ctx, []*RepeatableMigration{&changed}, migrationTable)
+	if err != nil {
+		t.Fatalf("failed to get pending repeatable migrations: %v", err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("pending repeatable migrations want 0, but got %d", len(pending))
+	}
+}
+
+func TestPlanMigrations(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, done := testClientWithDatabase(t, ctx)
+	defer done()
+
+	migrations, err := ReadMigrations(ctx, "testdata/migrations")
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+
+	if err := client.ExecuteMigrations(ctx, migrations, 1, migrationTable, PriorityTypeUnspecified, nil); err != nil {
+		t.Fatalf("failed to execute migration: %v", err)
+	}
+
+	plan, err := client.PlanMigrations(ctx, migrations, 2, migrationTable)
+	if err != nil {
+		t.Fatalf("failed to plan migrations: %v", err)
+	}
+
+	if want, got := uint(2), plan.SourceVersion; want != got {
+		t.Errorf("want %d, but got %d", want, got)
+	}
+	if len(plan.Migrations) != 2 {
+		t.Fatalf("want 2 migrations, but got %d", len(plan.Migrations))
+	}
+	if want, got := "PartitionedDML", plan.Migrations[0].Kind; want != got {
+		t.Errorf("want %s, but got %s", want, got)
+	}
+	if want, got := `UPDATE Singers SET LastName = "" WHERE LastName IS NULL`, plan.Migrations[0].Statements[0]; want != got {
+		t.Errorf("want %s, but got %s", want, got)
+	}
+
+	// ensure that the database is not changed.
+	ensureMigrationVersionRecord(t, ctx, client, 2, false)
+
+	// ensure that a database without the migration table can be planned without creating the table.
+	plan, err = client.PlanMigrations(ctx, migrations, -1, "SchemaMigrations2")
+	if err != nil {
+		t.Fatalf("failed to plan migrations: %v", err)
+	}
+	if len(plan.Migrations) != len(migrations) {
+		t.Errorf("want %d migrations, but got %d", len(migrations), len(plan.Migrations))
+	}
+	if exists, err := client.tableExists(ctx, "SchemaMigrations2"); err != nil || exists {
+		t.Errorf("want the migration table not to be created, but got exists: %t, err: %v", exists, err)
+	}
+}
+
+func TestApplyMigrationPlan(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, done := testClientWithDatabase(t, ctx)
+	defer done()
+
+	migrations, err := ReadMigrations(ctx, "testdata/migrations")
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+
+	plan, err := client.PlanMigrations(ctx, migrations, 1, migrationTable)
+	if err != nil {
+		t.Fatalf("failed to plan migrations: %v", err)
+	}
+
+	if err := client.ApplyMigrationPlan(ctx, plan, migrations, migrationTable, PriorityTypeUnspecified, nil); err != nil {
+		t.Fatalf("failed to apply migration plan: %v", err)
+	}
+
+	ensureMigrationVersionRecord(t, ctx, client, 2, false)
+
+	// the database version has been changed since the plan was made.
+	if err := client.ApplyMigrationPlan(ctx, plan, migrations, migrationTable, PriorityTypeUnspecified, nil); err == nil {
+		t.Error("want error, but got nil")
+	}
+
+	ensureMigrationVersionRecord(t, ctx, client, 2, false)
+}
+
+func TestApplyMigrationPlanWithRepeatableMigrations(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, done := testClientWithDatabase(t, ctx)
+	defer done()
+
+	migrations, err := ReadMigrations(ctx, "testdata/migrations")
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+
+	view := &RepeatableMigration{
+		Name:       "views",
+		FileName:   "R_views.sql",
+		Statements: []string{"CREATE OR REPLACE VIEW SingerNames SQL SECURITY INVOKER AS SELECT Singers.FirstName FROM Singers"},
+		kind:       statementKindDDL,
+	}
+	opts := []MigrationOption{WithRepeatableMigrations([]*RepeatableMigration{view})}
+
+	plan, err := client.PlanMigrations(ctx, migrations, -1, migrationTable, opts...)
+	if err != nil {
+		t.Fatalf("failed to plan migrations: %v", err)
+	}
+	if len(plan.Repeatable) != 1 || plan.Repeatable[0].Checksum != view.Checksum() {
+		t.Fatalf("want the repeatable migration to be planned, but got %+v", plan.Repeatable)
+	}
+
+	// the repeatable migration has been edited since the plan was made.
+	changed := *view
+	changed.Statements = []string{"CREATE OR REPLACE VIEW SingerNames SQL SECURITY INVOKER AS SELECT Singers.LastName FROM Singers"}
+	if err := client.ApplyMigrationPlan(ctx, plan, migrations, migrationTable, PriorityTypeUnspecified, nil, WithRepeatableMigrations([]*RepeatableMigration{&changed})); err == nil {
+		t.Error("want error, but got nil")
+	}
+
+	if err := client.ApplyMigrationPlan(ctx, plan, migrations, migrationTable, PriorityTypeUnspecified, nil, opts...); err != nil {
+		t.Fatalf("failed to apply migration plan: %v", err)
+	}
+
+	pending, err := client.PendingRepeatableMigrations(ctx, []*RepeatableMigration{view}, migrationTable)
+	if err != nil {
+		t.Fatalf("failed to get pending repeatable migrations: %v", err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("pending repeatable migrations want 0, but got %d", len(pending))
+	}
+}
+
+func TestMigrationLock(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, done := testClientWithDatabase(t, ctx)
+	defer done()
+
+	opts := LockOptions{Wait: 0, Lease: time.Minute}
+
+	lock, err := client.AcquireMigrationLock(ctx, migrationTable, opts)
+	if err != nil {
+		t.Fatalf("failed to acquire migration lock: %v", err)
+	}
+
+	_, err = client.AcquireMigrationLock(ctx, migrationTable, opts)
+	var se *Error
+	if !errors.As(err, &se) || se.Code != ErrorCodeMigrationLocked {
+		t.Fatalf("want ErrorCodeMigrationLocked, but got %v", err)
+	}
+
+	migrations, err := ReadMigrations(ctx, "testdata/migrations")
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	if err := client.ExecuteMigrations(ctx, migrations, 1, migrationTable, PriorityTypeUnspecified, nil, WithLockOptions(opts)); err == nil {
+		t.Error("want error, but got nil")
+	}
+
+	if err := lock.Release(ctx); err != nil {
+		t.Fatalf("failed to release migration lock: %v", err)
+	}
+	if err := lock.Err(); err != nil {
+		t.Errorf("want no error, but got %v", err)
+	}
+
+	// the lock left by a process which is gone can be released by anyone.
+	if _, err := client.AcquireMigrationLock(ctx, migrationTable, opts); err != nil {
+		t.Fatalf("failed to acquire migration lock: %v", err)
+	}
+	if err := client.ForceReleaseMigrationLock(ctx, migrationTable); err != nil {
+		t.Fatalf("failed to force release migration lock: %v", err)
+	}
+
+	if err := client.ExecuteMigrations(ctx, migrations, 1, migrationTable, PriorityTypeUnspecified, nil, WithLockOptions(opts)); err != nil {
+		t.Fatalf("failed to execute migration: %v", err)
+	}
+
+	ensureMigrationVersionRecord(t, ctx, client, 2, false)
+}
+
+func TestResumeDirtyMigration(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, done := testClientWithDatabase(t, ctx)
+	defer done()
+
+	migrations, err := ReadMigrations(ctx, "testdata/migrations")
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+
+	// 000002.sql failed before its statement was applied.
+	if err := client.SetSchemaMigrationVersion(ctx, 2, true, migrationTable); err != nil {
+		t.Fatalf("failed to set migration version: %v", err)
+	}
+
+	d, err := client.InspectDirtyMigration(ctx, migrations, migrationTable)
+	if err != nil {
+		t.Fatalf("failed to inspect dirty migration: %v", err)
+	}
+
+	if want, got := uint(2), d.Migration.Version; want != got {
+		t.Errorf("want %d, but got %d", want, got)
+	}
+	if len(d.Statements) != 1 {
+		t.Fatalf("statements length want 1, but got %d", len(d.Statements))
+	}
+	if want, got := StatementStateNotApplied, d.Statements[0].State; want != got {
+		t.Errorf("want %s, but got %s", want, got)
+	}
+
+	if err := client.ResumeDirtyMigration(ctx, migrations, migrationTable, PriorityTypeUnspecified, nil); err != nil {
+		t.Fatalf("failed to resume dirty migration: %v", err)
+	}
+
+	ensureMigrationColumn(t, ctx, client, "LastName", "STRING(MAX)", "YES")
+	ensureMigrationVersionRecord(t, ctx, client, 2, false)
+
+	if _, err := client.InspectDirtyMigration(ctx, migrations, migrationTable); err == nil {
+		t.Error("want error, but got nil")
+	}
+}
+
+func TestExecuteMixedMigration(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, done := testClientWithDatabase(t, ctx)
+	defer done()
+
+	m := &Migration{
+		Version:  1,
+		FileName: "000001.sql",
+		Statements: []string{
+			"ALTER TABLE Singers ADD COLUMN Nickname STRING(MAX)",
+			"INSERT INTO Singers (SingerID, FirstName) VALUES ('1', 'Foo')",
+			"UPDATE Singers SET Nickname = FirstName WHERE true",
+			"INSERT INTO Missing (ID) VALUES (1)",
+		},
+		Directives: MigrationDirectives{Mixed: true},
+		kind:       statementKindMixed,
+	}
+
+	// The last step fails, so that the migration is resumed from it.
+	if err := client.ExecuteMigrations(ctx, Migrations{m}, -1, migrationTable, PriorityTypeUnspecified, nil); err == nil {
+		t.Fatal("want error, but got nil")
+	}
+
+	ensureMigrationColumn(t, ctx, client, "Nickname", "STRING(MAX)", "YES")
+	ensureMigrationVersionRecord(t, ctx, client, 1, true)
+
+	d, err := client.InspectDirtyMigration(ctx, Migrations{m}, migrationTable)
+	if err != nil {
+		t.Fatalf("failed to inspect dirty migration: %v", err)
+	}
+
+	want := []StatementState{StatementStateApplied, StatementStateApplied, StatementStateApplied, StatementStateNotApplied}
+	for i, s := range d.Statements {
+		if want[i] != s.State {
+			t.Errorf("statement #%d want %s, but got %s", i+1, want[i], s.State)
+		}
+	}
+
+	fixed := *m
+	fixed.Statements = append(append([]string{}, m.Statements[:3]...), "INSERT INTO Singers (SingerID, FirstName) VALUES ('2', 'Bar')")
+	if err := client.ResumeDirtyMigration(ctx, Migrations{&fixed}, migrationTable, PriorityTypeUnspecified, nil); err != nil {
+		t.Fatalf("failed to resume dirty migration: %v", err)
+	}
+
+	ensureMigrationVersionRecord(t, ctx, client, 1, false)
+
+	// The first INSERT must not be replayed, which would fail by the duplicated key.
+	iter := client.spannerClient.Single().Query(ctx, spanner.Statement{SQL: "SELECT COUNT(*) FROM Singers"})
+	defer iter.Stop()
+	row, err := iter.Next()
+	if err != nil {
+		t.Fatalf("failed to count singers: %v", err)
+	}
+	var count int64
+	if err := row.Columns(&count); err != nil {
+		t.Fatalf("failed to count singers: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("want 2 singers, but got %d", count)
+	}
+}
+
+func TestMarkDirtyMigrationClean(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, done := testClientWithDatabase(t, ctx)
+	defer done()
+
+	if err := client.SetSchemaMigrationVersion(ctx, 2, true, migrationTable); err != nil {
+		t.Fatalf("failed to set migration version: %v", err)
+	}
+
+	if err := client.MarkDirtyMigrationClean(ctx, migrationTable); err != nil {
+		t.Fatalf("failed to mark dirty migration clean: %v", err)
+	}
+
+	ensureMigrationVersionRecord(t, ctx, client, 2, false)
+
+	if err := client.MarkDirtyMigrationClean(ctx, migrationTable); err == nil {
+		t.Error("want error, but got nil")
+	}
+}
+
 func TestPriorityPBOf(t *testing.T) {
 	t.Parallel()
 	tests := map[string]struct {
@@ -31,6 +31,21 @@ type Config struct {
 	Database        string
 	CredentialsFile string
 
+	// WrenchVersion is the version of wrench, recorded in the migration history table.
+	WrenchVersion string
+
+	// Operator is the identity of who applies migrations, recorded in the migration history table.
+	// If empty, the OS user name and the host name are recorded.
+	Operator string
+
+	// MaxMutations is the limit of the estimated mutations of a transaction, over which the INSERT statements of
+	// a DML file or migration are split into multiple transactions. If zero, DefaultMaxMutations is used.
+	MaxMutations int
+
+	// Observer receives the progress of the migrations and the statements applied by the client.
+	// If nil, the progress is not reported.
+	Observer Observer
+
 	// ClientOptions is options of Spanner clients when creating the clients for both normal
 	// and admin. This options are evaluated first and can be overridden by other
 	// configurations in Wrench.
@@ -39,6 +54,10 @@ type Config struct {
 	ClientOptions []option.ClientOption
 }
 
+// DefaultMaxMutations is a quarter of the limit of the mutations of a commit in Cloud Spanner, 80,000,
+// which leaves room for the mutations of the secondary indexes not counted by the estimation.
+const DefaultMaxMutations = 20000
+
 func (c *Config) URL() string {
 	return fmt.Sprintf(
 		"projects/%s/instances/%s/databases/%s",
@@ -47,3 +66,10 @@ func (c *Config) URL() string {
 		c.Database,
 	)
 }
+
+func (c *Config) maxMutations() int {
+	if c.MaxMutations > 0 {
+		return c.MaxMutations
+	}
+	return DefaultMaxMutations
+}
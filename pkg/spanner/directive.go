@@ -0,0 +1,227 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package spanner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// directivePrefix is the prefix of the header comments recognized as directives. e.g. -- wrench:priority=low
+const directivePrefix = "wrench:"
+
+// MigrationDirectives are the per-migration options given by the header comments of a migration file,
+// which override the ones given to ExecuteMigrations.
+//
+//	-- wrench:priority=low
+//	-- wrench:timeout=2h
+//	-- wrench:partitioned=false
+//	-- wrench:transaction-tag=backfill
+//	-- wrench:proto_descriptor=descriptors.pb
+//	-- wrench:mixed=true
+//	-- wrench:env=dev,test
+type MigrationDirectives struct {
+	// Priority is the request priority of the DML statements.
+	Priority PriorityType
+
+	// Timeout is the timeout of the migration, which replaces the timeout of the whole execution.
+	Timeout time.Duration
+
+	// Partitioned tells whether the DML statements are executed as partitioned DML.
+	// It is inferred from the statements if nil.
+	Partitioned *bool
+
+	// TransactionTag is the transaction tag of the DML statements, or the request tag of the partitioned DML statements.
+	TransactionTag string
+
+	// ProtoDescriptorFile is the proto descriptor file of the DDL statements, relative to the migrations directory.
+	ProtoDescriptorFile string
+
+	// Mixed allows DDL and DML statements in the same migration, which are applied in steps of the same kind.
+	Mixed bool
+
+	// Env are the environments which the migration is applied in. It is applied in every environment if empty.
+	Env []string
+
+	protoDescriptors []byte
+}
+
+// parseDirectives parses the directives in the leading comment lines of a migration file.
+// The lines after the first statement are not inspected, so they can be of any length, e.g. a minified INSERT statement.
+func parseDirectives(filename string, data []byte) (MigrationDirectives, error) {
+	var d MigrationDirectives
+
+	for rest := data; len(rest) > 0; {
+		var raw []byte
+		raw, rest, _ = bytes.Cut(rest, []byte("\n"))
+
+		line := strings.TrimSpace(string(raw))
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "--") {
+			break
+		}
+
+		comment := strings.TrimSpace(strings.TrimPrefix(line, "--"))
+		if !strings.HasPrefix(comment, directivePrefix) {
+			continue
+		}
+
+		key, value, ok := strings.Cut(strings.TrimPrefix(comment, directivePrefix), "=")
+		if !ok {
+			return d, fmt.Errorf("invalid directive \"%s\" in %s, it must be in the form of wrench:key=value", comment, filename)
+		}
+		if err := d.set(strings.TrimSpace(key), strings.TrimSpace(value)); err != nil {
+			return d, fmt.Errorf("invalid directive \"%s\" in %s: %w", comment, filename, err)
+		}
+	}
+
+	return d, nil
+}
+
+func (d *MigrationDirectives) set(key, value string) error {
+	switch strings.ReplaceAll(key, "_", "-") {
+	case "priority":
+		switch value {
+		case "high":
+			d.Priority = PriorityTypeHigh
+		case "medium":
+			d.Priority = PriorityTypeMedium
+		case "low":
+			d.Priority = PriorityTypeLow
+		default:
+			return fmt.Errorf("priority must be one of high, medium, or low")
+		}
+	case "timeout":
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		if timeout <= 0 {
+			return errors.New("timeout must be positive")
+		}
+		d.Timeout = timeout
+	case "partitioned":
+		partitioned, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		d.Partitioned = &partitioned
+	case "transaction-tag":
+		d.TransactionTag = value
+	case "mixed":
+		mixed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		d.Mixed = mixed
+	case "env":
+		envs, err := parseEnvs(value)
+		if err != nil {
+			return err
+		}
+		d.Env = envs
+	case "proto-descriptor":
+		if value == "" {
+			return errors.New("proto descriptor file must not be empty")
+		}
+		d.ProtoDescriptorFile = value
+	default:
+		return fmt.Errorf("unknown directive \"%s\"", key)
+	}
+	return nil
+}
+
+// IsZero reports whether no directive is given.
+func (d MigrationDirectives) IsZero() bool {
+	return d.Priority == PriorityTypeUnspecified && d.Timeout == 0 && d.Partitioned == nil &&
+		d.TransactionTag == "" && d.ProtoDescriptorFile == "" && !d.Mixed && len(d.Env) == 0
+}
+
+// kindOf returns the statement kind overridden by the partitioned directive,
+// and validates the directives are applicable to the kind.
+func (d MigrationDirectives) kindOf(kind statementKind) (statementKind, error) {
+	switch kind {
+	case statementKindMixed:
+		return kind, nil
+	case statementKindDDL:
+		if d.Priority != PriorityTypeUnspecified || d.Partitioned != nil || d.TransactionTag != "" {
+			return "", errors.New("priority, partitioned, and transaction-tag directives are not applicable to DDL")
+		}
+		return kind, nil
+	case statementKindDML, statementKindPartitionedDML:
+		if d.ProtoDescriptorFile != "" {
+			return "", errors.New("proto_descriptor directive is not applicable to DML")
+		}
+		if d.Partitioned == nil {
+			return kind, nil
+		}
+		if !*d.Partitioned {
+			return statementKindDML, nil
+		}
+		if kind == statementKindDML {
+			return "", errors.New("INSERT statements and transaction blocks cannot be executed as partitioned DML")
+		}
+		return statementKindPartitionedDML, nil
+	default:
+		return kind, nil
+	}
+}
+
+// priorityOr returns the priority directive, or priorityType if it is not given.
+func (d MigrationDirectives) priorityOr(priorityType PriorityType) PriorityType {
+	if d.Priority != PriorityTypeUnspecified {
+		return d.Priority
+	}
+	return priorityType
+}
+
+// protoDescriptorsOr returns the content of the proto descriptor file directive, or protoDescriptors if it is not given.
+func (d MigrationDirectives) protoDescriptorsOr(protoDescriptors []byte) []byte {
+	if d.ProtoDescriptorFile != "" {
+		return d.protoDescriptors
+	}
+	return protoDescriptors
+}
+
+// migrationContext returns the context to apply a migration with the timeout directive.
+// The timeout replaces the deadline of ctx, while the cancellation of ctx is still propagated.
+func migrationContext(ctx context.Context, d MigrationDirectives) (context.Context, context.CancelFunc) {
+	if d.Timeout == 0 {
+		return ctx, func() {}
+	}
+
+	mctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), d.Timeout)
+	stop := context.AfterFunc(ctx, func() {
+		if errors.Is(ctx.Err(), context.Canceled) {
+			cancel()
+		}
+	})
+	return mctx, func() {
+		stop()
+		cancel()
+	}
+}
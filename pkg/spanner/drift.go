@@ -0,0 +1,122 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package spanner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ChecksumDrift represents an applied migration whose file was edited or deleted after it was applied.
+type ChecksumDrift struct {
+	Version uint
+
+	// FileName is the file name recorded when the migration was applied.
+	FileName string
+
+	// AppliedChecksum is the checksum recorded when the migration was applied.
+	AppliedChecksum string
+
+	// LocalChecksum is the checksum of the local migration file. It is empty if the file was deleted.
+	LocalChecksum string
+}
+
+// Deleted reports whether the migration file was deleted.
+func (d *ChecksumDrift) Deleted() bool {
+	return d.LocalChecksum == ""
+}
+
+// ChecksumDriftError is the error returned when applied migrations were edited or deleted.
+type ChecksumDriftError struct {
+	Drifts []*ChecksumDrift
+}
+
+func (e *ChecksumDriftError) Error() string {
+	var b strings.Builder
+	b.WriteString("checksum drift detected in applied migrations:")
+	for _, d := range e.Drifts {
+		fileName := d.FileName
+		if fileName == "" {
+			fileName = "unknown file"
+		}
+
+		if d.Deleted() {
+			fmt.Fprintf(&b, "\n  version %d (%s): deleted", d.Version, fileName)
+		} else {
+			fmt.Fprintf(&b, "\n  version %d (%s): changed, applied checksum %s, local checksum %s", d.Version, fileName, d.AppliedChecksum, d.LocalChecksum)
+		}
+	}
+	return b.String()
+}
+
+// VerifyMigrations compares the checksums recorded in the migration history with migrations,
+// and returns an error wrapping *ChecksumDriftError if applied migrations were edited or deleted.
+// The versions recorded without checksums, e.g. by SetSchemaMigrationVersion, are not verified.
+func (c *Client) VerifyMigrations(ctx context.Context, migrations Migrations, tableName string) error {
+	history, err := c.GetMigrationHistory(ctx, tableName)
+	if err != nil {
+		return err
+	}
+
+	if drifts := checksumDrifts(history, migrations); len(drifts) > 0 {
+		return &Error{
+			Code: ErrorCodeMigrationChecksumDrift,
+			err:  &ChecksumDriftError{Drifts: drifts},
+		}
+	}
+
+	return nil
+}
+
+func checksumDrifts(history []*MigrationHistory, migrations Migrations) []*ChecksumDrift {
+	local := make(map[uint]*Migration, len(migrations))
+	for _, m := range migrations {
+		local[m.Version] = m
+	}
+
+	var drifts []*ChecksumDrift
+	for _, h := range history {
+		if h.Checksum == "" {
+			continue
+		}
+
+		m, ok := local[h.Version]
+		if !ok {
+			drifts = append(drifts, &ChecksumDrift{
+				Version:         h.Version,
+				FileName:        h.FileName,
+				AppliedChecksum: h.Checksum,
+			})
+			continue
+		}
+
+		if checksum := m.Checksum(); checksum != h.Checksum {
+			drifts = append(drifts, &ChecksumDrift{
+				Version:         h.Version,
+				FileName:        h.FileName,
+				AppliedChecksum: h.Checksum,
+				LocalChecksum:   checksum,
+			})
+		}
+	}
+
+	return drifts
+}
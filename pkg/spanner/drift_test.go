@@ -0,0 +1,87 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package spanner
+
+import "testing"
+
+func TestChecksumDrifts(t *testing.T) {
+	m1 := &Migration{Version: 1, FileName: "000001.sql", Statements: []string{"CREATE TABLE Foo (ID INT64) PRIMARY KEY(ID)"}}
+	m2 := &Migration{Version: 2, FileName: "000002.sql", Statements: []string{"CREATE TABLE Bar (ID INT64) PRIMARY KEY(ID)"}}
+	edited := &Migration{Version: 2, FileName: "000002.sql", Statements: []string{"CREATE TABLE Baz (ID INT64) PRIMARY KEY(ID)"}}
+
+	history := []*MigrationHistory{
+		// carried over from an older wrench version, so it is not verified.
+		{Version: 0},
+		{Version: 1, FileName: "000001.sql", Checksum: m1.Checksum()},
+		{Version: 2, FileName: "000002.sql", Checksum: m2.Checksum()},
+	}
+
+	tests := map[string]struct {
+		migrations Migrations
+		want       []*ChecksumDrift
+	}{
+		"no drift": {
+			migrations: Migrations{m1, m2},
+		},
+		"edited": {
+			migrations: Migrations{m1, edited},
+			want: []*ChecksumDrift{
+				{Version: 2, FileName: "000002.sql", AppliedChecksum: m2.Checksum(), LocalChecksum: edited.Checksum()},
+			},
+		},
+		"deleted": {
+			migrations: Migrations{m2},
+			want: []*ChecksumDrift{
+				{Version: 1, FileName: "000001.sql", AppliedChecksum: m1.Checksum()},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := checksumDrifts(history, test.migrations)
+			if len(got) != len(test.want) {
+				t.Fatalf("want %d drifts, but got %d", len(test.want), len(got))
+			}
+
+			for i := range got {
+				if *got[i] != *test.want[i] {
+					t.Errorf("want %+v, but got %+v", test.want[i], got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestChecksumDriftError(t *testing.T) {
+	err := &ChecksumDriftError{
+		Drifts: []*ChecksumDrift{
+			{Version: 1, FileName: "000001.sql", AppliedChecksum: "a"},
+			{Version: 2, FileName: "000002.sql", AppliedChecksum: "b", LocalChecksum: "c"},
+		},
+	}
+
+	want := `checksum drift detected in applied migrations:
+  version 1 (000001.sql): deleted
+  version 2 (000002.sql): changed, applied checksum b, local checksum c`
+	if got := err.Error(); want != got {
+		t.Errorf("want %s, but got %s", want, got)
+	}
+}
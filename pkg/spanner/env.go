@@ -0,0 +1,97 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package spanner
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// envNameRegex is the valid form of an environment name. e.g. dev
+var envNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_\-]+$`)
+
+// parseEnvs parses the comma separated environment names. e.g. dev,test
+func parseEnvs(value string) ([]string, error) {
+	var envs []string
+	for _, env := range strings.Split(value, ",") {
+		env = strings.TrimSpace(env)
+		if !envNameRegex.MatchString(env) {
+			return nil, fmt.Errorf("invalid environment name \"%s\"", env)
+		}
+		envs = append(envs, env)
+	}
+	return normalizeEnvs(envs), nil
+}
+
+// normalizeEnvs returns the sorted environment names without duplicates.
+func normalizeEnvs(envs []string) []string {
+	if len(envs) == 0 {
+		return nil
+	}
+
+	envs = slices.Clone(envs)
+	slices.Sort(envs)
+	return slices.Compact(envs)
+}
+
+// IsEnvScoped reports whether the migration is applied only in some environments.
+func (m *Migration) IsEnvScoped() bool {
+	return len(m.Envs) > 0
+}
+
+// InEnv reports whether the migration is applied in env. A migration which is not scoped to environments
+// is applied in every environment.
+func (m *Migration) InEnv(env string) bool {
+	return !m.IsEnvScoped() || slices.Contains(m.Envs, env)
+}
+
+// migrationEnvs returns the environments of the migration file given by its file name segment and its env directive.
+func migrationEnvs(filename, segment string, directives MigrationDirectives) ([]string, error) {
+	envs := directives.Env
+	if segment != "" {
+		fileEnvs, err := parseEnvs(segment)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file name %s: %w", filename, err)
+		}
+		envs = append(fileEnvs, envs...)
+	}
+	return normalizeEnvs(envs), nil
+}
+
+// verifyEnvironment verifies that env is given if any of pending migrations is scoped to environments,
+// so that the migrations for other environments are never applied by mistake.
+func verifyEnvironment(pending Migrations, env string) error {
+	if env != "" {
+		return nil
+	}
+
+	for _, m := range pending {
+		if m.IsEnvScoped() {
+			return &Error{
+				Code: ErrorCodeExecuteMigrations,
+				err:  fmt.Errorf("migration version %d is scoped to environments %s, the environment must be specified", m.Version, strings.Join(m.Envs, ", ")),
+			}
+		}
+	}
+
+	return nil
+}
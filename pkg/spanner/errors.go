@@ -19,7 +19,13 @@
 
 package spanner
 
-import "google.golang.org/grpc/status"
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"google.golang.org/grpc/status"
+)
 
 type ErrorCode int
 
@@ -41,6 +47,16 @@ const (
 	ErrorCodeWaitOperation
 	ErrorCodeCreateInstance
 	ErrorCodeDeleteInstance
+	ErrorCodeGetMigrationHistory
+	ErrorCodeMigrationChecksumDrift
+	ErrorCodeStaleMigrationPlan
+	ErrorCodeMigrationLocked
+	ErrorCodeRepairMigration
+	ErrorCodeMigrationHook
+	ErrorCodeMigrationNotDirty
+	ErrorCodeAcquireMigrationLock
+	ErrorCodeReleaseMigrationLock
+	ErrorCodeInvalidInput
 )
 
 type Error struct {
@@ -55,3 +71,90 @@ func (e *Error) Error() string {
 
 	return e.err.Error()
 }
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// StatementError is the error of the statement which Cloud Spanner failed to apply, wrapped in Error.
+type StatementError struct {
+	// Index is the 0-based index of the statement in the file if Position is known,
+	// otherwise in the statements given to ApplyDDL, ApplyDML or ApplyPartitionedDML.
+	Index int
+
+	// Statement is the failed statement.
+	Statement string
+
+	// Position is the position of the statement in the file, which is nil if the statements are not read from a file.
+	Position *StatementPosition
+
+	err error
+}
+
+func (e *StatementError) Error() string {
+	msg := e.err.Error()
+	if st, ok := status.FromError(e.err); ok {
+		msg = st.Message()
+	}
+
+	if e.Position != nil {
+		return fmt.Sprintf("statement #%d at %s: %s", e.Index+1, e.Position, msg)
+	}
+	return fmt.Sprintf("statement #%d: %s", e.Index+1, msg)
+}
+
+func (e *StatementError) Unwrap() error {
+	return e.err
+}
+
+// StatementPosition is the position of a statement in its file.
+type StatementPosition struct {
+	FileName string
+
+	// Line and Column are 1-based.
+	Line   int
+	Column int
+
+	// Excerpt is the line at the position with a caret under the start of the statement.
+	Excerpt string
+}
+
+func (p *StatementPosition) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.FileName, p.Line, p.Column)
+}
+
+// statementError wraps err of the index-th statement of statements into StatementError.
+// err is returned as it is if the index is out of statements, i.e. the failed statement is unknown.
+func statementError(err error, statements []string, index int) error {
+	if index < 0 || index >= len(statements) {
+		return err
+	}
+	return &StatementError{Index: index, Statement: statements[index], err: err}
+}
+
+// locateStatement sets the index and the position of the failed statement in err to the ones in statements read from a file.
+// The statement is found by its text unless the index already points to it, since it may have been applied
+// as a part of statements, e.g. a step or a transaction. The position is not set if the text is found more than once,
+// since it cannot tell which one failed. positions can be nil if the statements are not read from a file.
+func locateStatement(err error, statements []string, positions []StatementPosition) error {
+	var se *StatementError
+	if !errors.As(err, &se) {
+		return err
+	}
+
+	i := se.Index
+	if i >= len(statements) || statements[i] != se.Statement {
+		i = slices.Index(statements, se.Statement)
+		if i < 0 || slices.Index(statements[i+1:], se.Statement) >= 0 {
+			return err
+		}
+	}
+
+	se.Index = i
+	if i < len(positions) {
+		p := positions[i]
+		se.Position = &p
+	}
+
+	return err
+}
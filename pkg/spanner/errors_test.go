@@ -0,0 +1,142 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package spanner
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestToStatementsWithPositions(t *testing.T) {
+	data := []byte(`-- wrench: timeout=10m
+CREATE TABLE Singers (
+  SingerID STRING(36),
+) PRIMARY KEY(SingerID);
+
+  CREATE INDEX SingersByName ON Singers(Name); ALTER TABLE Singers ADD COLUMN Name STRING(MAX);
+`)
+
+	statements, positions, err := toStatementsWithPositions("000001_create_singers.sql", data)
+	if err != nil {
+		t.Fatalf("failed to split statements: %v", err)
+	}
+	if want, got := 3, len(statements); want != got {
+		t.Fatalf("want %d statements, but got %d", want, got)
+	}
+
+	want := []StatementPosition{
+		{FileName: "000001_create_singers.sql", Line: 2, Column: 1, Excerpt: "  2|  CREATE TABLE Singers (\n   |  ^"},
+		{FileName: "000001_create_singers.sql", Line: 6, Column: 3, Excerpt: "  6|    CREATE INDEX SingersByName ON Singers(Name); ALTER TABLE Singers ADD COLUMN Name STRING(MAX);\n   |    ^"},
+		{FileName: "000001_create_singers.sql", Line: 6, Column: 48, Excerpt: "  6|    CREATE INDEX SingersByName ON Singers(Name); ALTER TABLE Singers ADD COLUMN Name STRING(MAX);\n   |                                                 ^"},
+	}
+	if !reflect.DeepEqual(want, positions) {
+		t.Errorf("want %+v, but got %+v", want, positions)
+	}
+}
+
+func TestLocateStatement(t *testing.T) {
+	statements := []string{
+		"INSERT INTO Singers (SingerID) VALUES ('1')",
+		"BEGIN",
+		"INSERT INTO Singers (SingerID) VALUES ('2')",
+		"COMMIT",
+	}
+	positions := []StatementPosition{
+		{FileName: "dml.sql", Line: 1, Column: 1},
+		{FileName: "dml.sql", Line: 2, Column: 1},
+		{FileName: "dml.sql", Line: 3, Column: 1},
+		{FileName: "dml.sql", Line: 4, Column: 1},
+	}
+
+	// The statement failed at the first one of the transaction block.
+	cause := status.Error(codes.AlreadyExists, "Row [2] in table Singers already exists")
+	err := &Error{Code: ErrorCodeUpdateDML, err: statementError(cause, statements[2:3], 0)}
+
+	if got := locateStatement(err, statements, positions); got != err {
+		t.Fatalf("want the same error, but got %v", got)
+	}
+
+	var se *StatementError
+	if !errors.As(err, &se) {
+		t.Fatalf("want StatementError, but got %v", err)
+	}
+	if want, got := 2, se.Index; want != got {
+		t.Errorf("want index %d, but got %d", want, got)
+	}
+	if want, got := "statement #3 at dml.sql:3:1: Row [2] in table Singers already exists", err.Error(); want != got {
+		t.Errorf("want %q, but got %q", want, got)
+	}
+	if want, got := codes.AlreadyExists, status.Code(err); want != got {
+		t.Errorf("want code %s, but got %s", want, got)
+	}
+}
+
+func TestLocateRepeatedStatement(t *testing.T) {
+	statements := []string{
+		"BEGIN",
+		"UPDATE Singers SET Count = Count + 1 WHERE SingerID = '1'",
+		"COMMIT",
+		"BEGIN",
+		"UPDATE Singers SET Count = Count + 1 WHERE SingerID = '1'",
+		"COMMIT",
+	}
+	positions := []StatementPosition{
+		{FileName: "dml.sql", Line: 1, Column: 1},
+		{FileName: "dml.sql", Line: 2, Column: 1},
+		{FileName: "dml.sql", Line: 3, Column: 1},
+		{FileName: "dml.sql", Line: 4, Column: 1},
+		{FileName: "dml.sql", Line: 5, Column: 1},
+		{FileName: "dml.sql", Line: 6, Column: 1},
+	}
+
+	// Which of the same statements failed cannot be told from the text.
+	cause := status.Error(codes.FailedPrecondition, "Count overflow")
+	err := &Error{Code: ErrorCodeUpdateDML, err: statementError(cause, statements[4:5], 0)}
+
+	locateStatement(err, statements, positions)
+
+	var se *StatementError
+	if !errors.As(err, &se) {
+		t.Fatalf("want StatementError, but got %v", err)
+	}
+	if se.Position != nil {
+		t.Errorf("want no position, but got %v", se.Position)
+	}
+}
+
+func TestStatementErrorUnknown(t *testing.T) {
+	cause := errors.New("failed")
+
+	if got := statementError(cause, []string{"SELECT 1"}, 1); got != cause {
+		t.Errorf("want the cause for the index out of the statements, but got %v", got)
+	}
+	if got := locateStatement(cause, []string{"SELECT 1"}, nil); got != cause {
+		t.Errorf("want the cause without StatementError, but got %v", got)
+	}
+
+	err := statementError(cause, []string{"SELECT 1", "SELECT 2"}, 1)
+	if want, got := "statement #2: failed", err.Error(); want != got {
+		t.Errorf("want %q, but got %q", want, got)
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package spanner
+
+import "time"
+
+// EventType is the type of an Event.
+type EventType string
+
+const (
+	// EventRunStarted is emitted when the migrations start to be applied or rolled back. Count is the number of them.
+	EventRunStarted EventType = "run_started"
+
+	// EventRunFinished is emitted when the migrations are applied or rolled back, or failed with Err.
+	// Count is the number of the applied, rolled back and skipped migrations.
+	EventRunFinished EventType = "run_finished"
+
+	// EventMigrationStarted is emitted when a migration starts to be applied or rolled back.
+	EventMigrationStarted EventType = "migration_started"
+
+	// EventMigrationFinished is emitted when a migration is applied or rolled back, with its Duration.
+	EventMigrationFinished EventType = "migration_finished"
+
+	// EventMigrationSkipped is emitted when a migration scoped to other environments is recorded as skipped.
+	EventMigrationSkipped EventType = "migration_skipped"
+
+	// EventStatementApplied is emitted when a statement of a migration, of the schema given to CreateDatabase,
+	// of the DDL given to ApplyDDLFile, of the DML given to ApplyDML or of TruncateAllTables is applied.
+	// RowsAffected is the number of the rows affected by the DML statement.
+	EventStatementApplied EventType = "statement_applied"
+
+	// EventStepApplied is emitted when a step of a migration applied in steps, e.g. a mixed migration, is applied.
+	EventStepApplied EventType = "step_applied"
+
+	// EventTransactionCommitted is emitted when one of the transactions split from DML statements is committed.
+	EventTransactionCommitted EventType = "transaction_committed"
+
+	// EventDirtySet is emitted when the database is marked dirty at Version.
+	EventDirtySet EventType = "dirty_set"
+
+	// EventDirtyCleared is emitted when the dirty flag of Version is cleared.
+	EventDirtyCleared EventType = "dirty_cleared"
+
+	// EventOperationStarted is emitted when a long-running operation, e.g. a schema update, is started.
+	// Operation is the name of the operation.
+	EventOperationStarted EventType = "operation_started"
+)
+
+// MigrationDirection is the direction in which migrations are applied.
+type MigrationDirection string
+
+const (
+	MigrationDirectionUp   MigrationDirection = "up"
+	MigrationDirectionDown MigrationDirection = "down"
+)
+
+// Event is the progress of the migrations and the statements applied by Client.
+// The fields irrelevant to Type are left empty.
+type Event struct {
+	Type EventType
+
+	// Direction is the direction of the run or the migration.
+	Direction MigrationDirection
+
+	// Version, Name, FileName and Kind describe the migration.
+	Version  uint
+	Name     string
+	FileName string
+	Kind     string
+
+	// Repeatable tells the migration is a repeatable migration, which has no version.
+	Repeatable bool
+
+	// Statement is the applied statement, and RowsAffected is the number of the rows affected by it or the transaction.
+	Statement    string
+	RowsAffected int64
+
+	// Step is the 1-based number of the applied step or transaction out of Steps.
+	Step  int
+	Steps int
+
+	// Operation is the name of the started long-running operation.
+	Operation string
+
+	// Count is the number of the migrations of the run.
+	Count int
+
+	// Duration is how long the migration took.
+	Duration time.Duration
+
+	// Err is the error which the run failed with.
+	Err error
+}
+
+// Observer receives the events emitted by Client, e.g. to render the progress or to send it to a log.
+// OnEvent is called synchronously, so it should return quickly.
+type Observer interface {
+	OnEvent(e Event)
+}
+
+// ObserverFunc is an Observer implemented by a function.
+type ObserverFunc func(e Event)
+
+func (f ObserverFunc) OnEvent(e Event) {
+	f(e)
+}
+
+// emit sends e to the observer of the client if any.
+func (c *Client) emit(e Event) {
+	if c.config.Observer != nil {
+		c.config.Observer.OnEvent(e)
+	}
+}
+
+// emit sends e to the observer of the client if any.
+func (c *AdminClient) emit(e Event) {
+	if c.config.Observer != nil {
+		c.config.Observer.OnEvent(e)
+	}
+}
+
+func migrationEvent(typ EventType, direction MigrationDirection, m *Migration) Event {
+	return Event{
+		Type:      typ,
+		Direction: direction,
+		Version:   m.Version,
+		Name:      m.Name,
+		FileName:  m.FileName,
+		Kind:      m.Kind(),
+	}
+}
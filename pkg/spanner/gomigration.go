@@ -0,0 +1,99 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package spanner
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"cloud.google.com/go/spanner"
+)
+
+// GoMigrationFunc is a migration written in Go, which is given the Cloud Spanner client of the database.
+// It is for data migrations which need logic that SQL cannot express, e.g. transforming JSON values.
+type GoMigrationFunc func(ctx context.Context, client *spanner.Client) error
+
+// GoMigrationTxFunc is a migration written in Go, which is run in a read-write transaction.
+// It can be run more than once if the transaction is aborted, so it must not have side effects out of the transaction.
+type GoMigrationTxFunc func(ctx context.Context, tx *spanner.ReadWriteTransaction) error
+
+var (
+	goMigrationsMu sync.Mutex
+	goMigrations   = map[uint]*Migration{}
+)
+
+// RegisterMigration registers a Go migration of version named name, which is applied in version order
+// together with the migration files read by ReadMigrations. It is expected to be called from init
+// of a custom wrench binary, and panics if version is already registered or name is invalid.
+func RegisterMigration(version uint, name string, fn GoMigrationFunc) {
+	registerMigration(&Migration{Version: version, Name: name, goFunc: fn})
+}
+
+// RegisterTxMigration registers a Go migration run in a read-write transaction. See RegisterMigration.
+func RegisterTxMigration(version uint, name string, fn GoMigrationTxFunc) {
+	registerMigration(&Migration{Version: version, Name: name, goTxFunc: fn})
+}
+
+func registerMigration(m *Migration) {
+	if m.goFunc == nil && m.goTxFunc == nil {
+		panic(fmt.Sprintf("wrench: Go migration %d is nil", m.Version))
+	}
+	if m.Name != "" && !MigrationNameRegex.MatchString(m.Name) {
+		panic(fmt.Sprintf("wrench: invalid Go migration name %q", m.Name))
+	}
+
+	m.kind = statementKindGo
+
+	goMigrationsMu.Lock()
+	defer goMigrationsMu.Unlock()
+
+	if prev, ok := goMigrations[m.Version]; ok {
+		panic(fmt.Sprintf("wrench: Go migration %d is registered twice as %q and %q", m.Version, prev.Name, m.Name))
+	}
+	goMigrations[m.Version] = m
+}
+
+// registeredMigrations returns copies of the registered Go migrations.
+func registeredMigrations() Migrations {
+	goMigrationsMu.Lock()
+	defer goMigrationsMu.Unlock()
+
+	ms := make(Migrations, 0, len(goMigrations))
+	for _, m := range goMigrations {
+		copied := *m
+		ms = append(ms, &copied)
+	}
+	return ms
+}
+
+func (c *Client) runGoMigration(ctx context.Context, m *Migration) error {
+	if m.goTxFunc != nil {
+		if _, err := c.spannerClient.ReadWriteTransaction(ctx, m.goTxFunc); err != nil {
+			return &Error{
+				Code: ErrorCodeUpdateDML,
+				err:  err,
+			}
+		}
+		return nil
+	}
+
+	return m.goFunc(ctx, c.spannerClient)
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package spanner
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"cloud.google.com/go/spanner"
+
+	"github.com/cloudspannerecosystem/wrench/internal/fs"
+)
+
+func unregisterMigration(version uint) {
+	goMigrationsMu.Lock()
+	defer goMigrationsMu.Unlock()
+
+	delete(goMigrations, version)
+}
+
+func TestRegisterMigration(t *testing.T) {
+	RegisterMigration(2, "backfill", func(ctx context.Context, client *spanner.Client) error {
+		return nil
+	})
+	t.Cleanup(func() { unregisterMigration(2) })
+
+	RegisterTxMigration(4, "transform", func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+		return nil
+	})
+	t.Cleanup(func() { unregisterMigration(4) })
+
+	fsys := fstest.MapFS{
+		"migrations/000001.sql": {Data: []byte("CREATE TABLE Foo (ID INT64) PRIMARY KEY(ID);")},
+		"migrations/000003.sql": {Data: []byte("CREATE TABLE Bar (ID INT64) PRIMARY KEY(ID);")},
+	}
+	ctx := fs.WithContext(context.Background(), fsys)
+
+	ms, err := ReadMigrations(ctx, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantKinds := []string{"DDL", "Go", "DDL", "Go"}
+	if len(ms) != len(wantKinds) {
+		t.Fatalf("migrations length want %d, but got %d", len(wantKinds), len(ms))
+	}
+	for i, m := range ms {
+		if want, got := uint(i+1), m.Version; want != got {
+			t.Errorf("want version %d, but got %d", want, got)
+		}
+		if want, got := wantKinds[i], m.Kind(); want != got {
+			t.Errorf("version %d want kind %s, but got %s", m.Version, want, got)
+		}
+	}
+
+	versions, err := MigrationVersions(ctx, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint{1, 2, 3, 4}; !slices.Equal(versions, want) {
+		t.Errorf("want versions %v, but got %v", want, versions)
+	}
+
+	if ms[1].Checksum() == ms[3].Checksum() {
+		t.Errorf("checksums want to be different, but got %s", ms[1].Checksum())
+	}
+
+	fsys["migrations/000002.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE Baz (ID INT64) PRIMARY KEY(ID);")}
+	if _, err := ReadMigrations(ctx, "migrations"); err == nil {
+		t.Error("want error for the colliding version, but got nil")
+	}
+}
+
+func TestRegisterMigrationTwice(t *testing.T) {
+	RegisterMigration(100, "foo", func(ctx context.Context, client *spanner.Client) error {
+		return nil
+	})
+	t.Cleanup(func() { unregisterMigration(100) })
+
+	defer func() {
+		if recover() == nil {
+			t.Error("want panic, but got nil")
+		}
+	}()
+
+	RegisterMigration(100, "bar", func(ctx context.Context, client *spanner.Client) error {
+		return nil
+	})
+}
@@ -0,0 +1,494 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package spanner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+
+	"cloud.google.com/go/spanner"
+)
+
+// migrationHistoryTableSuffix is appended to the migration table name to name the migration history table.
+// The migration table keeps a single (Version, Dirty) row as before, so that older wrench versions
+// keep working with it, while the history table keeps one row per applied migration.
+const migrationHistoryTableSuffix = "History"
+
+// MigrationHistory represents a row of the migration history table.
+// The fields other than Version and Dirty are empty for the versions recorded by SetSchemaMigrationVersion
+// or carried over from a migration table created by an older wrench version.
+type MigrationHistory struct {
+	Version       uint
+	Dirty         bool
+	FileName      string
+	Checksum      string
+	StartedAt     time.Time
+	FinishedAt    time.Time
+	Duration      time.Duration
+	WrenchVersion string
+	AppliedBy     string
+	// Progress is the number of the statements of a dirty migration which are known to be applied.
+	// It is recorded only for the migrations applied in steps, e.g. mixed migrations.
+	Progress int
+	// Skipped tells the migration was not applied since it is scoped to other environments.
+	Skipped bool
+}
+
+type migrationHistoryRow struct {
+	Version        int64
+	Dirty          bool
+	FileName       spanner.NullString
+	Checksum       spanner.NullString
+	StartedAt      spanner.NullTime
+	FinishedAt     spanner.NullTime
+	DurationMillis spanner.NullInt64
+	WrenchVersion  spanner.NullString
+	AppliedBy      spanner.NullString
+	Progress       spanner.NullInt64
+	Skipped        spanner.NullBool
+}
+
+var migrationHistoryColumns = []string{
+	"Version",
+	"Dirty",
+	"FileName",
+	"Checksum",
+	"StartedAt",
+	"FinishedAt",
+	"DurationMillis",
+	"WrenchVersion",
+	"AppliedBy",
+	"Progress",
+	"Skipped",
+}
+
+// migrationHistoryAddedColumns are the columns added to the history table after it was introduced,
+// which are added to the history tables created by older wrench versions.
+var migrationHistoryAddedColumns = []struct {
+	name string
+	typ  string
+}{
+	{name: "Progress", typ: "INT64"},
+	{name: "Skipped", typ: "BOOL"},
+}
+
+func historyTableName(tableName string) string {
+	return tableName + migrationHistoryTableSuffix
+}
+
+// GetMigrationHistory returns the migration history recorded along with the migration table in version order.
+func (c *Client) GetMigrationHistory(ctx context.Context, tableName string) ([]*MigrationHistory, error) {
+	if err := c.ensureMigrationHistoryTable(ctx, tableName); err != nil {
+		return nil, err
+	}
+
+	return c.readMigrationHistory(ctx, tableName)
+}
+
+func (c *Client) readMigrationHistory(ctx context.Context, tableName string) ([]*MigrationHistory, error) {
+	var history []*MigrationHistory
+	iter := c.spannerClient.Single().Read(ctx, historyTableName(tableName), spanner.AllKeys(), migrationHistoryColumns)
+	err := iter.Do(func(row *spanner.Row) error {
+		r := &migrationHistoryRow{}
+		if err := row.ToStruct(r); err != nil {
+			return err
+		}
+
+		history = append(history, &MigrationHistory{
+			Version:       uint(r.Version),
+			Dirty:         r.Dirty,
+			FileName:      r.FileName.StringVal,
+			Checksum:      r.Checksum.StringVal,
+			StartedAt:     r.StartedAt.Time,
+			FinishedAt:    r.FinishedAt.Time,
+			Duration:      time.Duration(r.DurationMillis.Int64) * time.Millisecond,
+			WrenchVersion: r.WrenchVersion.StringVal,
+			AppliedBy:     r.AppliedBy.StringVal,
+			Progress:      int(r.Progress.Int64),
+			Skipped:       r.Skipped.Bool,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, &Error{
+			Code: ErrorCodeGetMigrationHistory,
+			err:  err,
+		}
+	}
+
+	return history, nil
+}
+
+// ensureMigrationHistoryTable creates the migration history table if it does not exist.
+// A newly created history table is seeded with the version recorded in the migration table,
+// so that databases migrated by older wrench versions are upgraded transparently.
+func (c *Client) ensureMigrationHistoryTable(ctx context.Context, tableName string) error {
+	c.mu.Lock()
+	ensured := c.historyTables[tableName]
+	c.mu.Unlock()
+	if ensured {
+		return nil
+	}
+
+	historyTable := historyTableName(tableName)
+
+	iter := c.spannerClient.Single().Read(ctx, historyTable, spanner.KeySets(), []string{"Version"})
+	err := iter.Do(func(r *spanner.Row) error {
+		return nil
+	})
+	if err != nil {
+		stmt := fmt.Sprintf("CREATE TABLE `%s` ("+`
+    Version        INT64 NOT NULL,
+    Dirty          BOOL NOT NULL,
+    FileName       STRING(MAX),
+    Checksum       STRING(64),
+    StartedAt      TIMESTAMP OPTIONS (allow_commit_timestamp=true),
+    FinishedAt     TIMESTAMP OPTIONS (allow_commit_timestamp=true),
+    DurationMillis INT64,
+    WrenchVersion  STRING(MAX),
+    AppliedBy      STRING(MAX),
+    Progress       INT64,
+    Skipped        BOOL
+	) PRIMARY KEY(Version)`, historyTable)
+
+		if err := c.ApplyDDL(ctx, []string{stmt}, nil); err != nil {
+			return err
+		}
+
+		if err := c.seedMigrationHistory(ctx, tableName); err != nil {
+			return err
+		}
+	} else {
+		for _, column := range migrationHistoryAddedColumns {
+			if err := c.ensureMigrationHistoryColumn(ctx, tableName, column.name, column.typ); err != nil {
+				return err
+			}
+		}
+	}
+
+	c.mu.Lock()
+	c.historyTables[tableName] = true
+	c.mu.Unlock()
+
+	return nil
+}
+
+// ensureMigrationHistoryColumn adds the column to a history table created by an older wrench version.
+func (c *Client) ensureMigrationHistoryColumn(ctx context.Context, tableName, column, typ string) error {
+	exists := func() bool {
+		iter := c.spannerClient.Single().Read(ctx, historyTableName(tableName), spanner.KeySets(), []string{column})
+		return iter.Do(func(r *spanner.Row) error {
+			return nil
+		}) == nil
+	}
+	if exists() {
+		return nil
+	}
+
+	stmt := fmt.Sprintf("ALTER TABLE `%s` ADD COLUMN %s %s", historyTableName(tableName), column, typ)
+	if err := c.ApplyDDL(ctx, []string{stmt}, nil); err != nil {
+		// Another process may have added the column at the same time.
+		if exists() {
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (c *Client) seedMigrationHistory(ctx context.Context, tableName string) error {
+	_, err := c.spannerClient.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+		var m []*spanner.Mutation
+		iter := tx.Read(ctx, tableName, spanner.AllKeys(), []string{"Version", "Dirty"})
+		err := iter.Do(func(row *spanner.Row) error {
+			var (
+				v     int64
+				dirty bool
+			)
+			if err := row.Columns(&v, &dirty); err != nil {
+				return err
+			}
+
+			m = append(m, spanner.InsertOrUpdate(historyTableName(tableName), []string{"Version", "Dirty"}, []interface{}{v, dirty}))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return tx.BufferWrite(m)
+	})
+	if err != nil {
+		return &Error{
+			Code: ErrorCodeSetMigrationVersion,
+			err:  err,
+		}
+	}
+
+	return nil
+}
+
+// startMigration marks the database dirty and records the start of m in the history table as dirty.
+// The database version is kept at the newest applied version if m is applied out of order,
+// so the dirty migration is told by the history, see dirtyMigrationVersion.
+// It returns the commit timestamp recorded as the start of m.
+func (c *Client) startMigration(ctx context.Context, tableName string, m *Migration) (time.Time, error) {
+	startedAt, err := c.spannerClient.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+		version, err := latestVersion(ctx, tx, tableName, m.Version)
+		if err != nil {
+			return err
+		}
+
+		return tx.BufferWrite([]*spanner.Mutation{
+			spanner.Delete(tableName, spanner.AllKeys()),
+			spanner.Insert(
+				tableName,
+				[]string{"Version", "Dirty"},
+				[]interface{}{int64(version), true},
+			),
+			spanner.InsertOrUpdate(
+				historyTableName(tableName),
+				migrationHistoryColumns,
+				[]interface{}{
+					int64(m.Version),
+					true,
+					m.FileName,
+					m.Checksum(),
+					spanner.CommitTimestamp,
+					spanner.NullTime{},
+					spanner.NullInt64{},
+					c.config.WrenchVersion,
+					c.operator(),
+					spanner.NullInt64{},
+					spanner.NullBool{},
+				},
+			),
+		})
+	})
+	if err != nil {
+		return time.Time{}, &Error{
+			Code: ErrorCodeSetMigrationVersion,
+			err:  err,
+		}
+	}
+
+	c.emit(Event{Type: EventDirtySet, Version: m.Version})
+
+	return startedAt, nil
+}
+
+// skipMigration records m as skipped in the history table without applying it, since it is scoped to other environments,
+// so that the version sequence stays consistent. The database version is kept at the newest applied version
+// if m is skipped out of order.
+func (c *Client) skipMigration(ctx context.Context, tableName string, m *Migration) error {
+	_, err := c.spannerClient.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+		version, err := latestVersion(ctx, tx, tableName, m.Version)
+		if err != nil {
+			return err
+		}
+
+		return tx.BufferWrite([]*spanner.Mutation{
+			spanner.Delete(tableName, spanner.AllKeys()),
+			spanner.Insert(
+				tableName,
+				[]string{"Version", "Dirty"},
+				[]interface{}{int64(version), false},
+			),
+			spanner.InsertOrUpdate(
+				historyTableName(tableName),
+				migrationHistoryColumns,
+				[]interface{}{
+					int64(m.Version),
+					false,
+					m.FileName,
+					m.Checksum(),
+					spanner.CommitTimestamp,
+					spanner.CommitTimestamp,
+					int64(0),
+					c.config.WrenchVersion,
+					c.operator(),
+					spanner.NullInt64{},
+					true,
+				},
+			),
+		})
+	})
+	if err != nil {
+		return &Error{
+			Code: ErrorCodeSetMigrationVersion,
+			err:  err,
+		}
+	}
+
+	return nil
+}
+
+// finishMigration clears the dirty flag of the version of m and records the end of m in the history table.
+// The database version is kept at the newest applied version if m is applied out of order.
+func (c *Client) finishMigration(ctx context.Context, tableName string, m *Migration, d time.Duration) error {
+	_, err := c.spannerClient.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+		version, err := latestVersion(ctx, tx, tableName, m.Version)
+		if err != nil {
+			return err
+		}
+
+		return tx.BufferWrite([]*spanner.Mutation{
+			spanner.Delete(tableName, spanner.AllKeys()),
+			spanner.Insert(
+				tableName,
+				[]string{"Version", "Dirty"},
+				[]interface{}{int64(version), false},
+			),
+			spanner.Update(
+				historyTableName(tableName),
+				[]string{"Version", "Dirty", "FinishedAt", "DurationMillis", "Progress"},
+				[]interface{}{int64(m.Version), false, spanner.CommitTimestamp, d.Milliseconds(), spanner.NullInt64{}},
+			),
+		})
+	})
+	if err != nil {
+		return &Error{
+			Code: ErrorCodeSetMigrationVersion,
+			err:  err,
+		}
+	}
+
+	c.emit(Event{Type: EventDirtyCleared, Version: m.Version})
+
+	return nil
+}
+
+// recordMigrationProgress records that the first n statements of the dirty migration of version are applied.
+func (c *Client) recordMigrationProgress(ctx context.Context, tableName string, version uint, n int) error {
+	_, err := c.spannerClient.Apply(ctx, []*spanner.Mutation{
+		migrationProgressMutation(tableName, version, n),
+	})
+	if err != nil {
+		return &Error{
+			Code: ErrorCodeSetMigrationVersion,
+			err:  err,
+		}
+	}
+
+	return nil
+}
+
+func migrationProgressMutation(tableName string, version uint, n int) *spanner.Mutation {
+	return spanner.Update(historyTableName(tableName), []string{"Version", "Progress"}, []interface{}{int64(version), int64(n)})
+}
+
+// markMigrationClean clears the dirty flag of version without recording the end of the migration.
+func (c *Client) markMigrationClean(ctx context.Context, tableName string, version uint) error {
+	_, err := c.spannerClient.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+		latest, err := latestVersion(ctx, tx, tableName, version)
+		if err != nil {
+			return err
+		}
+
+		return tx.BufferWrite([]*spanner.Mutation{
+			spanner.Delete(tableName, spanner.AllKeys()),
+			spanner.Insert(
+				tableName,
+				[]string{"Version", "Dirty"},
+				[]interface{}{int64(latest), false},
+			),
+			spanner.InsertOrUpdate(
+				historyTableName(tableName),
+				[]string{"Version", "Dirty", "Progress"},
+				[]interface{}{int64(version), false, spanner.NullInt64{}},
+			),
+		})
+	})
+	if err != nil {
+		return &Error{
+			Code: ErrorCodeSetMigrationVersion,
+			err:  err,
+		}
+	}
+
+	c.emit(Event{Type: EventDirtyCleared, Version: version})
+
+	return nil
+}
+
+// dirtyMigrationVersion returns the version of the dirty migration in history of the dirty database at version.
+// It is older than version if the migration was applied out of order, and it is version if history has no dirty migration,
+// e.g. the database was made dirty by an older wrench version or by SetSchemaMigrationVersion.
+func dirtyMigrationVersion(history []*MigrationHistory, version uint) uint {
+	var (
+		dirty uint
+		found bool
+	)
+	for _, h := range history {
+		if h.Dirty && (!found || h.Version > dirty) {
+			dirty, found = h.Version, true
+		}
+	}
+	if !found {
+		return version
+	}
+	return dirty
+}
+
+// latestVersion returns the newest version recorded in the history table, or version if it is newer.
+// It is the database version after a migration of version is applied, which can be older than the database version
+// if the migration is applied out of order.
+func latestVersion(ctx context.Context, tx *spanner.ReadWriteTransaction, tableName string, version uint) (uint, error) {
+	iter := tx.Query(ctx, spanner.Statement{
+		SQL: fmt.Sprintf("SELECT MAX(Version) FROM `%s`", historyTableName(tableName)),
+	})
+	defer iter.Stop()
+
+	row, err := iter.Next()
+	if err != nil {
+		return 0, err
+	}
+
+	var v spanner.NullInt64
+	if err := row.Columns(&v); err != nil {
+		return 0, err
+	}
+
+	if v.Valid && uint(v.Int64) > version {
+		return uint(v.Int64), nil
+	}
+	return version, nil
+}
+
+// operator returns the identity of who applies migrations.
+func (c *Client) operator() string {
+	if c.config.Operator != "" {
+		return c.config.Operator
+	}
+
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		name += "@" + host
+	}
+
+	return name
+}
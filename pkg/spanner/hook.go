@@ -0,0 +1,100 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package spanner
+
+import (
+	"context"
+	"fmt"
+)
+
+// MigrationHooks are the callbacks called around a run of ExecuteMigrations and each migration in it.
+// A hook returning an error aborts the run, leaving the migrations applied so far as they are.
+// Skipped migrations and repeatable migrations do not call the migration hooks.
+type MigrationHooks struct {
+	// BeforeRun is called with the pending migrations, including the ones to be skipped, before any of them is applied.
+	BeforeRun func(ctx context.Context, pending Migrations) error
+
+	// AfterRun is called with the applied migrations after the run, including the run which failed with err.
+	AfterRun func(ctx context.Context, applied Migrations, err error) error
+
+	// BeforeMigration is called before m is applied.
+	BeforeMigration func(ctx context.Context, m *Migration) error
+
+	// AfterMigration is called after m is applied and recorded.
+	AfterMigration func(ctx context.Context, m *Migration) error
+}
+
+// migrationHooks are the hooks given by WithHooks, which are called in the given order.
+type migrationHooks []MigrationHooks
+
+func (hs migrationHooks) beforeRun(ctx context.Context, pending Migrations) error {
+	for _, h := range hs {
+		if h.BeforeRun == nil {
+			continue
+		}
+		if err := h.BeforeRun(ctx, pending); err != nil {
+			return hookError("before run", err)
+		}
+	}
+	return nil
+}
+
+func (hs migrationHooks) afterRun(ctx context.Context, applied Migrations, runErr error) error {
+	for _, h := range hs {
+		if h.AfterRun == nil {
+			continue
+		}
+		if err := h.AfterRun(ctx, applied, runErr); err != nil {
+			return hookError("after run", err)
+		}
+	}
+	return nil
+}
+
+func (hs migrationHooks) beforeMigration(ctx context.Context, m *Migration) error {
+	for _, h := range hs {
+		if h.BeforeMigration == nil {
+			continue
+		}
+		if err := h.BeforeMigration(ctx, m); err != nil {
+			return hookError(fmt.Sprintf("before migration version %d", m.Version), err)
+		}
+	}
+	return nil
+}
+
+func (hs migrationHooks) afterMigration(ctx context.Context, m *Migration) error {
+	for _, h := range hs {
+		if h.AfterMigration == nil {
+			continue
+		}
+		if err := h.AfterMigration(ctx, m); err != nil {
+			return hookError(fmt.Sprintf("after migration version %d", m.Version), err)
+		}
+	}
+	return nil
+}
+
+func hookError(point string, err error) error {
+	return &Error{
+		Code: ErrorCodeMigrationHook,
+		err:  fmt.Errorf("hook %s failed: %w", point, err),
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package spanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestMigrationHooks(t *testing.T) {
+	ctx := context.Background()
+	m := &Migration{Version: 1}
+
+	var calls []string
+	record := func(name string, err error) func(context.Context, *Migration) error {
+		return func(context.Context, *Migration) error {
+			calls = append(calls, name)
+			return err
+		}
+	}
+
+	hooks := migrationHooks{
+		{BeforeMigration: record("first", nil)},
+		{AfterMigration: record("after", nil)},
+		{BeforeMigration: record("second", errors.New("aborted"))},
+		{BeforeMigration: record("third", nil)},
+	}
+
+	err := hooks.beforeMigration(ctx, m)
+
+	var se *Error
+	if !errors.As(err, &se) || se.Code != ErrorCodeMigrationHook {
+		t.Fatalf("want migration hook error, but got %v", err)
+	}
+	if want, got := fmt.Sprint([]string{"first", "second"}), fmt.Sprint(calls); want != got {
+		t.Errorf("want hooks %s called, but got %s", want, got)
+	}
+
+	if err := hooks.afterRun(ctx, nil, nil); err != nil {
+		t.Errorf("want no error without after run hooks, but got %v", err)
+	}
+}
@@ -0,0 +1,349 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package spanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/google/uuid"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	// migrationLockTableSuffix is appended to the migration table name to name the migration lock table.
+	migrationLockTableSuffix = "Lock"
+
+	// migrationLockID is the key of the single row of the migration lock table.
+	migrationLockID = 1
+
+	// lockRetryInterval is the interval to retry acquiring the lock held by another owner.
+	lockRetryInterval = time.Second
+
+	// lockReleaseTimeout bounds releasing the lock, which is done even after the context is done.
+	lockReleaseTimeout = 10 * time.Second
+)
+
+const (
+	DefaultLockWait  = time.Minute
+	DefaultLockLease = time.Minute
+)
+
+// LockOptions configures how the migration lock is acquired.
+type LockOptions struct {
+	// Wait is how long to wait for the lock held by another owner. It fails at once if Wait is zero.
+	Wait time.Duration
+	// Lease is how long the lock stays valid without being renewed.
+	// The lock is renewed every third of Lease while it is held, so it expires only if the owner dies.
+	Lease time.Duration
+}
+
+// DefaultLockOptions returns the LockOptions used when none is given.
+func DefaultLockOptions() LockOptions {
+	return LockOptions{
+		Wait:  DefaultLockWait,
+		Lease: DefaultLockLease,
+	}
+}
+
+// MigrationLock is a lease-based lock of the migration table, held in a row of the migration lock table.
+// It prevents concurrent wrench processes from applying the same migrations.
+type MigrationLock struct {
+	client    *Client
+	tableName string
+	owner     string
+	lease     time.Duration
+
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+func lockTableName(tableName string) string {
+	return tableName + migrationLockTableSuffix
+}
+
+// AcquireMigrationLock acquires the lock of the migration table named tableName, waiting up to opts.Wait
+// while another owner holds it. The returned lock is renewed in background until Release is called.
+func (c *Client) AcquireMigrationLock(ctx context.Context, tableName string, opts LockOptions) (*MigrationLock, error) {
+	if opts.Lease <= 0 {
+		opts.Lease = DefaultLockLease
+	}
+
+	if err := c.ensureMigrationLockTable(ctx, tableName); err != nil {
+		return nil, err
+	}
+
+	owner := fmt.Sprintf("%s/%s", c.operator(), uuid.NewString())
+	deadline := time.Now().Add(opts.Wait)
+	for {
+		holder, expiresAt, err := c.tryLock(ctx, tableName, owner, opts.Lease)
+		if err != nil {
+			// The lock is not known to be held, e.g. Cloud Spanner is unavailable, so it is not ErrorCodeMigrationLocked.
+			return nil, &Error{
+				Code: ErrorCodeAcquireMigrationLock,
+				err:  fmt.Errorf("failed to acquire migration lock: %w", err),
+			}
+		}
+		if holder == "" {
+			break
+		}
+
+		if !time.Now().Add(lockRetryInterval).Before(deadline) {
+			return nil, &Error{
+				Code: ErrorCodeMigrationLocked,
+				err:  fmt.Errorf("migration lock is held by %s until %s, run migrate unlock if the owner is gone", holder, expiresAt.Format(time.RFC3339)),
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, &Error{
+				Code: ErrorCodeMigrationLocked,
+				err:  fmt.Errorf("failed to acquire migration lock held by %s: %w", holder, ctx.Err()),
+			}
+		case <-time.After(lockRetryInterval):
+		}
+	}
+
+	hctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	l := &MigrationLock{
+		client:    c,
+		tableName: tableName,
+		owner:     owner,
+		lease:     opts.Lease,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+	go l.heartbeat(hctx)
+
+	return l, nil
+}
+
+// Err returns a non-nil error if the lock has been lost, that is, it could not be renewed before it expired.
+func (l *MigrationLock) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.err
+}
+
+// Release stops renewing the lock and releases it. It is done even if ctx is already done,
+// so that the lock is released after the migrations are canceled.
+func (l *MigrationLock) Release(ctx context.Context) error {
+	l.cancel()
+	<-l.done
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), lockReleaseTimeout)
+	defer cancel()
+
+	_, err := l.client.spannerClient.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+		_, err := tx.Update(ctx, spanner.Statement{
+			SQL:    fmt.Sprintf("DELETE FROM `%s` WHERE ID = @id AND Owner = @owner", lockTableName(l.tableName)),
+			Params: map[string]interface{}{"id": int64(migrationLockID), "owner": l.owner},
+		})
+		return err
+	})
+	if err != nil {
+		return &Error{
+			Code: ErrorCodeReleaseMigrationLock,
+			err:  fmt.Errorf("failed to release migration lock: %w", err),
+		}
+	}
+
+	return nil
+}
+
+func (l *MigrationLock) heartbeat(ctx context.Context) {
+	defer close(l.done)
+
+	ticker := time.NewTicker(l.lease / 3)
+	defer ticker.Stop()
+
+	renewed := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := l.client.renewLock(ctx, l.tableName, l.owner, l.lease)
+		if err == nil {
+			renewed = time.Now()
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		// A transient error is retried at the next tick as long as the lock has not expired.
+		if errors.Is(err, errLockLost) || time.Since(renewed) >= l.lease {
+			l.mu.Lock()
+			l.err = &Error{
+				Code: ErrorCodeMigrationLocked,
+				err:  fmt.Errorf("migration lock is lost: %w", err),
+			}
+			l.mu.Unlock()
+			return
+		}
+	}
+}
+
+var errLockLost = errors.New("lock is taken over by another owner")
+
+// tryLock acquires the lock for owner unless another owner holds an unexpired lock.
+// It returns the other owner and the expiry of its lock in that case.
+func (c *Client) tryLock(ctx context.Context, tableName, owner string, lease time.Duration) (string, time.Time, error) {
+	var (
+		holder    string
+		expiresAt time.Time
+	)
+	_, err := c.spannerClient.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+		holder = ""
+
+		iter := tx.Query(ctx, spanner.Statement{
+			SQL:    fmt.Sprintf("SELECT Owner, ExpiresAt, ExpiresAt > CURRENT_TIMESTAMP() FROM `%s` WHERE ID = @id", lockTableName(tableName)),
+			Params: map[string]interface{}{"id": int64(migrationLockID)},
+		})
+		defer iter.Stop()
+
+		var (
+			found bool
+			valid bool
+			o     string
+		)
+		row, err := iter.Next()
+		switch {
+		case errors.Is(err, iterator.Done):
+		case err != nil:
+			return err
+		default:
+			found = true
+			if err := row.Columns(&o, &expiresAt, &valid); err != nil {
+				return err
+			}
+		}
+
+		if found && valid && o != owner {
+			holder = o
+			return nil
+		}
+
+		sql := "INSERT INTO `%s` (ID, Owner, AcquiredAt, ExpiresAt) VALUES (@id, @owner, CURRENT_TIMESTAMP(), TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL @lease MILLISECOND))"
+		if found {
+			sql = "UPDATE `%s` SET Owner = @owner, AcquiredAt = CURRENT_TIMESTAMP(), ExpiresAt = TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL @lease MILLISECOND) WHERE ID = @id"
+		}
+		_, err = tx.Update(ctx, spanner.Statement{
+			SQL: fmt.Sprintf(sql, lockTableName(tableName)),
+			Params: map[string]interface{}{
+				"id":    int64(migrationLockID),
+				"owner": owner,
+				"lease": lease.Milliseconds(),
+			},
+		})
+		return err
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return holder, expiresAt, nil
+}
+
+// renewLock extends the expiry of the lock held by owner. It returns errLockLost if owner does not hold the lock anymore.
+func (c *Client) renewLock(ctx context.Context, tableName, owner string, lease time.Duration) error {
+	_, err := c.spannerClient.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+		n, err := tx.Update(ctx, spanner.Statement{
+			SQL: fmt.Sprintf("UPDATE `%s` SET ExpiresAt = TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL @lease MILLISECOND) WHERE ID = @id AND Owner = @owner", lockTableName(tableName)),
+			Params: map[string]interface{}{
+				"id":    int64(migrationLockID),
+				"owner": owner,
+				"lease": lease.Milliseconds(),
+			},
+		})
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return errLockLost
+		}
+		return nil
+	})
+
+	return err
+}
+
+// ForceReleaseMigrationLock releases the lock of the migration table named tableName regardless of its owner.
+// It is the escape hatch for a lock left by a process that died before its lease expired.
+func (c *Client) ForceReleaseMigrationLock(ctx context.Context, tableName string) error {
+	_, err := c.spannerClient.Apply(ctx, []*spanner.Mutation{
+		spanner.Delete(lockTableName(tableName), spanner.AllKeys()),
+	})
+	if err != nil {
+		// There is nothing to release if no lock has ever been acquired.
+		if spanner.ErrCode(err) == codes.NotFound {
+			return nil
+		}
+		return &Error{
+			Code: ErrorCodeReleaseMigrationLock,
+			err:  fmt.Errorf("failed to release migration lock: %w", err),
+		}
+	}
+
+	return nil
+}
+
+// ensureMigrationLockTable creates the migration lock table if it does not exist.
+func (c *Client) ensureMigrationLockTable(ctx context.Context, tableName string) error {
+	exists := func() bool {
+		iter := c.spannerClient.Single().Read(ctx, lockTableName(tableName), spanner.KeySets(), []string{"ID"})
+		return iter.Do(func(r *spanner.Row) error {
+			return nil
+		}) == nil
+	}
+	if exists() {
+		return nil
+	}
+
+	stmt := fmt.Sprintf("CREATE TABLE `%s` ("+`
+    ID         INT64 NOT NULL,
+    Owner      STRING(MAX) NOT NULL,
+    AcquiredAt TIMESTAMP NOT NULL,
+    ExpiresAt  TIMESTAMP NOT NULL
+	) PRIMARY KEY(ID)`, lockTableName(tableName))
+
+	if err := c.ApplyDDL(ctx, []string{stmt}, nil); err != nil {
+		// Another process may have created the table at the same time.
+		if exists() {
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
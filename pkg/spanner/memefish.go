@@ -3,27 +3,59 @@ package spanner
 import (
 	"github.com/apstndb/gsqlutils"
 	"github.com/cloudspannerecosystem/memefish"
+	"github.com/cloudspannerecosystem/memefish/ast"
+	"github.com/cloudspannerecosystem/memefish/token"
 )
 
 // Directly use of memefish/gsqlutils is permitted only in this file.
 func toStatements(filename string, data []byte) ([]string, error) {
+	statements, _, err := toStatementsWithPositions(filename, data)
+	return statements, err
+}
+
+// toStatementsWithPositions is toStatements which also returns the positions of the statements in data.
+func toStatementsWithPositions(filename string, data []byte) ([]string, []StatementPosition, error) {
 	rawStmts, err := memefish.SplitRawStatements(filename, string(data))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
+	file := &token.File{FilePath: filename, Buffer: string(data)}
+
 	// need to strip comments because memefish.SplitRawStatements preserve comments, but UpdateDDL doesn't support comments.
-	var result []string
+	var (
+		result    []string
+		positions []StatementPosition
+	)
 	for _, rawStmt := range rawStmts {
 		stripped, err := gsqlutils.SimpleStripComments("", rawStmt.Statement)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		if len(stripped) != 0 {
 			result = append(result, stripped)
+			positions = append(positions, statementPosition(file, rawStmt))
 		}
 	}
-	return result, nil
+	return result, positions, nil
+}
+
+// statementPosition returns the position of the first token of rawStmt in file,
+// since the first statement of a file starts at the top of it including the header comments.
+func statementPosition(file *token.File, rawStmt *memefish.RawStatement) StatementPosition {
+	pos := rawStmt.Pos
+	lex := &memefish.Lexer{File: &token.File{Buffer: rawStmt.Statement}}
+	if err := lex.NextToken(); err == nil {
+		pos += lex.Token.Pos
+	}
+
+	p := file.Position(pos, pos)
+	return StatementPosition{
+		FileName: file.FilePath,
+		Line:     p.Line + 1,
+		Column:   p.Column + 1,
+		Excerpt:  p.Source,
+	}
 }
 
 func isDML(statement string) bool {
@@ -42,3 +74,47 @@ func isPartitionedDML(statement string) bool {
 	}
 	return token.IsKeywordLike("UPDATE") || token.IsKeywordLike("DELETE")
 }
+
+// isTransactionControl reports whether statement begins or commits an explicit transaction block. e.g. BEGIN; or COMMIT;
+func isTransactionControl(statement string) bool {
+	return isBeginTransaction(statement) || isCommitTransaction(statement)
+}
+
+func isBeginTransaction(statement string) bool {
+	token, err := gsqlutils.FirstNonHintToken("", statement)
+	if err != nil {
+		return false
+	}
+	return token.IsKeywordLike("BEGIN")
+}
+
+func isCommitTransaction(statement string) bool {
+	token, err := gsqlutils.FirstNonHintToken("", statement)
+	if err != nil {
+		return false
+	}
+	return token.IsKeywordLike("COMMIT")
+}
+
+// estimateMutations estimates the number of the mutations of an INSERT statement with a VALUES clause,
+// which is the number of the rows times the number of the columns. The mutations of the secondary indexes are not counted,
+// which DefaultMaxMutations leaves room for.
+// It returns false if the statement is not such an INSERT statement.
+func estimateMutations(statement string) (int, bool) {
+	dml, err := memefish.ParseDML("", statement)
+	if err != nil {
+		return 0, false
+	}
+
+	insert, ok := dml.(*ast.Insert)
+	if !ok {
+		return 0, false
+	}
+
+	values, ok := insert.Input.(*ast.ValuesInput)
+	if !ok {
+		return 0, false
+	}
+
+	return len(values.Rows) * len(insert.Columns), true
+}
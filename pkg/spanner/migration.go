@@ -21,11 +21,16 @@ package spanner
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/cloudspannerecosystem/wrench/internal/fs"
 )
@@ -35,7 +40,10 @@ var (
 	// 001.sql
 	// 001_name.sql
 	// 001_name.up.sql
-	migrationFileRegex = regexp.MustCompile(`^([0-9]+)(?:_([a-zA-Z0-9_\-]+))?(\.up)?\.sql$`)
+	// 001_name.down.sql
+	// 001_name.sql.tmpl
+	// 001_name.env-dev,test.sql
+	migrationFileRegex = regexp.MustCompile(`^([0-9]+)(?:_([a-zA-Z0-9_\-]+))?(?:\.env-([a-zA-Z0-9_\-,]+))?(\.up|\.down)?\.sql(?:\.tmpl)?$`)
 
 	MigrationNameRegex = regexp.MustCompile(`[a-zA-Z0-9_\-]+`)
 )
@@ -44,6 +52,16 @@ const (
 	statementKindDDL            statementKind = "DDL"
 	statementKindDML            statementKind = "DML"
 	statementKindPartitionedDML statementKind = "PartitionedDML"
+	statementKindGo             statementKind = "Go"
+	statementKindMixed          statementKind = "Mixed"
+
+	migrationDirectionDown = ".down"
+
+	// MigrationTimestampFormat is the format of the timestamp used as a migration version. e.g. 20060102150405_name.sql
+	MigrationTimestampFormat = "20060102150405"
+
+	// minTimestampVersion is the smallest version regarded as a timestamp, which has the digits of MigrationTimestampFormat.
+	minTimestampVersion = 10000000000000
 )
 
 type (
@@ -55,10 +73,36 @@ type (
 		// Name is the name of the migration
 		Name string
 
+		// FileName is the file name of the migration
+		FileName string
+
 		// Statements is the migration statements
 		Statements []string
 
-		kind statementKind
+		// DownStatements is the statements of the paired down migration file. e.g. version_name.down.sql
+		DownStatements []string
+
+		// Directives is the directives in the header comments of the migration file.
+		Directives MigrationDirectives
+
+		// DownDirectives is the directives in the header comments of the paired down migration file.
+		DownDirectives MigrationDirectives
+
+		// Envs are the environments which the migration is applied in, given by the file name segment
+		// (e.g. version_name.env-dev.sql) or the env directive. It is applied in every environment if empty.
+		Envs []string
+
+		kind     statementKind
+		downKind statementKind
+		hasDown  bool
+
+		// positions and downPositions are the positions of Statements and DownStatements in their files.
+		positions     []StatementPosition
+		downPositions []StatementPosition
+
+		// goFunc or goTxFunc is the function of a Go migration registered by RegisterMigration or RegisterTxMigration.
+		goFunc   GoMigrationFunc
+		goTxFunc GoMigrationTxFunc
 	}
 
 	Migrations []*Migration
@@ -78,7 +122,88 @@ func (ms Migrations) Less(i, j int) bool {
 	return ms[i].Version < ms[j].Version
 }
 
-func ReadMigrations(ctx context.Context, dir string) (Migrations, error) {
+// IsTimestampVersion reports whether version is a timestamp in MigrationTimestampFormat rather than a sequential number.
+func IsTimestampVersion(version uint) bool {
+	return version >= minTimestampVersion
+}
+
+// Kind returns the kind of the migration, one of DDL, DML, PartitionedDML, Mixed and Go.
+func (m *Migration) Kind() string {
+	return string(m.kind)
+}
+
+// HasDown reports whether the migration has a paired down migration file.
+func (m *Migration) HasDown() bool {
+	return m.hasDown
+}
+
+// Checksum returns the SHA-256 checksum of the migration statements.
+// The statements are normalized by stripping comments, so editing only comments does not change the checksum.
+// The checksum of a Go migration is calculated from its name, since its code cannot be inspected.
+func (m *Migration) Checksum() string {
+	if m.kind == statementKindGo {
+		return statementsChecksum("go:"+m.Name, m.Statements)
+	}
+	return statementsChecksum("", m.Statements)
+}
+
+func statementsChecksum(prefix string, statements []string) string {
+	h := sha256.New()
+	h.Write([]byte(prefix))
+	for _, s := range statements {
+		h.Write([]byte(s))
+		h.Write([]byte(ddlStatementsSeparator + "\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Checksum returns the SHA-256 checksum of the versions and the statements of all the migrations.
+func (ms Migrations) Checksum() string {
+	sorted := make(Migrations, len(ms))
+	copy(sorted, ms)
+	sort.Sort(sorted)
+
+	h := sha256.New()
+	for _, m := range sorted {
+		fmt.Fprintf(h, "%d:%s\n", m.Version, m.Checksum())
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// MigrationVersions returns the versions of the migration files in dir and the registered Go migrations in order.
+// Unlike ReadMigrations, the versions are given by the file names, so the files are neither read nor rendered.
+func MigrationVersions(ctx context.Context, dir string) ([]uint, error) {
+	files, err := ListMigrationFiles(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []uint
+	for _, f := range files {
+		versions = append(versions, f.Version)
+	}
+	for _, m := range registeredMigrations() {
+		versions = append(versions, m.Version)
+	}
+	slices.Sort(versions)
+	return slices.Compact(versions), nil
+}
+
+// ReadMigrations reads the migration files in dir, and merges them with the registered Go migrations in version order.
+// The files named with the .tmpl suffix are rendered with the data given by WithTemplateData.
+func ReadMigrations(ctx context.Context, dir string, opts ...ReadOption) (Migrations, error) {
+	migrations, err := readMigrations(ctx, dir, newReadOptions(opts))
+	if err != nil {
+		return nil, &Error{
+			Code: ErrorCodeInvalidInput,
+			err:  err,
+		}
+	}
+	return migrations, nil
+}
+
+func readMigrations(ctx context.Context, dir string, o *readOptions) (Migrations, error) {
+
 	files, err := fs.ReadDir(ctx, dir)
 	if err != nil {
 		return nil, err
@@ -87,6 +212,7 @@ func ReadMigrations(ctx context.Context, dir string) (Migrations, error) {
 	var migrations Migrations
 
 	versions := map[uint64]string{}
+	downs := map[uint64]*downMigration{}
 
 	for _, f := range files {
 		if f.IsDir() {
@@ -96,7 +222,7 @@ func ReadMigrations(ctx context.Context, dir string) (Migrations, error) {
 		filename := f.Name()
 
 		matches := migrationFileRegex.FindStringSubmatch(filename)
-		if len(matches) != 4 {
+		if len(matches) != 5 {
 			continue
 		}
 
@@ -110,25 +236,41 @@ func ReadMigrations(ctx context.Context, dir string) (Migrations, error) {
 			continue
 		}
 
-		statements, err := ddlToStatements(f.Name(), file)
+		statements, positions, kind, directives, err := parseMigrationFile(ctx, dir, filename, file, o)
 		if err != nil {
-			nstatements, nerr := dmlToStatements(f.Name(), file)
-			if nerr != nil {
-				return nil, fmt.Errorf("failed to parse DDL/DML statements: %v, %v", err, nerr)
-			}
-			statements = nstatements
+			return nil, err
 		}
 
-		kind, err := inspectStatementsKind(statements)
+		envs, err := migrationEnvs(filename, matches[3], directives)
 		if err != nil {
 			return nil, err
 		}
 
+		if matches[4] == migrationDirectionDown {
+			if prev, ok := downs[version]; ok {
+				return nil, fmt.Errorf("colliding version number \"%d\" between down migration file names \"%s\" and \"%s\"", version, prev.filename, filename)
+			}
+			downs[version] = &downMigration{
+				filename:   filename,
+				name:       matches[2],
+				statements: statements,
+				positions:  positions,
+				kind:       kind,
+				directives: directives,
+				envs:       envs,
+			}
+			continue
+		}
+
 		migrations = append(migrations, &Migration{
 			Version:    uint(version),
 			Name:       matches[2],
+			FileName:   filename,
 			Statements: statements,
+			Directives: directives,
+			Envs:       envs,
 			kind:       kind,
+			positions:  positions,
 		})
 
 		if prevFileName, ok := versions[version]; ok {
@@ -137,9 +279,111 @@ func ReadMigrations(ctx context.Context, dir string) (Migrations, error) {
 		versions[version] = filename
 	}
 
+	for _, m := range migrations {
+		d, ok := downs[uint64(m.Version)]
+		if !ok {
+			continue
+		}
+		if d.name != m.Name {
+			return nil, fmt.Errorf("down migration file name \"%s\" does not match up migration file name \"%s\"", d.filename, versions[uint64(m.Version)])
+		}
+		if d.envs != nil && !slices.Equal(d.envs, m.Envs) {
+			return nil, fmt.Errorf("environments of down migration file \"%s\" do not match the ones of up migration file \"%s\"", d.filename, versions[uint64(m.Version)])
+		}
+		m.DownStatements = d.statements
+		m.downPositions = d.positions
+		m.downKind = d.kind
+		m.DownDirectives = d.directives
+		m.hasDown = true
+		delete(downs, uint64(m.Version))
+	}
+
+	if len(downs) > 0 {
+		var filenames []string
+		for _, d := range downs {
+			filenames = append(filenames, fmt.Sprintf("\"%s\"", d.filename))
+		}
+		sort.Strings(filenames)
+		return nil, fmt.Errorf("down migration file %s has no up migration file", strings.Join(filenames, ", "))
+	}
+
+	for _, m := range registeredMigrations() {
+		if prevFileName, ok := versions[uint64(m.Version)]; ok {
+			return nil, fmt.Errorf("colliding version number \"%d\" between file name \"%s\" and Go migration \"%s\"", m.Version, prevFileName, m.Name)
+		}
+		migrations = append(migrations, m)
+	}
+	sort.Sort(migrations)
+
 	return migrations, nil
 }
 
+// downMigration is a parsed down migration file waiting to be paired with its up migration.
+type downMigration struct {
+	filename   string
+	name       string
+	statements []string
+	positions  []StatementPosition
+	kind       statementKind
+	directives MigrationDirectives
+	envs       []string
+}
+
+// parseMigrationFile parses the statements and the directives of the migration file, and tells the kind of the statements.
+// The file is rendered in advance if it is a template, so the positions of the statements are the ones in the rendered file.
+func parseMigrationFile(ctx context.Context, dir, filename string, file []byte, o *readOptions) ([]string, []StatementPosition, statementKind, MigrationDirectives, error) {
+	var directives MigrationDirectives
+
+	if IsTemplateFile(filename) {
+		rendered, err := RenderTemplate(filename, file, o.templateData)
+		if err != nil {
+			return nil, nil, "", directives, err
+		}
+		file = rendered
+	}
+
+	statements, positions, err := toStatementsWithPositions(filename, file)
+	if err != nil {
+		return nil, nil, "", directives, fmt.Errorf("failed to parse DDL/DML statements: %v", err)
+	}
+
+	directives, err = readDirectives(ctx, dir, filename, file)
+	if err != nil {
+		return nil, nil, "", directives, err
+	}
+
+	kind := statementKindMixed
+	if directives.Mixed {
+		if _, err := splitSteps(statements, directives.Partitioned); err != nil {
+			return nil, nil, "", directives, fmt.Errorf("invalid statements in %s: %w", filename, err)
+		}
+	} else if kind, err = inspectStatementsKind(statements); err != nil {
+		return nil, nil, "", directives, err
+	}
+	if kind, err = directives.kindOf(kind); err != nil {
+		return nil, nil, "", directives, fmt.Errorf("invalid directives in %s: %w", filename, err)
+	}
+
+	return statements, positions, kind, directives, nil
+}
+
+// readDirectives parses the directives of the migration file, and reads the proto descriptor file relative to dir.
+func readDirectives(ctx context.Context, dir, filename string, data []byte) (MigrationDirectives, error) {
+	d, err := parseDirectives(filename, data)
+	if err != nil {
+		return d, err
+	}
+
+	if d.ProtoDescriptorFile != "" {
+		d.protoDescriptors, err = fs.ReadFile(ctx, filepath.Join(dir, d.ProtoDescriptorFile))
+		if err != nil {
+			return d, fmt.Errorf("failed to read proto descriptor file of %s: %w", filename, err)
+		}
+	}
+
+	return d, nil
+}
+
 // Deprecated: use ReadMigrations instead.
 func LoadMigrations(dir string) (Migrations, error) {
 	return ReadMigrations(context.Background(), dir)
@@ -158,9 +402,11 @@ func inspectStatementsKind(statements []string) (statementKind, error) {
 		return statementKindDDL, nil
 	}
 
-	var hasDDL, hasDML, hasPartitionedDML bool
+	var hasDDL, hasDML, hasPartitionedDML, hasTransactionBlock bool
 	for _, s := range statements {
 		switch {
+		case isTransactionControl(s):
+			hasTransactionBlock = true
 		case isDML(s):
 			hasDML = true
 		case isPartitionedDML(s):
@@ -170,6 +416,17 @@ func inspectStatementsKind(statements []string) (statementKind, error) {
 		}
 	}
 
+	// The statements with explicit transaction blocks are run in transactions, even if they are UPDATE or DELETE.
+	if hasTransactionBlock {
+		if hasDDL {
+			return "", errors.New("transaction blocks must not contain DDL")
+		}
+		if _, err := splitTransactions(statements); err != nil {
+			return "", err
+		}
+		return statementKindDML, nil
+	}
+
 	switch {
 	case hasDDL && !hasDML && !hasPartitionedDML:
 		return statementKindDDL, nil
@@ -178,6 +435,6 @@ func inspectStatementsKind(statements []string) (statementKind, error) {
 	case !hasDDL && !hasDML && hasPartitionedDML:
 		return statementKindPartitionedDML, nil
 	default:
-		return "", errors.New("DDL, DML (INSERT), and partitioned DML (UPDATE or DELETE) must not be combined in the same migration file")
+		return "", errors.New("DDL, DML (INSERT), and partitioned DML (UPDATE or DELETE) must not be combined in the same migration file without the mixed directive")
 	}
 }
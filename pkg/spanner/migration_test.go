@@ -21,9 +21,16 @@ package spanner_test
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
+	"github.com/cloudspannerecosystem/wrench/internal/fs"
 	"github.com/cloudspannerecosystem/wrench/pkg/spanner"
 )
 
@@ -66,3 +73,315 @@ func TestLoadMigrations(t *testing.T) {
 		}
 	}
 }
+
+func TestReadDownMigrations(t *testing.T) {
+	ctx := context.Background()
+
+	ms, err := spanner.ReadMigrations(ctx, filepath.Join("testdata", "migrations"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		idx                int
+		wantHasDown        bool
+		wantDownStatements []string
+	}{
+		{
+			idx:         0,
+			wantHasDown: false,
+		},
+		{
+			idx:                2,
+			wantHasDown:        true,
+			wantDownStatements: []string{"ALTER TABLE Singers ALTER COLUMN LastName STRING(MAX)"},
+		},
+		{
+			idx:                3,
+			wantHasDown:        true,
+			wantDownStatements: []string{`DELETE FROM Singers WHERE SingerID = "2"`},
+		},
+	}
+
+	for _, tc := range testcases {
+		m := ms[tc.idx]
+		if m.HasDown() != tc.wantHasDown {
+			t.Errorf("migrations[%d].HasDown() want %v, but got %v", tc.idx, tc.wantHasDown, m.HasDown())
+		}
+
+		if len(m.DownStatements) != len(tc.wantDownStatements) {
+			t.Fatalf("migrations[%d].DownStatements want %v, but got %v", tc.idx, tc.wantDownStatements, m.DownStatements)
+		}
+		for i := range m.DownStatements {
+			if m.DownStatements[i] != tc.wantDownStatements[i] {
+				t.Errorf("migrations[%d].DownStatements[%d] want %v, but got %v", tc.idx, i, tc.wantDownStatements[i], m.DownStatements[i])
+			}
+		}
+	}
+}
+
+func TestReadDownMigrationsError(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"down migration without up migration": {
+			"migrations/000001_foo.sql":      {Data: []byte("CREATE TABLE Foo (ID INT64) PRIMARY KEY(ID);")},
+			"migrations/000002_bar.down.sql": {Data: []byte("DROP TABLE Bar;")},
+		},
+		"down migration with a different name": {
+			"migrations/000001_foo.sql":      {Data: []byte("CREATE TABLE Foo (ID INT64) PRIMARY KEY(ID);")},
+			"migrations/000001_bar.down.sql": {Data: []byte("DROP TABLE Foo;")},
+		},
+	}
+
+	for name, fsys := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := fs.WithContext(context.Background(), fsys)
+
+			_, err := spanner.ReadMigrations(ctx, "migrations")
+			var se *spanner.Error
+			if !errors.As(err, &se) || se.Code != spanner.ErrorCodeInvalidInput {
+				t.Errorf("want invalid input error, but got %v", err)
+			}
+		})
+	}
+}
+
+func TestReadMigrationDirectives(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/000001_ddl.sql":      {Data: []byte("-- wrench:timeout=2h\n-- wrench:proto_descriptor=descriptors.pb\nCREATE TABLE Foo (ID INT64) PRIMARY KEY(ID);")},
+		"migrations/000002_dml.sql":      {Data: []byte("-- Backfill Foo.\n--wrench:priority=low\n-- wrench:transaction-tag=backfill\n-- wrench:partitioned=false\nUPDATE Foo SET ID = ID WHERE true;")},
+		"migrations/000002_dml.down.sql": {Data: []byte("-- wrench:priority=high\nDELETE FROM Foo WHERE true;")},
+		"migrations/000003_pdml.sql":     {Data: []byte("UPDATE Foo SET ID = ID WHERE true;\n-- wrench:priority=low")},
+		"migrations/descriptors.pb":      {Data: []byte("descriptors")},
+	}
+	ctx := fs.WithContext(context.Background(), fsys)
+
+	ms, err := spanner.ReadMigrations(ctx, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 3 {
+		t.Fatalf("migrations length want 3, but got %d", len(ms))
+	}
+
+	if d := ms[0].Directives; d.Timeout != 2*time.Hour || d.ProtoDescriptorFile != "descriptors.pb" {
+		t.Errorf("want timeout 2h and proto descriptor file descriptors.pb, but got %+v", d)
+	}
+
+	d := ms[1].Directives
+	if d.Priority != spanner.PriorityTypeLow || d.TransactionTag != "backfill" || d.Partitioned == nil || *d.Partitioned {
+		t.Errorf("want low priority, transaction tag backfill, and not partitioned, but got %+v", d)
+	}
+	if ms[1].Kind() != "DML" {
+		t.Errorf("kind want DML, but got %s", ms[1].Kind())
+	}
+	if ms[1].DownDirectives.Priority != spanner.PriorityTypeHigh {
+		t.Errorf("down priority want high, but got %v", ms[1].DownDirectives.Priority)
+	}
+
+	// Directives after the first statement are ignored.
+	if !ms[2].Directives.IsZero() {
+		t.Errorf("want no directives, but got %+v", ms[2].Directives)
+	}
+	if ms[2].Kind() != "PartitionedDML" {
+		t.Errorf("kind want PartitionedDML, but got %s", ms[2].Kind())
+	}
+}
+
+func TestMigrationVersions(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/000001_create.sql":      {Data: []byte("CREATE TABLE Foo (ID INT64) PRIMARY KEY(ID);")},
+		"migrations/000001_create.down.sql": {Data: []byte("DROP TABLE Foo;")},
+		"migrations/000003_seed.sql.tmpl":   {Data: []byte("INSERT INTO Foo (ID) VALUES ({{.Vars.missing}});")},
+		"migrations/README.md":              {Data: []byte("not a migration")},
+	}
+	ctx := fs.WithContext(context.Background(), fsys)
+
+	versions, err := spanner.MigrationVersions(ctx, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint{1, 3}; !slices.Equal(versions, want) {
+		t.Errorf("want %v, but got %v", want, versions)
+	}
+}
+
+func TestReadMigrationLongLine(t *testing.T) {
+	// a minified seed INSERT statement in a line longer than the default token limit of bufio.Scanner.
+	values := strings.TrimSuffix(strings.Repeat("(1), ", 20000), ", ")
+	fsys := fstest.MapFS{
+		"migrations/000001.sql": {Data: []byte("INSERT INTO Foo (ID) VALUES " + values + ";")},
+		"migrations/000002.sql": {Data: []byte("-- wrench:priority=low\nINSERT INTO Foo (ID) VALUES " + values + ";")},
+	}
+	ctx := fs.WithContext(context.Background(), fsys)
+
+	ms, err := spanner.ReadMigrations(ctx, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 2 {
+		t.Fatalf("migrations length want 2, but got %d", len(ms))
+	}
+	if !ms[0].Directives.IsZero() {
+		t.Errorf("want no directives, but got %+v", ms[0].Directives)
+	}
+	if ms[1].Directives.Priority != spanner.PriorityTypeLow {
+		t.Errorf("priority want low, but got %v", ms[1].Directives.Priority)
+	}
+}
+
+func TestReadMigrationDirectivesError(t *testing.T) {
+	tests := map[string]string{
+		"unknown directive":             "-- wrench:unknown=1\nCREATE TABLE Foo (ID INT64) PRIMARY KEY(ID);",
+		"directive without value":       "-- wrench:priority\nUPDATE Foo SET ID = ID WHERE true;",
+		"invalid priority":              "-- wrench:priority=urgent\nUPDATE Foo SET ID = ID WHERE true;",
+		"invalid timeout":               "-- wrench:timeout=forever\nUPDATE Foo SET ID = ID WHERE true;",
+		"missing proto descriptor":      "-- wrench:proto_descriptor=missing.pb\nCREATE TABLE Foo (ID INT64) PRIMARY KEY(ID);",
+		"partitioned insert":            "-- wrench:partitioned=true\nINSERT INTO Foo (ID) VALUES (1);",
+		"transaction tag for DDL":       "-- wrench:transaction-tag=tag\nCREATE TABLE Foo (ID INT64) PRIMARY KEY(ID);",
+		"proto descriptor file for DML": "-- wrench:proto_descriptor=descriptors.pb\nINSERT INTO Foo (ID) VALUES (1);",
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			fsys := fstest.MapFS{
+				"migrations/000001.sql":     {Data: []byte(data)},
+				"migrations/descriptors.pb": {Data: []byte("descriptors")},
+			}
+			ctx := fs.WithContext(context.Background(), fsys)
+
+			_, err := spanner.ReadMigrations(ctx, "migrations")
+			var se *spanner.Error
+			if !errors.As(err, &se) || se.Code != spanner.ErrorCodeInvalidInput {
+				t.Errorf("want invalid input error, but got %v", err)
+			}
+		})
+	}
+}
+
+func TestReadMixedMigration(t *testing.T) {
+	data := "ALTER TABLE Singers ADD COLUMN Nickname STRING(MAX);\nUPDATE Singers SET Nickname = FirstName WHERE true;"
+	tests := map[string]struct {
+		data    string
+		wantErr bool
+	}{
+		"mixed":                       {data: "-- wrench:mixed=true\n" + data},
+		"mixed without the directive": {data: data, wantErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fsys := fstest.MapFS{
+				"migrations/000001.sql": {Data: []byte(test.data)},
+			}
+			ctx := fs.WithContext(context.Background(), fsys)
+
+			ms, err := spanner.ReadMigrations(ctx, "migrations")
+			if test.wantErr {
+				if err == nil {
+					t.Error("want error, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ms[0].Kind() != "Mixed" {
+				t.Errorf("kind want Mixed, but got %s", ms[0].Kind())
+			}
+		})
+	}
+}
+
+func TestReadEnvMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/000001_foo.sql":                    {Data: []byte("CREATE TABLE Foo (ID INT64) PRIMARY KEY(ID);")},
+		"migrations/000002_seed.env-dev.sql":           {Data: []byte("-- wrench:env=test, dev\nINSERT INTO Foo (ID) VALUES (1);")},
+		"migrations/000002_seed.env-dev,test.down.sql": {Data: []byte("DELETE FROM Foo WHERE ID = 1;")},
+		"migrations/000003_seed.env-test,dev.sql":      {Data: []byte("INSERT INTO Foo (ID) VALUES (2);")},
+		"migrations/000003_seed.down.sql":              {Data: []byte("DELETE FROM Foo WHERE ID = 2;")},
+		"migrations/000004_seed.sql":                   {Data: []byte("-- wrench:env=dev\nINSERT INTO Foo (ID) VALUES (3);")},
+		"migrations/000005_seed.env-dev.sql.tmpl":      {Data: []byte("INSERT INTO Foo (ID) VALUES (4);")},
+	}
+	ctx := fs.WithContext(context.Background(), fsys)
+
+	ms, err := spanner.ReadMigrations(ctx, "migrations", spanner.WithTemplateData(&spanner.TemplateData{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 5 {
+		t.Fatalf("migrations length want 5, but got %d", len(ms))
+	}
+
+	want := [][]string{nil, {"dev", "test"}, {"dev", "test"}, {"dev"}, {"dev"}}
+	for i, m := range ms {
+		if fmt.Sprint(m.Envs) != fmt.Sprint(want[i]) {
+			t.Errorf("envs of version %d want %v, but got %v", m.Version, want[i], m.Envs)
+		}
+	}
+
+	if ms[1].Name != "seed" || !ms[1].HasDown() || !ms[2].HasDown() {
+		t.Errorf("want 000002 and 000003 named seed with their down migrations")
+	}
+
+	if !ms[0].InEnv("prod") || ms[1].InEnv("prod") || !ms[1].InEnv("test") {
+		t.Errorf("want 000001 applied in every environment, and 000002 applied only in dev and test")
+	}
+}
+
+func TestReadEnvMigrationsError(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"invalid environment directive": {
+			"migrations/000001.sql": {Data: []byte("-- wrench:env=dev,\nINSERT INTO Foo (ID) VALUES (1);")},
+		},
+		"down migration in other environments": {
+			"migrations/000001_seed.env-dev.sql":       {Data: []byte("INSERT INTO Foo (ID) VALUES (1);")},
+			"migrations/000001_seed.env-test.down.sql": {Data: []byte("DELETE FROM Foo WHERE ID = 1;")},
+		},
+	}
+
+	for name, fsys := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := fs.WithContext(context.Background(), fsys)
+
+			if _, err := spanner.ReadMigrations(ctx, "migrations"); err == nil {
+				t.Error("want error, but got nil")
+			}
+		})
+	}
+}
+
+func TestMigrationChecksum(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/000001.sql": {Data: []byte("CREATE TABLE Foo (ID INT64) PRIMARY KEY(ID);")},
+		"migrations/000002.sql": {Data: []byte("-- Comments must be ignored\nCREATE TABLE Foo (ID INT64) PRIMARY KEY(ID);")},
+		"migrations/000003.sql": {Data: []byte("CREATE TABLE Bar (ID INT64) PRIMARY KEY(ID);")},
+	}
+	ctx := fs.WithContext(context.Background(), fsys)
+
+	ms, err := spanner.ReadMigrations(ctx, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ms[0].Checksum() != ms[1].Checksum() {
+		t.Errorf("checksums want to be equal, but got %s and %s", ms[0].Checksum(), ms[1].Checksum())
+	}
+
+	if ms[0].Checksum() == ms[2].Checksum() {
+		t.Errorf("checksums want to be different, but got %s", ms[0].Checksum())
+	}
+}
+
+func TestMigrationsChecksum(t *testing.T) {
+	m1 := &spanner.Migration{Version: 1, Statements: []string{"CREATE TABLE Foo (ID INT64) PRIMARY KEY(ID)"}}
+	m2 := &spanner.Migration{Version: 2, Statements: []string{"CREATE TABLE Bar (ID INT64) PRIMARY KEY(ID)"}}
+	m3 := &spanner.Migration{Version: 3, Statements: []string{"CREATE TABLE Baz (ID INT64) PRIMARY KEY(ID)"}}
+
+	if a, b := (spanner.Migrations{m1, m2}).Checksum(), (spanner.Migrations{m2, m1}).Checksum(); a != b {
+		t.Errorf("checksums want to be independent of the order, but got %s and %s", a, b)
+	}
+
+	if a, b := (spanner.Migrations{m1, m2}).Checksum(), (spanner.Migrations{m1, m2, m3}).Checksum(); a == b {
+		t.Errorf("checksums want to be different, but got %s", a)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package spanner
+
+import (
+	"context"
+	"errors"
+)
+
+// migrationStep is a run of statements of the same kind in a mixed migration, which is applied at once.
+type migrationStep struct {
+	kind       statementKind
+	offset     int
+	statements []string
+}
+
+// end returns the index of the statement next to the step in the migration.
+func (s migrationStep) end() int {
+	return s.offset + len(s.statements)
+}
+
+// splitSteps splits the statements of a mixed migration into steps in file order.
+// Consecutive DDL statements make a step applied by a single schema update operation, and consecutive DML statements
+// make a step applied in a single transaction. Every partitioned DML statement makes its own step, since it is not atomic.
+func splitSteps(statements []string, partitioned *bool) ([]migrationStep, error) {
+	var steps []migrationStep
+	for i, s := range statements {
+		var kind statementKind
+		switch {
+		case isTransactionControl(s):
+			return nil, errors.New("transaction blocks are not supported in mixed migrations")
+		case isDML(s):
+			if partitioned != nil && *partitioned {
+				return nil, errors.New("INSERT statements cannot be executed as partitioned DML")
+			}
+			kind = statementKindDML
+		case isPartitionedDML(s):
+			kind = statementKindPartitionedDML
+			if partitioned != nil && !*partitioned {
+				kind = statementKindDML
+			}
+		default:
+			kind = statementKindDDL
+		}
+
+		if n := len(steps); n > 0 && steps[n-1].kind == kind && kind != statementKindPartitionedDML {
+			steps[n-1].statements = append(steps[n-1].statements, s)
+			continue
+		}
+		steps = append(steps, migrationStep{kind: kind, offset: i, statements: []string{s}})
+	}
+	return steps, nil
+}
+
+// steps returns the steps in which m is applied, or nil if m is applied at once.
+// A mixed migration is applied in the steps of the same kind, and a DML migration is applied in the steps
+// of the transactions if it has multiple ones.
+// The DML steps of INSERT statements are split into chunks of at most maxMutations, see chunkTransactions.
+func (m *Migration) steps(maxMutations int) ([]migrationStep, error) {
+	switch m.kind {
+	case statementKindMixed:
+		steps, err := splitSteps(m.Statements, m.Directives.Partitioned)
+		if err != nil {
+			return nil, err
+		}
+		return chunkTransactions(steps, maxMutations), nil
+	case statementKindDML:
+		steps, err := dmlTransactions(m.Statements, maxMutations)
+		if err != nil || len(steps) < 2 {
+			return nil, err
+		}
+		return steps, nil
+	default:
+		return nil, nil
+	}
+}
+
+// applyMigrationSteps applies the statements of m from the statement at from in steps,
+// recording the progress in the history table after every step. The progress of a DML step is committed
+// in the same transaction as the step, so that the step is never replayed.
+func (c *Client) applyMigrationSteps(ctx context.Context, tableName string, m *Migration, steps []migrationStep, from int, priorityType PriorityType, protoDescriptors []byte) error {
+	d := m.Directives
+	for i, step := range steps {
+		if step.end() <= from {
+			continue
+		}
+
+		statements := step.statements
+		if from > step.offset {
+			statements = statements[from-step.offset:]
+		}
+
+		if step.kind == statementKindDML {
+			progress := migrationProgressMutation(tableName, m.Version, step.end())
+			if _, err := c.applyDML(ctx, dmlStatements(statements), d.priorityOr(priorityType), d.TransactionTag, progress); err != nil {
+				return err
+			}
+		} else {
+			if err := c.applyStatements(ctx, step.kind, statements, d, priorityType, protoDescriptors); err != nil {
+				return err
+			}
+			if err := c.recordMigrationProgress(ctx, tableName, m.Version, step.end()); err != nil {
+				return err
+			}
+		}
+
+		e := migrationEvent(EventStepApplied, MigrationDirectionUp, m)
+		e.Step, e.Steps = i+1, len(steps)
+		c.emit(e)
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package spanner
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSplitSteps(t *testing.T) {
+	statements := []string{
+		"ALTER TABLE Singers ADD COLUMN Nickname STRING(MAX)",
+		"CREATE INDEX SingersByNickname ON Singers(Nickname)",
+		"INSERT INTO Singers (SingerID) VALUES ('1')",
+		"INSERT INTO Singers (SingerID) VALUES ('2')",
+		"UPDATE Singers SET Nickname = FirstName WHERE true",
+		"DELETE FROM Singers WHERE FirstName IS NULL",
+		"ALTER TABLE Singers ALTER COLUMN Nickname STRING(MAX) NOT NULL",
+	}
+	notPartitioned := false
+	partitioned := true
+
+	tests := map[string]struct {
+		partitioned *bool
+		want        []string
+	}{
+		"inferred": {
+			want: []string{"DDL[0:2]", "DML[2:4]", "PartitionedDML[4:5]", "PartitionedDML[5:6]", "DDL[6:7]"},
+		},
+		"not partitioned": {
+			partitioned: &notPartitioned,
+			want:        []string{"DDL[0:2]", "DML[2:6]", "DDL[6:7]"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			steps, err := splitSteps(statements, test.partitioned)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, s := range steps {
+				got = append(got, fmt.Sprintf("%s[%d:%d]", s.kind, s.offset, s.end()))
+			}
+			if fmt.Sprint(test.want) != fmt.Sprint(got) {
+				t.Errorf("want %v, but got %v", test.want, got)
+			}
+		})
+	}
+
+	if _, err := splitSteps(statements, &partitioned); err == nil {
+		t.Error("want error for partitioned INSERT, but got nil")
+	}
+}
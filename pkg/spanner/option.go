@@ -0,0 +1,134 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package spanner
+
+// MigrationOption is an option of ExecuteMigrations and RollbackMigrations.
+type MigrationOption func(*migrationOptions)
+
+type migrationOptions struct {
+	allowChecksumDrift bool
+	allowOutOfOrder    bool
+	batchDDL           bool
+	env                string
+	hooks              migrationHooks
+	lock               LockOptions
+	repeatable         []*RepeatableMigration
+
+	// plan is the plan which the pending migrations must match.
+	plan *MigrationPlan
+}
+
+func newMigrationOptions(opts []MigrationOption) *migrationOptions {
+	o := &migrationOptions{
+		lock: DefaultLockOptions(),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithAllowChecksumDrift makes ExecuteMigrations apply migrations even if the files of applied migrations
+// were edited or deleted after they were applied.
+func WithAllowChecksumDrift() MigrationOption {
+	return func(o *migrationOptions) {
+		o.allowChecksumDrift = true
+	}
+}
+
+// WithAllowOutOfOrder makes ExecuteMigrations also apply the migrations older than the database version
+// which have not been applied, e.g. the ones added by a branch merged after newer migrations were applied.
+// Whether a migration has been applied is told by the migration history.
+func WithAllowOutOfOrder() MigrationOption {
+	return func(o *migrationOptions) {
+		o.allowOutOfOrder = true
+	}
+}
+
+// WithBatchDDL makes ExecuteMigrations apply adjacent DDL migrations by a single schema update operation,
+// which is much faster than applying them one by one. If the operation fails halfway, the migrations
+// whose statements were all committed are recorded as applied.
+func WithBatchDDL() MigrationOption {
+	return func(o *migrationOptions) {
+		o.batchDDL = true
+	}
+}
+
+// WithEnvironment makes ExecuteMigrations skip the migrations scoped to environments other than env,
+// recording them as skipped so that they are never applied to the database. GetMigrationStatus reports them as skipped.
+// Without it, ExecuteMigrations refuses to apply migrations scoped to environments.
+func WithEnvironment(env string) MigrationOption {
+	return func(o *migrationOptions) {
+		o.env = env
+	}
+}
+
+// WithHooks makes ExecuteMigrations call hooks around the run and each migration.
+// It can be given multiple times, and the hooks are called in the given order.
+func WithHooks(hooks MigrationHooks) MigrationOption {
+	return func(o *migrationOptions) {
+		o.hooks = append(o.hooks, hooks)
+	}
+}
+
+// WithLockOptions configures how the migration lock is acquired while migrations are applied.
+func WithLockOptions(opts LockOptions) MigrationOption {
+	return func(o *migrationOptions) {
+		o.lock = opts
+	}
+}
+
+// WithRepeatableMigrations makes ExecuteMigrations apply the repeatable migrations which have not been applied or
+// have been changed since they were applied last, after all the pending migrations are applied.
+// They are not applied if the number of the migrations to be applied is limited.
+// ApplyMigrationPlan applies only the ones in the plan, and refuses to apply the plan if they were changed since the plan was made.
+func WithRepeatableMigrations(migrations []*RepeatableMigration) MigrationOption {
+	return func(o *migrationOptions) {
+		o.repeatable = migrations
+	}
+}
+
+func withPlan(plan *MigrationPlan) MigrationOption {
+	return func(o *migrationOptions) {
+		o.plan = plan
+	}
+}
+
+// ReadOption is an option of ReadMigrations and ReadRepeatableMigrations.
+type ReadOption func(*readOptions)
+
+type readOptions struct {
+	templateData *TemplateData
+}
+
+func newReadOptions(opts []ReadOption) *readOptions {
+	o := &readOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithTemplateData renders the migration files named with the .tmpl suffix with data. e.g. 000001.sql.tmpl
+func WithTemplateData(data *TemplateData) ReadOption {
+	return func(o *readOptions) {
+		o.templateData = data
+	}
+}
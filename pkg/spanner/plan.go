@@ -0,0 +1,284 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package spanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/grpc/codes"
+)
+
+// MigrationPlan represents the migrations which ExecuteMigrations would apply.
+// It can be saved as JSON, reviewed and then applied by ApplyMigrationPlan.
+type MigrationPlan struct {
+	// Database is the database the plan was made for.
+	Database string `json:"database"`
+
+	// SourceVersion is the database version when the plan was made.
+	SourceVersion uint `json:"source_version"`
+
+	// TargetVersion is the database version after the plan is applied.
+	TargetVersion uint `json:"target_version"`
+
+	// MigrationsChecksum is the checksum of all the migrations when the plan was made.
+	MigrationsChecksum string `json:"migrations_checksum"`
+
+	// AllowOutOfOrder tells that the plan contains the migrations older than SourceVersion.
+	AllowOutOfOrder bool `json:"allow_out_of_order"`
+
+	// Env is the environment the plan was made for, in which the migrations scoped to other environments are skipped.
+	Env string `json:"env,omitempty"`
+
+	// Migrations are the migrations to be applied in order.
+	Migrations []*PlannedMigration `json:"migrations"`
+
+	// Repeatable are the repeatable migrations to be applied after Migrations, which are planned only if no limit is given.
+	Repeatable []*PlannedRepeatableMigration `json:"repeatable,omitempty"`
+}
+
+// PlannedMigration represents a migration to be applied with the exact statements sent to Cloud Spanner.
+type PlannedMigration struct {
+	Version    uint     `json:"version"`
+	Name       string   `json:"name"`
+	FileName   string   `json:"file_name"`
+	Kind       string   `json:"kind"`
+	Statements []string `json:"statements"`
+
+	// Skipped tells the migration is scoped to other environments, and is recorded as skipped without being applied.
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+// PlannedRepeatableMigration represents a repeatable migration to be applied, with the checksum of its statements
+// which tells whether it was changed or applied since the plan was made.
+type PlannedRepeatableMigration struct {
+	Name       string   `json:"name"`
+	FileName   string   `json:"file_name"`
+	Kind       string   `json:"kind"`
+	Checksum   string   `json:"checksum"`
+	Statements []string `json:"statements"`
+}
+
+// PlanMigrations returns the migrations which ExecuteMigrations would apply with the same arguments.
+// It only reads the database, and does not even create the migration table.
+func (c *Client) PlanMigrations(ctx context.Context, migrations Migrations, limit int, tableName string, opts ...MigrationOption) (*MigrationPlan, error) {
+	o := newMigrationOptions(opts)
+
+	sort.Sort(migrations)
+
+	var (
+		version uint
+		dirty   bool
+		history []*MigrationHistory
+	)
+
+	exists, err := c.tableExists(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		version, dirty, err = c.GetSchemaMigrationVersion(ctx, tableName)
+		if err != nil {
+			var se *Error
+			if !errors.As(err, &se) || se.Code != ErrorCodeNoMigration {
+				return nil, err
+			}
+		}
+	}
+
+	if dirty {
+		return nil, &Error{
+			Code: ErrorCodeMigrationVersionDirty,
+			err:  fmt.Errorf("database version: %d is dirty, please fix it", version),
+		}
+	}
+
+	exists, err = c.tableExists(ctx, historyTableName(tableName))
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		history, err = c.readMigrationHistory(ctx, tableName)
+		if err != nil {
+			return nil, err
+		}
+	} else if version > 0 {
+		// The history table is seeded with the version when it is created.
+		history = []*MigrationHistory{{Version: version}}
+	}
+
+	if !o.allowChecksumDrift {
+		if drifts := checksumDrifts(history, migrations); len(drifts) > 0 {
+			return nil, &Error{
+				Code: ErrorCodeMigrationChecksumDrift,
+				err:  &ChecksumDriftError{Drifts: drifts},
+			}
+		}
+	}
+
+	plan := &MigrationPlan{
+		Database:           c.config.URL(),
+		SourceVersion:      version,
+		TargetVersion:      version,
+		MigrationsChecksum: migrations.Checksum(),
+		AllowOutOfOrder:    o.allowOutOfOrder,
+		Env:                o.env,
+		Migrations:         []*PlannedMigration{},
+	}
+
+	pending := pendingMigrations(migrations, version, limit)
+	if o.allowOutOfOrder {
+		pending = unappliedMigrations(migrations, history, limit)
+	}
+	if err := verifyEnvironment(pending, o.env); err != nil {
+		return nil, err
+	}
+	for _, m := range pending {
+		plan.Migrations = append(plan.Migrations, &PlannedMigration{
+			Version:    m.Version,
+			Name:       m.Name,
+			FileName:   m.FileName,
+			Kind:       m.Kind(),
+			Statements: m.Statements,
+			Skipped:    !m.InEnv(o.env),
+		})
+		if m.Version > plan.TargetVersion {
+			plan.TargetVersion = m.Version
+		}
+	}
+
+	if limit < 0 && len(o.repeatable) > 0 {
+		repeatable, err := c.PendingRepeatableMigrations(ctx, o.repeatable, tableName)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range repeatable {
+			plan.Repeatable = append(plan.Repeatable, &PlannedRepeatableMigration{
+				Name:       m.Name,
+				FileName:   m.FileName,
+				Kind:       m.Kind(),
+				Checksum:   m.Checksum(),
+				Statements: m.Statements,
+			})
+		}
+	}
+
+	return plan, nil
+}
+
+// ApplyMigrationPlan applies the migrations of plan made by PlanMigrations, and then its repeatable migrations
+// out of the ones given by WithRepeatableMigrations.
+// It refuses to apply the plan if it was made for another database, the migrations were changed,
+// or the database version was changed since the plan was made.
+func (c *Client) ApplyMigrationPlan(ctx context.Context, plan *MigrationPlan, migrations Migrations, tableName string, priorityType PriorityType, protoDescriptors []byte, opts ...MigrationOption) error {
+	if plan.Database != c.config.URL() {
+		return &Error{
+			Code: ErrorCodeStaleMigrationPlan,
+			err:  fmt.Errorf("the plan was made for database %s, not %s", plan.Database, c.config.URL()),
+		}
+	}
+
+	if checksum := migrations.Checksum(); checksum != plan.MigrationsChecksum {
+		return &Error{
+			Code: ErrorCodeStaleMigrationPlan,
+			err:  fmt.Errorf("the migrations were changed since the plan was made, checksum of the plan: %s, checksum of the migrations: %s", plan.MigrationsChecksum, checksum),
+		}
+	}
+
+	opts = append(opts, withPlan(plan))
+	if plan.AllowOutOfOrder {
+		opts = append(opts, WithAllowOutOfOrder())
+	}
+	if plan.Env != "" {
+		opts = append(opts, WithEnvironment(plan.Env))
+	}
+
+	return c.ExecuteMigrations(ctx, migrations, len(plan.Migrations), tableName, priorityType, protoDescriptors, opts...)
+}
+
+// verifyPlan verifies that pending migrations of the database at version are the same as the migrations of plan.
+func verifyPlan(plan *MigrationPlan, version uint, pending Migrations) error {
+	if version != plan.SourceVersion {
+		return &Error{
+			Code: ErrorCodeStaleMigrationPlan,
+			err:  fmt.Errorf("the database version was changed since the plan was made, version of the plan: %d, version of the database: %d", plan.SourceVersion, version),
+		}
+	}
+
+	if len(pending) != len(plan.Migrations) {
+		return &Error{
+			Code: ErrorCodeStaleMigrationPlan,
+			err:  fmt.Errorf("the plan has %d migrations, but %d migrations are pending", len(plan.Migrations), len(pending)),
+		}
+	}
+
+	for i, m := range pending {
+		p := plan.Migrations[i]
+		if m.Version != p.Version || m.Kind() != p.Kind || !slices.Equal(m.Statements, p.Statements) {
+			return &Error{
+				Code: ErrorCodeStaleMigrationPlan,
+				err:  fmt.Errorf("the migration of version %d differs from the plan", p.Version),
+			}
+		}
+	}
+
+	return nil
+}
+
+// plannedRepeatableMigrations returns the repeatable migrations of plan out of pending ones,
+// verifying that they have not been changed or applied since the plan was made.
+func plannedRepeatableMigrations(plan *MigrationPlan, pending []*RepeatableMigration) ([]*RepeatableMigration, error) {
+	var planned []*RepeatableMigration
+	for _, p := range plan.Repeatable {
+		i := slices.IndexFunc(pending, func(m *RepeatableMigration) bool { return m.Name == p.Name })
+		if i < 0 || pending[i].Checksum() != p.Checksum {
+			return nil, &Error{
+				Code: ErrorCodeStaleMigrationPlan,
+				err:  fmt.Errorf("the repeatable migration %s differs from the plan", p.Name),
+			}
+		}
+		planned = append(planned, pending[i])
+	}
+
+	return planned, nil
+}
+
+// tableExists reports whether the table having the Version column, e.g. the migration table, exists in the database.
+func (c *Client) tableExists(ctx context.Context, tableName string) (bool, error) {
+	iter := c.spannerClient.Single().Read(ctx, tableName, spanner.KeySets(), []string{"Version"})
+	err := iter.Do(func(r *spanner.Row) error {
+		return nil
+	})
+	if err != nil {
+		if spanner.ErrCode(err) == codes.NotFound {
+			return false, nil
+		}
+		return false, &Error{
+			Code: ErrorCodeGetMigrationVersion,
+			err:  err,
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package spanner
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestVerifyPlan(t *testing.T) {
+	m2 := &Migration{Version: 2, kind: statementKindDDL, Statements: []string{"CREATE TABLE Foo (ID INT64) PRIMARY KEY(ID)"}}
+	m3 := &Migration{Version: 3, kind: statementKindDML, Statements: []string{"INSERT INTO Foo (ID) VALUES (1)"}}
+	edited := &Migration{Version: 3, kind: statementKindDML, Statements: []string{"INSERT INTO Foo (ID) VALUES (2)"}}
+
+	plan := &MigrationPlan{
+		SourceVersion: 1,
+		TargetVersion: 3,
+		Migrations: []*PlannedMigration{
+			{Version: 2, Kind: "DDL", Statements: m2.Statements},
+			{Version: 3, Kind: "DML", Statements: m3.Statements},
+		},
+	}
+
+	tests := map[string]struct {
+		version uint
+		pending Migrations
+		wantErr bool
+	}{
+		"same as the plan": {
+			version: 1,
+			pending: Migrations{m2, m3},
+		},
+		"database version changed": {
+			version: 2,
+			pending: Migrations{m3},
+			wantErr: true,
+		},
+		"migration edited": {
+			version: 1,
+			pending: Migrations{m2, edited},
+			wantErr: true,
+		},
+		"migration deleted": {
+			version: 1,
+			pending: Migrations{m2},
+			wantErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := verifyPlan(plan, test.version, test.pending)
+			if (err != nil) != test.wantErr {
+				t.Errorf("want error: %t, but got %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestPlannedRepeatableMigrations(t *testing.T) {
+	views := &RepeatableMigration{Name: "views", kind: statementKindDDL, Statements: []string{"CREATE OR REPLACE VIEW Foos SQL SECURITY INVOKER AS SELECT Foo.ID FROM Foo"}}
+	edited := &RepeatableMigration{Name: "views", kind: statementKindDDL, Statements: []string{"CREATE OR REPLACE VIEW Foos SQL SECURITY INVOKER AS SELECT Foo.ID, Foo.Name FROM Foo"}}
+	seeds := &RepeatableMigration{Name: "seeds", kind: statementKindDML, Statements: []string{"INSERT OR UPDATE INTO Foo (ID) VALUES (1)"}}
+
+	plan := &MigrationPlan{
+		Repeatable: []*PlannedRepeatableMigration{
+			{Name: "views", Kind: "DDL", Checksum: views.Checksum(), Statements: views.Statements},
+		},
+	}
+
+	tests := map[string]struct {
+		pending []*RepeatableMigration
+		want    []string
+		wantErr bool
+	}{
+		"same as the plan": {
+			pending: []*RepeatableMigration{views},
+			want:    []string{"views"},
+		},
+		"changed after the plan": {
+			pending: []*RepeatableMigration{views, seeds},
+			want:    []string{"views"},
+		},
+		"edited": {
+			pending: []*RepeatableMigration{edited},
+			wantErr: true,
+		},
+		"applied": {
+			pending: nil,
+			wantErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := plannedRepeatableMigrations(plan, test.pending)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("want error: %t, but got %v", test.wantErr, err)
+			}
+
+			var names []string
+			for _, m := range got {
+				names = append(names, m.Name)
+			}
+			if !slices.Equal(test.want, names) {
+				t.Errorf("want %v, but got %v", test.want, names)
+			}
+		})
+	}
+}
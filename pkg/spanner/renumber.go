@@ -0,0 +1,158 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package spanner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/cloudspannerecosystem/wrench/internal/fs"
+)
+
+// MigrationFile is a migration file identified only by its name. Unlike ReadMigrations, listing them
+// does not read the statements nor fail on colliding versions, so that the collisions can be resolved.
+type MigrationFile struct {
+	Version  uint
+	Name     string
+	FileName string
+	Down     bool
+
+	// suffix is the part of FileName after the version. e.g. _name.sql
+	suffix string
+}
+
+// MigrationRename is a rename of a migration file to give it a new version.
+type MigrationRename struct {
+	From       string
+	To         string
+	OldVersion uint
+	NewVersion uint
+}
+
+// ListMigrationFiles lists the migration files in dir in version order.
+func ListMigrationFiles(ctx context.Context, dir string) ([]*MigrationFile, error) {
+	entries, err := fs.ReadDir(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []*MigrationFile
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+
+		matches := migrationFileRegex.FindStringSubmatch(e.Name())
+		if len(matches) != 5 {
+			continue
+		}
+
+		version, err := strconv.ParseUint(matches[1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		files = append(files, &MigrationFile{
+			Version:  uint(version),
+			Name:     matches[2],
+			FileName: e.Name(),
+			Down:     matches[4] == migrationDirectionDown,
+			suffix:   e.Name()[len(matches[1]):],
+		})
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].Version != files[j].Version {
+			return files[i].Version < files[j].Version
+		}
+		return files[i].FileName < files[j].FileName
+	})
+
+	return files, nil
+}
+
+// RenumberMigrations returns the renames which give the migration files newer than since sequential versions
+// from since+1 without collisions nor gaps, keeping their order. A down migration file keeps the version of
+// its up migration file. The files up to since are regarded as applied and never renamed, and the files
+// versioned by timestamps are not renamed either. The new versions are zero-padded to digits, and skip
+// the versions of the registered Go migrations.
+func RenumberMigrations(files []*MigrationFile, since uint, digits int) []*MigrationRename {
+	// A migration is a pair of up and down migration files which have the same version and name.
+	type migration struct {
+		version uint
+		name    string
+		files   []*MigrationFile
+	}
+
+	var migrations []*migration
+	index := map[string]*migration{}
+	for _, f := range files {
+		if f.Version <= since || IsTimestampVersion(f.Version) {
+			continue
+		}
+
+		key := fmt.Sprintf("%d_%s", f.Version, f.Name)
+		m, ok := index[key]
+		if !ok {
+			m = &migration{version: f.Version, name: f.Name}
+			index[key] = m
+			migrations = append(migrations, m)
+		}
+		m.files = append(m.files, f)
+	}
+
+	sort.SliceStable(migrations, func(i, j int) bool {
+		if migrations[i].version != migrations[j].version {
+			return migrations[i].version < migrations[j].version
+		}
+		return migrations[i].name < migrations[j].name
+	})
+
+	// The versions of the registered Go migrations are skipped.
+	reserved := map[uint]bool{}
+	for _, m := range registeredMigrations() {
+		reserved[m.Version] = true
+	}
+
+	var renames []*MigrationRename
+	v := since
+	for _, m := range migrations {
+		v++
+		for reserved[v] {
+			v++
+		}
+		if v == m.version {
+			continue
+		}
+
+		for _, f := range m.files {
+			renames = append(renames, &MigrationRename{
+				From:       f.FileName,
+				To:         fmt.Sprintf("%0*d%s", digits, v, f.suffix),
+				OldVersion: f.Version,
+				NewVersion: v,
+			})
+		}
+	}
+
+	return renames
+}
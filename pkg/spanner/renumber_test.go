@@ -0,0 +1,109 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package spanner_test
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/cloudspannerecosystem/wrench/internal/fs"
+	"github.com/cloudspannerecosystem/wrench/pkg/spanner"
+)
+
+func TestRenumberMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/000001.sql":          {},
+		"migrations/000002_foo.sql":      {},
+		"migrations/000003_bar.sql":      {},
+		"migrations/000003_baz.up.sql":   {},
+		"migrations/000003_baz.down.sql": {},
+		"migrations/000005_qux.sql":      {},
+		"migrations/20261017093000.sql":  {},
+		"migrations/README.md":           {},
+	}
+	ctx := fs.WithContext(context.Background(), fsys)
+
+	files, err := spanner.ListMigrationFiles(ctx, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := 7, len(files); want != got {
+		t.Fatalf("files length want %d, but got %d", want, got)
+	}
+
+	tests := map[string]struct {
+		since uint
+		want  map[string]string
+	}{
+		"collision and gap": {
+			since: 2,
+			want: map[string]string{
+				"000003_baz.up.sql":   "000004_baz.up.sql",
+				"000003_baz.down.sql": "000004_baz.down.sql",
+				"000005_qux.sql":      "000005_qux.sql",
+			},
+		},
+		"applied files are not renamed": {
+			since: 3,
+			want: map[string]string{
+				"000003_baz.up.sql":   "000003_baz.up.sql",
+				"000003_baz.down.sql": "000003_baz.down.sql",
+				"000005_qux.sql":      "000004_qux.sql",
+			},
+		},
+		"nothing applied": {
+			since: 0,
+			want: map[string]string{
+				"000003_baz.up.sql":   "000004_baz.up.sql",
+				"000003_baz.down.sql": "000004_baz.down.sql",
+				"000005_qux.sql":      "000005_qux.sql",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			renames := spanner.RenumberMigrations(files, test.since, 6)
+
+			got := map[string]string{}
+			for _, r := range renames {
+				got[r.From] = r.To
+			}
+			for from, to := range test.want {
+				if from == to {
+					if _, ok := got[from]; ok {
+						t.Errorf("%s want not to be renamed, but renamed to %s", from, got[from])
+					}
+					continue
+				}
+				if got[from] != to {
+					t.Errorf("%s want to be renamed to %s, but got %q", from, to, got[from])
+				}
+			}
+			for from := range got {
+				if _, ok := test.want[from]; !ok {
+					t.Errorf("%s want not to be renamed, but renamed to %s", from, got[from])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,439 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package spanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	databasepb "cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	"github.com/cloudspannerecosystem/wrench/pkg/schema"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// StatementState represents whether a statement of a dirty migration has been applied.
+type StatementState string
+
+const (
+	StatementStateApplied    StatementState = "applied"
+	StatementStateNotApplied StatementState = "not-applied"
+	StatementStateUnknown    StatementState = "unknown"
+)
+
+// DirtyStatement is a statement of a dirty migration with its state.
+type DirtyStatement struct {
+	Statement string
+	State     StatementState
+	// CommittedAt is the commit timestamp of the statement recorded in the schema update operation.
+	// It is zero if the statement is not committed or the operation is not found.
+	CommittedAt time.Time
+}
+
+// DirtyMigration is the result of inspecting the migration which the database is dirty at.
+type DirtyMigration struct {
+	Migration *Migration
+	// Operation is the name of the schema update operation which applied the migration.
+	// It is empty if the operation is not found, e.g. it was older than the retention period of the operations.
+	Operation  string
+	Statements []*DirtyStatement
+}
+
+// ResumeFrom returns the index of the first statement to be applied to resume the migration.
+// It returns an error if the migration cannot be resumed safely, that is, the state of a statement is unknown
+// or a statement which has not been applied is followed by an applied statement.
+func (d *DirtyMigration) ResumeFrom() (int, error) {
+	if d.Migration.kind == statementKindGo {
+		return 0, fmt.Errorf("Go migration of version %d cannot be resumed", d.Migration.Version)
+	}
+
+	from := len(d.Statements)
+	for i, s := range d.Statements {
+		switch s.State {
+		case StatementStateUnknown:
+			return 0, fmt.Errorf("statement #%d of version %d is not known to be applied or not", i+1, d.Migration.Version)
+		case StatementStateApplied:
+			if from < i {
+				return 0, fmt.Errorf("statement #%d of version %d is applied after statement #%d which is not applied", i+1, d.Migration.Version, from+1)
+			}
+		case StatementStateNotApplied:
+			if from > i {
+				from = i
+			}
+		}
+	}
+	return from, nil
+}
+
+// InspectDirtyMigration tells which statements of the dirty migration have been applied.
+// The states of DDL statements are told by the commit timestamps of the latest schema update operation
+// which contains the statements, and by the schema objects of the live DDL. The states of DML statements are unknown,
+// except for the ones of a migration applied in steps whose progress is recorded.
+func (c *Client) InspectDirtyMigration(ctx context.Context, migrations Migrations, tableName string) (*DirtyMigration, error) {
+	version, dirty, err := c.GetSchemaMigrationVersion(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	if !dirty {
+		return nil, &Error{
+			Code: ErrorCodeMigrationNotDirty,
+			err:  fmt.Errorf("database version: %d is not dirty", version),
+		}
+	}
+
+	history, err := c.GetMigrationHistory(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+	version = dirtyMigrationVersion(history, version)
+
+	var m *Migration
+	for _, mig := range migrations {
+		if mig.Version == version {
+			m = mig
+			break
+		}
+	}
+	if m == nil {
+		return nil, &Error{
+			Code: ErrorCodeRepairMigration,
+			err:  fmt.Errorf("database version: %d is not found in migrations", version),
+		}
+	}
+
+	var progress int
+	for _, h := range history {
+		if h.Version != version {
+			continue
+		}
+		// The migration finished once, so the database got dirty while rolling it back.
+		if !h.FinishedAt.IsZero() {
+			return nil, &Error{
+				Code: ErrorCodeRepairMigration,
+				err:  fmt.Errorf("database version: %d got dirty while rolling back, it must be fixed by hand", version),
+			}
+		}
+		progress = h.Progress
+	}
+
+	d := &DirtyMigration{Migration: m}
+	for _, stmt := range m.Statements {
+		d.Statements = append(d.Statements, &DirtyStatement{
+			Statement: stmt,
+			State:     StatementStateUnknown,
+		})
+	}
+
+	steps, err := m.steps(c.config.maxMutations())
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case steps != nil:
+		if d.Operation, err = c.inspectMigrationSteps(ctx, steps, d.Statements, progress); err != nil {
+			return nil, err
+		}
+	case m.kind == statementKindDDL:
+		if d.Operation, err = c.inspectDDLStatements(ctx, d.Statements); err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// inspectMigrationSteps sets the states of the statements of a migration applied in steps, given the number of the statements
+// recorded as applied. The progress of a DML step is committed along with the step, so a DML step is not applied
+// if it is not recorded, while the states of the DDL step which failed are told as the ones of a DDL migration.
+// It returns the name of the schema update operation of the DDL step which failed, if any.
+func (c *Client) inspectMigrationSteps(ctx context.Context, steps []migrationStep, statements []*DirtyStatement, progress int) (string, error) {
+	var (
+		operation string
+		err       error
+	)
+	for _, step := range steps {
+		switch {
+		case step.end() <= progress:
+			for _, s := range statements[step.offset:step.end()] {
+				s.State = StatementStateApplied
+			}
+		case step.offset > progress:
+			for _, s := range statements[step.offset:step.end()] {
+				s.State = StatementStateNotApplied
+			}
+		default:
+			// The step is the one which failed.
+			switch step.kind {
+			case statementKindDDL:
+				if operation, err = c.inspectDDLStatements(ctx, statements[progress:step.end()]); err != nil {
+					return "", err
+				}
+			case statementKindDML:
+				for _, s := range statements[step.offset:step.end()] {
+					s.State = StatementStateNotApplied
+				}
+			}
+		}
+	}
+
+	return operation, nil
+}
+
+// inspectDDLStatements sets the states of the DDL statements by the commit timestamps of the latest schema update operation
+// which contains the statements, and by the schema objects of the live DDL. It returns the name of the operation if found.
+func (c *Client) inspectDDLStatements(ctx context.Context, statements []*DirtyStatement) (string, error) {
+	stmts := make([]string, len(statements))
+	for i, s := range statements {
+		stmts[i] = s.Statement
+	}
+
+	name, committedAt, err := c.findDDLOperation(ctx, stmts)
+	if err != nil {
+		return "", &Error{
+			Code: ErrorCodeRepairMigration,
+			err:  fmt.Errorf("failed to list schema update operations: %w", err),
+		}
+	}
+	if name != "" {
+		for i, s := range statements {
+			s.State = StatementStateNotApplied
+			if !committedAt[i].IsZero() {
+				s.State = StatementStateApplied
+				s.CommittedAt = committedAt[i]
+			}
+		}
+	}
+
+	ddl, _, err := c.LoadDDL(ctx)
+	if err != nil {
+		return "", err
+	}
+	catalog, err := schema.Parse("", ddl)
+	if err != nil {
+		return "", &Error{
+			Code: ErrorCodeRepairMigration,
+			err:  fmt.Errorf("failed to parse the schema of the database: %w", err),
+		}
+	}
+
+	// The live DDL is also consulted because the statements may have been applied by hand after the operation.
+	for _, s := range statements {
+		if s.State == StatementStateApplied {
+			continue
+		}
+		if applied, known := catalog.Applied(s.Statement); known {
+			s.State = StatementStateNotApplied
+			if applied {
+				s.State = StatementStateApplied
+			}
+		}
+	}
+
+	return name, nil
+}
+
+// findDDLOperation finds the latest schema update operation of the database which contains statements in a row,
+// and returns its name and the commit timestamps of statements. The commit timestamp is zero if the statement is not committed.
+// It returns an empty name if no operation is found.
+func (c *Client) findDDLOperation(ctx context.Context, statements []string) (string, []time.Time, error) {
+	iter := c.spannerAdminClient.ListDatabaseOperations(ctx, &databasepb.ListDatabaseOperationsRequest{
+		Parent: fmt.Sprintf("projects/%s/instances/%s", c.config.Project, c.config.Instance),
+		Filter: "(metadata.@type:type.googleapis.com/google.spanner.admin.database.v1.UpdateDatabaseDdlMetadata)",
+	})
+
+	var (
+		name        string
+		committedAt []time.Time
+		latest      time.Time
+	)
+	for {
+		op, err := iter.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			// The emulator does not support listing operations.
+			if status.Code(err) == codes.Unimplemented {
+				return "", nil, nil
+			}
+			return "", nil, err
+		}
+
+		metadata := &databasepb.UpdateDatabaseDdlMetadata{}
+		if err := op.GetMetadata().UnmarshalTo(metadata); err != nil {
+			continue
+		}
+		if metadata.GetDatabase() != c.config.URL() {
+			continue
+		}
+
+		offset := indexOfStatements(metadata.GetStatements(), statements)
+		if offset < 0 {
+			continue
+		}
+
+		var startedAt time.Time
+		if progress := metadata.GetProgress(); offset < len(progress) {
+			startedAt = progress[offset].GetStartTime().AsTime()
+		}
+		if name != "" && !startedAt.After(latest) {
+			continue
+		}
+
+		name, latest = op.GetName(), startedAt
+		committedAt = make([]time.Time, len(statements))
+		for i := range statements {
+			if ts := metadata.GetCommitTimestamps(); offset+i < len(ts) {
+				committedAt[i] = ts[offset+i].AsTime()
+			}
+		}
+	}
+
+	return name, committedAt, nil
+}
+
+// indexOfStatements returns the index of the first occurrence of statements in a row in s, or -1 if not present.
+func indexOfStatements(s, statements []string) int {
+	if len(statements) == 0 {
+		return -1
+	}
+
+	for i := 0; i+len(statements) <= len(s); i++ {
+		match := true
+		for j, stmt := range statements {
+			if strings.TrimSpace(s[i+j]) != strings.TrimSpace(stmt) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
+
+// ResumeDirtyMigration applies the statements of the dirty migration which have not been applied, and clears the dirty flag.
+// It fails without changing anything if the migration cannot be resumed safely, see DirtyMigration.ResumeFrom.
+func (c *Client) ResumeDirtyMigration(ctx context.Context, migrations Migrations, tableName string, priorityType PriorityType, protoDescriptors []byte, opts ...MigrationOption) error {
+	o := newMigrationOptions(opts)
+
+	lock, err := c.AcquireMigrationLock(ctx, tableName, o.lock)
+	if err != nil {
+		return err
+	}
+	defer lock.Release(ctx)
+
+	d, err := c.InspectDirtyMigration(ctx, migrations, tableName)
+	if err != nil {
+		return err
+	}
+
+	from, err := d.ResumeFrom()
+	if err != nil {
+		return &Error{
+			Code: ErrorCodeRepairMigration,
+			err:  err,
+		}
+	}
+
+	m := d.Migration
+	if from < len(m.Statements) {
+		steps, err := m.steps(c.config.maxMutations())
+		if err != nil {
+			return &Error{
+				Code: ErrorCodeRepairMigration,
+				err:  err,
+			}
+		}
+		if steps != nil {
+			err = c.applyMigrationSteps(ctx, tableName, m, steps, from, priorityType, protoDescriptors)
+		} else {
+			err = c.applyStatements(ctx, m.kind, m.Statements[from:], m.Directives, priorityType, protoDescriptors)
+		}
+		if err != nil {
+			return &Error{
+				Code: ErrorCodeExecuteMigrations,
+				err:  fmt.Errorf("%w, version: %d", locateStatement(err, m.Statements, m.positions), m.Version),
+			}
+		}
+	}
+
+	history, err := c.readMigrationHistory(ctx, tableName)
+	if err != nil {
+		return err
+	}
+
+	// The duration is counted from the start of the migration which failed, if it is recorded.
+	var elapsed time.Duration
+	for _, h := range history {
+		if h.Version == m.Version && !h.StartedAt.IsZero() {
+			elapsed = time.Since(h.StartedAt)
+		}
+	}
+
+	if err := c.finishMigration(ctx, tableName, m, elapsed); err != nil {
+		return &Error{
+			Code: ErrorCodeRepairMigration,
+			err:  err,
+		}
+	}
+
+	e := migrationEvent(EventMigrationFinished, MigrationDirectionUp, m)
+	e.Duration = elapsed
+	c.emit(e)
+
+	return nil
+}
+
+// MarkDirtyMigrationClean clears the dirty flag of the dirty migration without applying any statement.
+func (c *Client) MarkDirtyMigrationClean(ctx context.Context, tableName string, opts ...MigrationOption) error {
+	o := newMigrationOptions(opts)
+
+	lock, err := c.AcquireMigrationLock(ctx, tableName, o.lock)
+	if err != nil {
+		return err
+	}
+	defer lock.Release(ctx)
+
+	version, dirty, err := c.GetSchemaMigrationVersion(ctx, tableName)
+	if err != nil {
+		return err
+	}
+
+	if !dirty {
+		return &Error{
+			Code: ErrorCodeMigrationNotDirty,
+			err:  fmt.Errorf("database version: %d is not dirty", version),
+		}
+	}
+
+	history, err := c.GetMigrationHistory(ctx, tableName)
+	if err != nil {
+		return err
+	}
+
+	return c.markMigrationClean(ctx, tableName, dirtyMigrationVersion(history, version))
+}
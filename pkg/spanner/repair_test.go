@@ -0,0 +1,99 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package spanner
+
+import "testing"
+
+func TestDirtyMigrationResumeFrom(t *testing.T) {
+	tests := map[string]struct {
+		states  []StatementState
+		want    int
+		wantErr bool
+	}{
+		"nothing applied": {
+			states: []StatementState{StatementStateNotApplied, StatementStateNotApplied},
+			want:   0,
+		},
+		"partly applied": {
+			states: []StatementState{StatementStateApplied, StatementStateNotApplied, StatementStateNotApplied},
+			want:   1,
+		},
+		"all applied": {
+			states: []StatementState{StatementStateApplied, StatementStateApplied},
+			want:   2,
+		},
+		"unknown": {
+			states:  []StatementState{StatementStateApplied, StatementStateUnknown},
+			wantErr: true,
+		},
+		"applied after not applied": {
+			states:  []StatementState{StatementStateNotApplied, StatementStateApplied},
+			wantErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := &DirtyMigration{Migration: &Migration{Version: 1}}
+			for _, s := range test.states {
+				d.Statements = append(d.Statements, &DirtyStatement{State: s})
+			}
+
+			got, err := d.ResumeFrom()
+			if test.wantErr {
+				if err == nil {
+					t.Error("want error, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("want %d, but got %d", test.want, got)
+			}
+		})
+	}
+}
+
+func TestIndexOfStatements(t *testing.T) {
+	s := []string{"a", "b", "c", "b", "d"}
+
+	tests := map[string]struct {
+		statements []string
+		want       int
+	}{
+		"head":       {statements: []string{"a", "b"}, want: 0},
+		"middle":     {statements: []string{"b", "d"}, want: 3},
+		"whole":      {statements: s, want: 0},
+		"spaces":     {statements: []string{" c\n"}, want: 2},
+		"not in row": {statements: []string{"a", "c"}, want: -1},
+		"too long":   {statements: append(s, "e"), want: -1},
+		"empty":      {statements: nil, want: -1},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := indexOfStatements(s, test.statements); got != test.want {
+				t.Errorf("want %d, but got %d", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package spanner
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/cloudspannerecosystem/wrench/internal/fs"
+	"google.golang.org/grpc/codes"
+)
+
+// repeatableMigrationTableSuffix is appended to the migration table name to name the table
+// which keeps the checksums of the applied repeatable migrations.
+const repeatableMigrationTableSuffix = "Repeatable"
+
+// repeatableMigrationFileRegex matches the repeatable migration files. e.g. R_views.sql or R_views.sql.tmpl
+var repeatableMigrationFileRegex = regexp.MustCompile(`^R_([a-zA-Z0-9_\-]+)\.sql(?:\.tmpl)?$`)
+
+// RepeatableMigration represents a repeatable migration file, which has no version and is applied again
+// whenever its checksum changes, e.g. CREATE OR REPLACE VIEW statements. e.g. R_name.sql
+type RepeatableMigration struct {
+	// Name is the name of the migration
+	Name string
+
+	// FileName is the file name of the migration
+	FileName string
+
+	// Statements is the migration statements
+	Statements []string
+
+	// Directives is the directives in the header comments of the migration file.
+	Directives MigrationDirectives
+
+	kind statementKind
+
+	// positions is the positions of Statements in the file.
+	positions []StatementPosition
+}
+
+// Kind returns the kind of the migration, one of DDL, DML, PartitionedDML and Mixed.
+func (m *RepeatableMigration) Kind() string {
+	return string(m.kind)
+}
+
+// Checksum returns the SHA-256 checksum of the migration statements, which is calculated as Migration.Checksum.
+func (m *RepeatableMigration) Checksum() string {
+	return statementsChecksum("", m.Statements)
+}
+
+func repeatableTableName(tableName string) string {
+	return tableName + repeatableMigrationTableSuffix
+}
+
+// ReadRepeatableMigrations reads the repeatable migration files in dir in name order.
+// The files named with the .tmpl suffix are rendered with the data given by WithTemplateData.
+func ReadRepeatableMigrations(ctx context.Context, dir string, opts ...ReadOption) ([]*RepeatableMigration, error) {
+	migrations, err := readRepeatableMigrations(ctx, dir, newReadOptions(opts))
+	if err != nil {
+		return nil, &Error{
+			Code: ErrorCodeInvalidInput,
+			err:  err,
+		}
+	}
+	return migrations, nil
+}
+
+func readRepeatableMigrations(ctx context.Context, dir string, o *readOptions) ([]*RepeatableMigration, error) {
+
+	files, err := fs.ReadDir(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []*RepeatableMigration
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+
+		filename := f.Name()
+
+		matches := repeatableMigrationFileRegex.FindStringSubmatch(filename)
+		if len(matches) != 2 {
+			continue
+		}
+
+		file, err := fs.ReadFile(ctx, filepath.Join(dir, filename))
+		if err != nil {
+			return nil, err
+		}
+
+		statements, positions, kind, directives, err := parseMigrationFile(ctx, dir, filename, file, o)
+		if err != nil {
+			return nil, err
+		}
+		if len(directives.Env) > 0 {
+			return nil, fmt.Errorf("env directive is not applicable to repeatable migration file %s", filename)
+		}
+
+		migrations = append(migrations, &RepeatableMigration{
+			Name:       matches[1],
+			FileName:   filename,
+			Statements: statements,
+			Directives: directives,
+			kind:       kind,
+			positions:  positions,
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Name < migrations[j].Name
+	})
+
+	return migrations, nil
+}
+
+// PendingRepeatableMigrations returns the repeatable migrations which have not been applied
+// or whose checksums differ from the ones recorded when they were applied last.
+func (c *Client) PendingRepeatableMigrations(ctx context.Context, migrations []*RepeatableMigration, tableName string) ([]*RepeatableMigration, error) {
+	checksums := map[string]string{}
+	iter := c.spannerClient.Single().Read(ctx, repeatableTableName(tableName), spanner.AllKeys(), []string{"Name", "Checksum"})
+	err := iter.Do(func(row *spanner.Row) error {
+		var name, checksum string
+		if err := row.Columns(&name, &checksum); err != nil {
+			return err
+		}
+		checksums[name] = checksum
+		return nil
+	})
+	if err != nil && spanner.ErrCode(err) != codes.NotFound {
+		return nil, &Error{
+			Code: ErrorCodeGetMigrationHistory,
+			err:  err,
+		}
+	}
+
+	var pending []*RepeatableMigration
+	for _, m := range migrations {
+		if checksums[m.Name] != m.Checksum() {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// applyRepeatableMigrations applies the pending repeatable migrations in order, and records their checksums.
+// It returns the number of the applied migrations.
+func (c *Client) applyRepeatableMigrations(ctx context.Context, migrations []*RepeatableMigration, tableName string, priorityType PriorityType, protoDescriptors []byte) (int, error) {
+	pending, err := c.PendingRepeatableMigrations(ctx, migrations, tableName)
+	if err != nil {
+		return 0, err
+	}
+	if len(pending) == 0 {
+		return 0, nil
+	}
+
+	if err := c.ensureRepeatableMigrationTable(ctx, tableName); err != nil {
+		return 0, &Error{
+			Code: ErrorCodeExecuteMigrations,
+			err:  err,
+		}
+	}
+
+	for i, m := range pending {
+		if err := c.applyRepeatableMigration(ctx, m, tableName, priorityType, protoDescriptors); err != nil {
+			return i, err
+		}
+	}
+
+	return len(pending), nil
+}
+
+func (c *Client) applyRepeatableMigration(ctx context.Context, m *RepeatableMigration, tableName string, priorityType PriorityType, protoDescriptors []byte) error {
+	ctx, cancel := migrationContext(ctx, m.Directives)
+	defer cancel()
+
+	start := time.Now()
+	c.emit(repeatableMigrationEvent(EventMigrationStarted, m))
+
+	if err := c.applyStatements(ctx, m.kind, m.Statements, m.Directives, priorityType, protoDescriptors); err != nil {
+		return &Error{
+			Code: ErrorCodeExecuteMigrations,
+			err:  fmt.Errorf("%w, repeatable migration: %s", locateStatement(err, m.Statements, m.positions), m.Name),
+		}
+	}
+
+	_, err := c.spannerClient.Apply(ctx, []*spanner.Mutation{
+		spanner.InsertOrUpdate(
+			repeatableTableName(tableName),
+			[]string{"Name", "FileName", "Checksum", "AppliedAt", "WrenchVersion", "AppliedBy"},
+			[]interface{}{m.Name, m.FileName, m.Checksum(), spanner.CommitTimestamp, c.config.WrenchVersion, c.operator()},
+		),
+	})
+	if err != nil {
+		return &Error{
+			Code: ErrorCodeSetMigrationVersion,
+			err:  err,
+		}
+	}
+
+	e := repeatableMigrationEvent(EventMigrationFinished, m)
+	e.Duration = time.Since(start)
+	c.emit(e)
+
+	return nil
+}
+
+func repeatableMigrationEvent(typ EventType, m *RepeatableMigration) Event {
+	return Event{
+		Type:       typ,
+		Direction:  MigrationDirectionUp,
+		Name:       m.Name,
+		FileName:   m.FileName,
+		Kind:       m.Kind(),
+		Repeatable: true,
+	}
+}
+
+// ensureRepeatableMigrationTable creates the table of the repeatable migrations if it does not exist.
+func (c *Client) ensureRepeatableMigrationTable(ctx context.Context, tableName string) error {
+	exists := func() bool {
+		iter := c.spannerClient.Single().Read(ctx, repeatableTableName(tableName), spanner.KeySets(), []string{"Name"})
+		return iter.Do(func(r *spanner.Row) error {
+			return nil
+		}) == nil
+	}
+	if exists() {
+		return nil
+	}
+
+	stmt := fmt.Sprintf("CREATE TABLE `%s` ("+`
+    Name          STRING(MAX) NOT NULL,
+    FileName      STRING(MAX) NOT NULL,
+    Checksum      STRING(64) NOT NULL,
+    AppliedAt     TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp=true),
+    WrenchVersion STRING(MAX),
+    AppliedBy     STRING(MAX)
+	) PRIMARY KEY(Name)`, repeatableTableName(tableName))
+
+	if err := c.ApplyDDL(ctx, []string{stmt}, nil); err != nil {
+		// Another process may have created the table at the same time.
+		if exists() {
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package spanner_test
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/cloudspannerecosystem/wrench/internal/fs"
+	"github.com/cloudspannerecosystem/wrench/pkg/spanner"
+)
+
+func TestReadRepeatableMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/000001_foo.sql":   {Data: []byte("CREATE TABLE Foo (ID INT64) PRIMARY KEY(ID);")},
+		"migrations/R_views.sql":      {Data: []byte("CREATE OR REPLACE VIEW FooView SQL SECURITY INVOKER AS SELECT ID FROM Foo;")},
+		"migrations/R_streams.sql":    {Data: []byte("-- Comments must be ignored\nCREATE CHANGE STREAM FooStream FOR Foo;")},
+		"migrations/R_invalid.sql.bk": {Data: []byte("DROP TABLE Foo;")},
+	}
+	ctx := fs.WithContext(context.Background(), fsys)
+
+	ms, err := spanner.ReadRepeatableMigrations(ctx, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ms) != 2 {
+		t.Fatalf("migrations length want 2, but got %d", len(ms))
+	}
+	if ms[0].Name != "streams" || ms[1].Name != "views" {
+		t.Errorf("want streams and views in order, but got %s and %s", ms[0].Name, ms[1].Name)
+	}
+	if ms[1].FileName != "R_views.sql" || ms[1].Kind() != "DDL" {
+		t.Errorf("want R_views.sql of DDL, but got %s of %s", ms[1].FileName, ms[1].Kind())
+	}
+
+	// Repeatable migrations are not versioned migrations.
+	versioned, err := spanner.ReadMigrations(ctx, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versioned) != 1 {
+		t.Errorf("versioned migrations length want 1, but got %d", len(versioned))
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package spanner
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+// MigrationState is the state of a migration in the database.
+type MigrationState string
+
+const (
+	// MigrationStateApplied means the migration has been applied to the database.
+	MigrationStateApplied MigrationState = "applied"
+
+	// MigrationStatePending means the migration is newer than the database version and will be applied.
+	MigrationStatePending MigrationState = "pending"
+
+	// MigrationStateOutOfOrder means the migration is older than the database version but has not been applied,
+	// e.g. the file was added by a branch merged after newer migrations were applied.
+	MigrationStateOutOfOrder MigrationState = "out-of-order"
+
+	// MigrationStateMissing means the migration has been applied but its file is not found.
+	MigrationStateMissing MigrationState = "missing"
+
+	// MigrationStateSkipped means the migration is scoped to other environments, and has been recorded
+	// as skipped or will be skipped by ExecuteMigrations.
+	MigrationStateSkipped MigrationState = "skipped"
+)
+
+// MigrationStatus represents the state of the migrations of a database.
+type MigrationStatus struct {
+	// Version is the current version of the database. It is zero if no migration has been applied.
+	Version uint `json:"version"`
+
+	// Dirty is the dirty flag of the current version.
+	Dirty bool `json:"dirty"`
+
+	// Migrations are the migrations in version order, including the applied migrations whose files are missing.
+	Migrations []*MigrationStatusEntry `json:"migrations"`
+
+	// Gaps are the ranges of versions skipped in the sequentially numbered migration files.
+	Gaps []*VersionRange `json:"gaps"`
+}
+
+// MigrationStatusEntry represents the state of a migration.
+type MigrationStatusEntry struct {
+	Version  uint           `json:"version"`
+	Name     string         `json:"name"`
+	FileName string         `json:"file_name"`
+	Kind     string         `json:"kind"`
+	Envs     []string       `json:"envs,omitempty"`
+	State    MigrationState `json:"state"`
+	Dirty    bool           `json:"dirty"`
+}
+
+// VersionRange is a range of versions from First to Last inclusive.
+type VersionRange struct {
+	First uint `json:"first"`
+	Last  uint `json:"last"`
+}
+
+// Count returns the number of the migrations in state.
+func (s *MigrationStatus) Count(state MigrationState) int {
+	var n int
+	for _, m := range s.Migrations {
+		if m.State == state {
+			n++
+		}
+	}
+	return n
+}
+
+// GetMigrationStatus returns the state of migrations in the database.
+// The migrations scoped to environments other than the one given by WithEnvironment are reported as skipped.
+func (c *Client) GetMigrationStatus(ctx context.Context, migrations Migrations, tableName string, opts ...MigrationOption) (*MigrationStatus, error) {
+	o := newMigrationOptions(opts)
+
+	version, dirty, err := c.GetSchemaMigrationVersion(ctx, tableName)
+	if err != nil {
+		var se *Error
+		if !errors.As(err, &se) || se.Code != ErrorCodeNoMigration {
+			return nil, err
+		}
+	}
+
+	history, err := c.GetMigrationHistory(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	return newMigrationStatus(migrations, version, dirty, history, o.env), nil
+}
+
+func newMigrationStatus(migrations Migrations, version uint, dirty bool, history []*MigrationHistory, env string) *MigrationStatus {
+	applied, baseline := appliedVersions(history)
+	skipped := skippedVersions(history)
+
+	dirtyVersion := dirtyMigrationVersion(history, version)
+
+	status := &MigrationStatus{
+		Version:    version,
+		Dirty:      dirty,
+		Migrations: []*MigrationStatusEntry{},
+		Gaps:       []*VersionRange{},
+	}
+
+	local := make(map[uint]bool, len(migrations))
+	for _, m := range migrations {
+		local[m.Version] = true
+
+		e := &MigrationStatusEntry{
+			Version:  m.Version,
+			Name:     m.Name,
+			FileName: m.FileName,
+			Kind:     m.Kind(),
+			Envs:     m.Envs,
+			Dirty:    dirty && m.Version == dirtyVersion,
+		}
+
+		switch {
+		case skipped[m.Version]:
+			e.State = MigrationStateSkipped
+		case applied[m.Version] || m.Version <= baseline:
+			e.State = MigrationStateApplied
+		case env != "" && !m.InEnv(env):
+			e.State = MigrationStateSkipped
+		case m.Version > version:
+			e.State = MigrationStatePending
+		default:
+			e.State = MigrationStateOutOfOrder
+		}
+
+		status.Migrations = append(status.Migrations, e)
+	}
+
+	for _, h := range history {
+		if local[h.Version] {
+			continue
+		}
+
+		state := MigrationStateMissing
+		if h.Skipped {
+			state = MigrationStateSkipped
+		}
+
+		status.Migrations = append(status.Migrations, &MigrationStatusEntry{
+			Version:  h.Version,
+			FileName: h.FileName,
+			State:    state,
+			Dirty:    dirty && h.Version == dirtyVersion,
+		})
+	}
+
+	sort.Slice(status.Migrations, func(i, j int) bool {
+		return status.Migrations[i].Version < status.Migrations[j].Version
+	})
+
+	versions := make([]uint, 0, len(migrations))
+	for _, m := range migrations {
+		versions = append(versions, m.Version)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+
+	// Timestamp versions are not sequential, so only the gaps between sequential versions are reported.
+	for i := 1; i < len(versions); i++ {
+		if IsTimestampVersion(versions[i]) {
+			break
+		}
+		if versions[i] > versions[i-1]+1 {
+			status.Gaps = append(status.Gaps, &VersionRange{First: versions[i-1] + 1, Last: versions[i] - 1})
+		}
+	}
+
+	return status
+}
+
+// appliedVersions returns the versions recorded as applied in history, and the baseline version.
+// Versions recorded without checksums are set by SetSchemaMigrationVersion or carried over from
+// an older wrench version, so all the versions up to the newest of them are regarded as applied.
+func appliedVersions(history []*MigrationHistory) (map[uint]bool, uint) {
+	applied := make(map[uint]bool, len(history))
+	var baseline uint
+	for _, h := range history {
+		applied[h.Version] = true
+		if h.Checksum == "" && h.Version > baseline {
+			baseline = h.Version
+		}
+	}
+	return applied, baseline
+}
+
+// skippedVersions returns the versions recorded as skipped in history.
+func skippedVersions(history []*MigrationHistory) map[uint]bool {
+	skipped := map[uint]bool{}
+	for _, h := range history {
+		if h.Skipped {
+			skipped[h.Version] = true
+		}
+	}
+	return skipped
+}
@@ -0,0 +1,185 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package spanner
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewMigrationStatus(t *testing.T) {
+	migrations := Migrations{
+		{Version: 1, Name: "baseline", FileName: "000001_baseline.sql", kind: statementKindDDL},
+		{Version: 2, FileName: "000002.sql", kind: statementKindDDL},
+		{Version: 3, FileName: "000003.sql", kind: statementKindDML},
+		{Version: 4, FileName: "000004.sql", kind: statementKindDDL},
+		{Version: 7, FileName: "000007.sql", kind: statementKindPartitionedDML},
+	}
+	history := []*MigrationHistory{
+		// carried over from an older wrench version.
+		{Version: 1},
+		{Version: 2, FileName: "000002.sql", Checksum: "a"},
+		{Version: 4, FileName: "000004.sql", Checksum: "b"},
+		{Version: 5, FileName: "000005.sql", Checksum: "c", Dirty: true},
+	}
+
+	status := newMigrationStatus(migrations, 5, true, history, "")
+
+	want := []*MigrationStatusEntry{
+		{Version: 1, Name: "baseline", FileName: "000001_baseline.sql", Kind: "DDL", State: MigrationStateApplied},
+		{Version: 2, FileName: "000002.sql", Kind: "DDL", State: MigrationStateApplied},
+		{Version: 3, FileName: "000003.sql", Kind: "DML", State: MigrationStateOutOfOrder},
+		{Version: 4, FileName: "000004.sql", Kind: "DDL", State: MigrationStateApplied},
+		{Version: 5, FileName: "000005.sql", State: MigrationStateMissing, Dirty: true},
+		{Version: 7, FileName: "000007.sql", Kind: "PartitionedDML", State: MigrationStatePending},
+	}
+
+	if len(status.Migrations) != len(want) {
+		t.Fatalf("want %d migrations, but got %d", len(want), len(status.Migrations))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(status.Migrations[i], want[i]) {
+			t.Errorf("migrations[%d] want %+v, but got %+v", i, want[i], status.Migrations[i])
+		}
+	}
+
+	if len(status.Gaps) != 1 || *status.Gaps[0] != (VersionRange{First: 5, Last: 6}) {
+		t.Errorf("want a gap from 5 to 6, but got %v", status.Gaps)
+	}
+
+	if want, got := 1, status.Count(MigrationStatePending); want != got {
+		t.Errorf("want %d pending migrations, but got %d", want, got)
+	}
+}
+
+func TestNewMigrationStatusWithDirtyOutOfOrderMigration(t *testing.T) {
+	migrations := Migrations{
+		{Version: 1, FileName: "000001.sql", kind: statementKindDDL},
+		{Version: 2, FileName: "000002.sql", kind: statementKindDDL},
+		{Version: 3, FileName: "000003.sql", kind: statementKindDDL},
+	}
+	history := []*MigrationHistory{
+		{Version: 1, FileName: "000001.sql", Checksum: "a"},
+		{Version: 2, FileName: "000002.sql", Checksum: "b", Dirty: true},
+		{Version: 3, FileName: "000003.sql", Checksum: "c"},
+	}
+
+	// 000002.sql failed out of order, and the database version stays at 3.
+	status := newMigrationStatus(migrations, 3, true, history, "")
+
+	for _, m := range status.Migrations {
+		if want, got := m.Version == 2, m.Dirty; want != got {
+			t.Errorf("version %d want dirty: %t, but got %t", m.Version, want, got)
+		}
+	}
+}
+
+func TestDirtyMigrationVersion(t *testing.T) {
+	tests := map[string]struct {
+		history []*MigrationHistory
+		want    uint
+	}{
+		"in order": {
+			history: []*MigrationHistory{{Version: 1}, {Version: 2, Dirty: true}},
+			want:    2,
+		},
+		"out of order": {
+			history: []*MigrationHistory{{Version: 1}, {Version: 2, Dirty: true}, {Version: 3}},
+			want:    2,
+		},
+		"no dirty history": {
+			history: []*MigrationHistory{{Version: 1}, {Version: 2}, {Version: 3}},
+			want:    3,
+		},
+		"no history": {
+			want: 3,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := dirtyMigrationVersion(test.history, 3); got != test.want {
+				t.Errorf("want %d, but got %d", test.want, got)
+			}
+		})
+	}
+}
+
+func TestNewMigrationStatusWithTimestampVersions(t *testing.T) {
+	migrations := Migrations{
+		{Version: 1, FileName: "000001.sql", kind: statementKindDDL},
+		{Version: 3, FileName: "000003.sql", kind: statementKindDDL},
+		{Version: 20261017093000, FileName: "20261017093000.sql", kind: statementKindDDL},
+		{Version: 20261018120000, FileName: "20261018120000.sql", kind: statementKindDDL},
+	}
+
+	status := newMigrationStatus(migrations, 0, false, nil, "")
+
+	// the timestamp versions are not regarded as gaps.
+	if len(status.Gaps) != 1 || *status.Gaps[0] != (VersionRange{First: 2, Last: 2}) {
+		t.Errorf("want a gap of 2, but got %v", status.Gaps)
+	}
+}
+
+func TestNewMigrationStatusWithEnvironments(t *testing.T) {
+	migrations := Migrations{
+		{Version: 1, FileName: "000001.sql", kind: statementKindDDL},
+		{Version: 2, FileName: "000002_seed.env-dev.sql", Envs: []string{"dev"}, kind: statementKindDML},
+		{Version: 3, FileName: "000003.sql", kind: statementKindDDL},
+		{Version: 4, FileName: "000004_seed.env-dev,test.sql", Envs: []string{"dev", "test"}, kind: statementKindDML},
+	}
+	history := []*MigrationHistory{
+		{Version: 1, FileName: "000001.sql", Checksum: "a"},
+		{Version: 2, FileName: "000002_seed.env-dev.sql", Checksum: "b", Skipped: true},
+		{Version: 3, FileName: "000003.sql", Checksum: "c"},
+	}
+
+	tests := map[string]struct {
+		env  string
+		want []MigrationState
+	}{
+		"without environment": {
+			env:  "",
+			want: []MigrationState{MigrationStateApplied, MigrationStateSkipped, MigrationStateApplied, MigrationStatePending},
+		},
+		"in environment": {
+			env:  "test",
+			want: []MigrationState{MigrationStateApplied, MigrationStateSkipped, MigrationStateApplied, MigrationStatePending},
+		},
+		"out of environment": {
+			env:  "prod",
+			want: []MigrationState{MigrationStateApplied, MigrationStateSkipped, MigrationStateApplied, MigrationStateSkipped},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			status := newMigrationStatus(migrations, 3, false, history, test.env)
+
+			var got []MigrationState
+			for _, m := range status.Migrations {
+				got = append(got, m.State)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("want %v, but got %v", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package spanner
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// templateFileSuffix is the suffix of the migration and schema files rendered as templates. e.g. 000001.sql.tmpl
+const templateFileSuffix = ".tmpl"
+
+// TemplateData is the data given to the templates of migration and schema files.
+//
+//	ALTER DATABASE `{{.Database}}` SET OPTIONS (version_retention_period = '{{.Vars.retention}}');
+type TemplateData struct {
+	// Project, Instance and Database are the ones of the database to be migrated.
+	Project  string
+	Instance string
+	Database string
+
+	// Vars are the variables given by the user. e.g. {{.Vars.ttl}}
+	Vars map[string]string
+
+	// Env are the environment variables. e.g. {{.Env.USER}}
+	Env map[string]string
+}
+
+// NewTemplateData returns the template data of the database of config with vars and the environment variables.
+func NewTemplateData(config *Config, vars map[string]string) *TemplateData {
+	env := map[string]string{}
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+
+	return &TemplateData{
+		Project:  config.Project,
+		Instance: config.Instance,
+		Database: config.Database,
+		Vars:     vars,
+		Env:      env,
+	}
+}
+
+// IsTemplateFile reports whether the file is rendered as a template. e.g. schema.sql.tmpl
+func IsTemplateFile(filename string) bool {
+	return strings.HasSuffix(filename, templateFileSuffix)
+}
+
+// RenderTemplate renders the template file with text/template. A key missing in data is an error,
+// so that a migration is never applied with an empty value by mistake.
+func RenderTemplate(filename string, file []byte, data *TemplateData) ([]byte, error) {
+	if data == nil {
+		data = &TemplateData{}
+	}
+
+	tmpl, err := template.New(filepath.Base(filename)).Option("missingkey=error").Parse(string(file))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", filename, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render template %s: %w", filename, err)
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package spanner_test
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/cloudspannerecosystem/wrench/internal/fs"
+	"github.com/cloudspannerecosystem/wrench/pkg/spanner"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	data := &spanner.TemplateData{
+		Project:  "project",
+		Instance: "instance",
+		Database: "database",
+		Vars:     map[string]string{"retention": "7d"},
+		Env:      map[string]string{"USER": "wrench"},
+	}
+
+	tests := map[string]struct {
+		tmpl    string
+		want    string
+		wantErr bool
+	}{
+		"built-ins": {
+			tmpl: "ALTER DATABASE `{{.Database}}` SET OPTIONS (version_retention_period = '{{.Vars.retention}}'); -- {{.Project}}/{{.Instance}} by {{.Env.USER}}",
+			want: "ALTER DATABASE `database` SET OPTIONS (version_retention_period = '7d'); -- project/instance by wrench",
+		},
+		"unknown var": {
+			tmpl:    "SELECT '{{.Vars.unknown}}';",
+			wantErr: true,
+		},
+		"unknown env": {
+			tmpl:    "SELECT '{{.Env.UNKNOWN}}';",
+			wantErr: true,
+		},
+		"unknown field": {
+			tmpl:    "SELECT '{{.Unknown}}';",
+			wantErr: true,
+		},
+		"syntax error": {
+			tmpl:    "SELECT '{{.Database';",
+			wantErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := spanner.RenderTemplate("000001.sql.tmpl", []byte(test.tmpl), data)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("want error, but got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want {
+				t.Errorf("want %q, but got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestReadTemplateMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/000001_foo.sql":           {Data: []byte("CREATE TABLE Foo (ID INT64) PRIMARY KEY(ID);")},
+		"migrations/000002_foo.sql.tmpl":      {Data: []byte("INSERT INTO Foo (ID) VALUES ({{.Vars.id}});")},
+		"migrations/000002_foo.down.sql.tmpl": {Data: []byte("DELETE FROM Foo WHERE ID = {{.Vars.id}};")},
+	}
+	ctx := fs.WithContext(context.Background(), fsys)
+
+	ms, err := spanner.ReadMigrations(ctx, "migrations", spanner.WithTemplateData(&spanner.TemplateData{
+		Vars: map[string]string{"id": "1"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 2 {
+		t.Fatalf("migrations length want 2, but got %d", len(ms))
+	}
+
+	m := ms[1]
+	if m.Version != 2 || m.Name != "foo" || m.FileName != "000002_foo.sql.tmpl" {
+		t.Errorf("want version 2 and name foo of 000002_foo.sql.tmpl, but got %d, %s and %s", m.Version, m.Name, m.FileName)
+	}
+	if want := "INSERT INTO Foo (ID) VALUES (1)"; len(m.Statements) != 1 || m.Statements[0] != want {
+		t.Errorf("statements want [%s], but got %v", want, m.Statements)
+	}
+	if want := "DELETE FROM Foo WHERE ID = 1"; len(m.DownStatements) != 1 || m.DownStatements[0] != want {
+		t.Errorf("down statements want [%s], but got %v", want, m.DownStatements)
+	}
+
+	if _, err := spanner.ReadMigrations(ctx, "migrations"); err == nil {
+		t.Error("want error without the variable, but got nil")
+	}
+}
@@ -0,0 +1 @@
+ALTER TABLE Singers ALTER COLUMN LastName STRING(MAX);
@@ -0,0 +1 @@
+DELETE FROM Singers WHERE SingerID = "2";
@@ -0,0 +1,139 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package spanner
+
+import (
+	"errors"
+	"fmt"
+)
+
+// hasTransactionBlocks reports whether the DML statements contain explicit transaction blocks.
+func hasTransactionBlocks(statements []string) bool {
+	for _, s := range statements {
+		if isTransactionControl(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitTransactions splits the DML statements into the transactions run in order.
+// Every BEGIN; ... COMMIT; block makes a transaction, and so do consecutive statements out of the blocks.
+// The statements of a transaction block include BEGIN and COMMIT, so that the steps cover all the statements.
+func splitTransactions(statements []string) ([]migrationStep, error) {
+	var (
+		steps   []migrationStep
+		inBlock bool
+	)
+	for i, s := range statements {
+		switch {
+		case isBeginTransaction(s):
+			if inBlock {
+				return nil, fmt.Errorf("statement #%d begins a transaction block in another transaction block", i+1)
+			}
+			inBlock = true
+			steps = append(steps, migrationStep{kind: statementKindDML, offset: i, statements: []string{s}})
+		case isCommitTransaction(s):
+			if !inBlock {
+				return nil, fmt.Errorf("statement #%d commits no transaction block", i+1)
+			}
+			inBlock = false
+			steps[len(steps)-1].statements = append(steps[len(steps)-1].statements, s)
+		case inBlock:
+			steps[len(steps)-1].statements = append(steps[len(steps)-1].statements, s)
+		default:
+			// A statement out of the blocks joins the previous one if it is also out of the blocks.
+			if n := len(steps); n > 0 && !isBeginTransaction(steps[n-1].statements[0]) {
+				steps[n-1].statements = append(steps[n-1].statements, s)
+				continue
+			}
+			steps = append(steps, migrationStep{kind: statementKindDML, offset: i, statements: []string{s}})
+		}
+	}
+	if inBlock {
+		return nil, errors.New("transaction block is not committed")
+	}
+	return steps, nil
+}
+
+// dmlTransactions splits the DML statements into the transactions run in order by splitTransactions,
+// and then splits the transactions out of the blocks into chunks by chunkTransactions.
+func dmlTransactions(statements []string, maxMutations int) ([]migrationStep, error) {
+	steps, err := splitTransactions(statements)
+	if err != nil {
+		return nil, err
+	}
+	return chunkTransactions(steps, maxMutations), nil
+}
+
+// chunkTransactions splits every DML step out of the transaction blocks into chunks whose estimated mutations are
+// at most maxMutations. Only the steps of INSERT statements with VALUES clauses estimated over maxMutations are split,
+// so that the other steps are still run in a single transaction. A statement over maxMutations makes its own chunk.
+func chunkTransactions(steps []migrationStep, maxMutations int) []migrationStep {
+	var result []migrationStep
+	for _, step := range steps {
+		if step.kind != statementKindDML || isBeginTransaction(step.statements[0]) {
+			result = append(result, step)
+			continue
+		}
+
+		mutations := make([]int, len(step.statements))
+		var total int
+		estimated := true
+		for i, s := range step.statements {
+			n, ok := estimateMutations(s)
+			if !ok {
+				estimated = false
+				break
+			}
+			mutations[i] = n
+			total += n
+		}
+		if !estimated || total <= maxMutations {
+			result = append(result, step)
+			continue
+		}
+
+		chunk := migrationStep{kind: statementKindDML, offset: step.offset}
+		var sum int
+		for i, s := range step.statements {
+			if len(chunk.statements) > 0 && sum+mutations[i] > maxMutations {
+				result = append(result, chunk)
+				chunk = migrationStep{kind: statementKindDML, offset: step.offset + i}
+				sum = 0
+			}
+			chunk.statements = append(chunk.statements, s)
+			sum += mutations[i]
+		}
+		result = append(result, chunk)
+	}
+	return result
+}
+
+// dmlStatements returns the statements of a transaction without BEGIN and COMMIT.
+func dmlStatements(statements []string) []string {
+	var result []string
+	for _, s := range statements {
+		if !isTransactionControl(s) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
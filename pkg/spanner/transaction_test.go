@@ -0,0 +1,224 @@
+// Copyright (c) 2020 Mercari, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package spanner
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cloudspannerecosystem/wrench/pkg/schema"
+)
+
+func TestSplitTransactions(t *testing.T) {
+	tests := map[string]struct {
+		statements []string
+		want       []string
+		wantErr    bool
+	}{
+		"blocks": {
+			statements: []string{
+				"INSERT INTO Singers (SingerID) VALUES ('1')",
+				"UPDATE Singers SET FirstName = 'Foo' WHERE true",
+				"BEGIN",
+				"INSERT INTO Singers (SingerID) VALUES ('2')",
+				"COMMIT",
+				"BEGIN TRANSACTION",
+				"DELETE FROM Singers WHERE FirstName IS NULL",
+				"COMMIT TRANSACTION",
+				"INSERT INTO Singers (SingerID) VALUES ('3')",
+			},
+			want: []string{"[0:2]", "[2:5]", "[5:8]", "[8:9]"},
+		},
+		"nested block": {
+			statements: []string{"BEGIN", "BEGIN", "COMMIT", "COMMIT"},
+			wantErr:    true,
+		},
+		"commit without begin": {
+			statements: []string{"INSERT INTO Singers (SingerID) VALUES ('1')", "COMMIT"},
+			wantErr:    true,
+		},
+		"block not committed": {
+			statements: []string{"BEGIN", "INSERT INTO Singers (SingerID) VALUES ('1')"},
+			wantErr:    true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			steps, err := splitTransactions(test.statements)
+			if test.wantErr {
+				if err == nil {
+					t.Error("want error, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, s := range steps {
+				got = append(got, fmt.Sprintf("[%d:%d]", s.offset, s.end()))
+			}
+			if fmt.Sprint(test.want) != fmt.Sprint(got) {
+				t.Errorf("want %v, but got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestInspectStatementsKindWithTransactionBlocks(t *testing.T) {
+	tests := map[string]struct {
+		statements []string
+		want       statementKind
+		wantErr    bool
+	}{
+		"DML": {
+			statements: []string{"BEGIN", "INSERT INTO Singers (SingerID) VALUES ('1')", "UPDATE Singers SET FirstName = 'Foo' WHERE true", "COMMIT"},
+			want:       statementKindDML,
+		},
+		"DDL": {
+			statements: []string{"BEGIN", "CREATE TABLE Foo (ID INT64) PRIMARY KEY(ID)", "COMMIT"},
+			wantErr:    true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := inspectStatementsKind(test.statements)
+			if test.wantErr {
+				if err == nil {
+					t.Error("want error, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.want != got {
+				t.Errorf("want %s, but got %s", test.want, got)
+			}
+		})
+	}
+}
+
+func TestChunkTransactions(t *testing.T) {
+	tests := map[string]struct {
+		statements []string
+		want       []string
+	}{
+		"under the limit": {
+			statements: []string{
+				"INSERT INTO Singers (SingerID, FirstName) VALUES ('1', 'Foo'), ('2', 'Bar')",
+			},
+			want: []string{"[0:1]"},
+		},
+		"over the limit": {
+			statements: []string{
+				"INSERT INTO Singers (SingerID, FirstName) VALUES ('1', 'Foo'), ('2', 'Bar')",
+				"INSERT INTO Singers (SingerID, FirstName) VALUES ('3', 'Baz')",
+				"INSERT INTO Singers (SingerID, FirstName) VALUES ('4', 'Qux')",
+				"INSERT INTO Singers (SingerID, FirstName, LastName) VALUES ('5', 'Foo', 'Bar'), ('6', 'Baz', 'Qux')",
+			},
+			want: []string{"[0:2]", "[2:3]", "[3:4]"},
+		},
+		"not estimated": {
+			statements: []string{
+				"INSERT INTO Singers (SingerID, FirstName) VALUES ('1', 'Foo'), ('2', 'Bar')",
+				"INSERT INTO Singers (SingerID, FirstName) SELECT SingerID, FirstName FROM Artists",
+				"UPDATE Singers SET FirstName = 'Foo' WHERE true",
+			},
+			want: []string{"[0:3]"},
+		},
+		"transaction block": {
+			statements: []string{
+				"BEGIN",
+				"INSERT INTO Singers (SingerID, FirstName) VALUES ('1', 'Foo'), ('2', 'Bar')",
+				"INSERT INTO Singers (SingerID, FirstName) VALUES ('3', 'Baz'), ('4', 'Qux')",
+				"COMMIT",
+			},
+			want: []string{"[0:4]"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			steps, err := dmlTransactions(test.statements, 6)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, s := range steps {
+				got = append(got, fmt.Sprintf("[%d:%d]", s.offset, s.end()))
+			}
+			if fmt.Sprint(test.want) != fmt.Sprint(got) {
+				t.Errorf("want %v, but got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestChunkTransactionsWithIndexes(t *testing.T) {
+	// The limit of the mutations of a commit in Cloud Spanner.
+	const commitLimit = 80000
+
+	catalog, err := schema.Parse("schema.sql", []byte(`
+CREATE TABLE Singers (
+  SingerID STRING(36) NOT NULL,
+  FirstName STRING(1024),
+  LastName STRING(1024),
+  Age INT64,
+) PRIMARY KEY(SingerID);
+CREATE INDEX SingersByName ON Singers(LastName, FirstName);
+CREATE INDEX SingersByAge ON Singers(Age) STORING (FirstName, LastName);
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every row writes its columns and the columns of the entries of the indexes, including the primary key.
+	table := catalog.Table("Singers")
+	perRow := len(table.Columns)
+	for _, idx := range catalog.TableIndexes("Singers") {
+		perRow += len(idx.Keys) + len(idx.Storing) + len(table.PrimaryKey)
+	}
+
+	const rows = 100
+	values := strings.TrimSuffix(strings.Repeat("('1', 'Foo', 'Bar', 30), ", rows), ", ")
+	statements := make([]string, 300)
+	for i := range statements {
+		statements[i] = "INSERT INTO Singers (SingerID, FirstName, LastName, Age) VALUES " + values
+	}
+
+	steps, err := dmlTransactions(statements, DefaultMaxMutations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) < 2 {
+		t.Fatalf("want the statements to be split, but got %d transaction", len(steps))
+	}
+	for _, step := range steps {
+		if n := len(step.statements) * rows * perRow; n > commitLimit {
+			t.Errorf("transaction [%d:%d] has %d mutations, which exceed the limit %d", step.offset, step.end(), n, commitLimit)
+		}
+	}
+}